@@ -0,0 +1,63 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+// MiddlewareConfig holds the configuration for the API key middleware.
+type MiddlewareConfig struct {
+	// Fallback handles requests that do not carry an API key, typically
+	// middleware.JWTAuthMiddlewareWithConfig with a bearer extractor. When nil,
+	// such requests are rejected with 401.
+	Fallback func(http.Handler) http.Handler
+}
+
+// Middleware authenticates "Authorization: Bearer sk_..." requests and stores the key's
+// owner in the context as a middleware.AuthenticatedUser, so AuthorizeRole and friends
+// work unchanged for machine clients.
+func Middleware(svc Service, cfg MiddlewareConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		var fallback http.Handler
+		if cfg.Fallback != nil {
+			fallback = cfg.Fallback(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := middleware.BearerToken(r)
+			if !svc.IsKey(raw) {
+				if fallback != nil {
+					fallback.ServeHTTP(w, r)
+					return
+				}
+				jsonResponse.SendErrorResponse(w, errors.New("missing api key", nil), http.StatusUnauthorized)
+				return
+			}
+
+			key, err := svc.Authenticate(r.Context(), raw)
+			if err != nil {
+				jsonResponse.SendAutoErrorResponse(w, err)
+				return
+			}
+
+			user := &middleware.AuthenticatedUser{
+				ID:       key.UserID.String(),
+				Role:     key.Role,
+				Scopes:   key.Scopes,
+				APIKeyID: key.ID.String(),
+			}
+
+			if state, ok := r.Context().Value(middleware.LogStateKey).(*middleware.LogState); ok {
+				state.SetUser(user.ID)
+				state.Set("api_key_id", user.APIKeyID)
+			}
+
+			ctx := context.WithValue(r.Context(), middleware.UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
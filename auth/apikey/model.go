@@ -0,0 +1,33 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/gormutil"
+)
+
+// APIKey is a long-lived credential for machine clients. Only the SHA-256 hash of
+// the key is stored; Hint keeps the first characters so users can tell keys apart.
+type APIKey struct {
+	gormutil.BaseModel
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;index"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"` // e.g. "sk_live_ab12cd"
+	KeyHash    string     `json:"-" gorm:"uniqueIndex"`
+	Role       string     `json:"role"`
+	Scopes     []string   `json:"scopes" gorm:"type:jsonb;serializer:json"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// IsExpired reports whether the key has an expiry that has passed.
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// IsRevoked reports whether the key has been revoked.
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
@@ -0,0 +1,48 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/gormutil"
+	"gorm.io/gorm"
+)
+
+type keyRepository struct {
+	repo *gormutil.Repository[APIKey]
+}
+
+// NewRepository creates a GORM-backed Storage for API keys.
+func NewRepository(db *gorm.DB) Storage {
+	return &keyRepository{
+		repo: gormutil.NewRepository[APIKey](db),
+	}
+}
+
+func (r *keyRepository) Create(ctx context.Context, key *APIKey) error {
+	return r.repo.Create(ctx, gormutil.GetTransaction(ctx), key)
+}
+
+func (r *keyRepository) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	return r.repo.FindOneBy(ctx, "key_hash = ?", hash)
+}
+
+func (r *keyRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*APIKey, error) {
+	var keys []*APIKey
+	err := r.repo.DB(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *keyRepository) Revoke(ctx context.Context, userID, keyID uuid.UUID, at time.Time) (bool, error) {
+	res := r.repo.DB(ctx).Model(&APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", at)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *keyRepository) TouchLastUsed(ctx context.Context, keyID uuid.UUID, at time.Time) error {
+	return r.repo.DB(ctx).Model(&APIKey{}).
+		Where("id = ?", keyID).
+		UpdateColumn("last_used_at", at).Error
+}
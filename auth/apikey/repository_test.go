@@ -0,0 +1,70 @@
+package apikey_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/auth/apikey"
+	"github.com/shashtag-ventures/go-common/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyRepository(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	ctx := context.Background()
+	db, teardown := testutil.SetupTestDatabase(ctx)
+	defer teardown()
+
+	require.NoError(t, db.AutoMigrate(&apikey.APIKey{}))
+
+	repo := apikey.NewRepository(db)
+	userID := uuid.New()
+
+	t.Run("Create, FindByHash and ListByUser", func(t *testing.T) {
+		testutil.CleanTables(db, "api_keys")
+
+		key := &apikey.APIKey{UserID: userID, Name: "ci", KeyHash: "hash-1", Scopes: []string{"deploy"}}
+		require.NoError(t, repo.Create(ctx, key))
+
+		found, err := repo.FindByHash(ctx, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"deploy"}, found.Scopes)
+
+		keys, err := repo.ListByUser(ctx, userID)
+		require.NoError(t, err)
+		assert.Len(t, keys, 1)
+	})
+
+	t.Run("Revoke only affects the owner's key", func(t *testing.T) {
+		testutil.CleanTables(db, "api_keys")
+
+		key := &apikey.APIKey{UserID: userID, Name: "ci", KeyHash: "hash-2"}
+		require.NoError(t, repo.Create(ctx, key))
+
+		ok, err := repo.Revoke(ctx, uuid.New(), key.ID, time.Now())
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = repo.Revoke(ctx, userID, key.ID, time.Now())
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("TouchLastUsed", func(t *testing.T) {
+		testutil.CleanTables(db, "api_keys")
+
+		key := &apikey.APIKey{UserID: userID, Name: "ci", KeyHash: "hash-3"}
+		require.NoError(t, repo.Create(ctx, key))
+		require.NoError(t, repo.TouchLastUsed(ctx, key.ID, time.Now()))
+
+		found, err := repo.FindByHash(ctx, "hash-3")
+		require.NoError(t, err)
+		assert.NotNil(t, found.LastUsedAt)
+	})
+}
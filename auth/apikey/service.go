@@ -0,0 +1,209 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/strutil"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPrefix is used when Config.Prefix is empty.
+	DefaultPrefix = "sk_live"
+	// secretLength is the number of random characters after the prefix.
+	secretLength = 40
+	// hintLength is the number of secret characters kept in APIKey.Hint.
+	hintLength = 6
+	// defaultTouchInterval limits how often LastUsedAt is written for a busy key.
+	defaultTouchInterval = time.Minute
+)
+
+// Errors returned by Authenticate. They wrap errors.ErrUnauthorized so that
+// jsonResponse.SendAutoErrorResponse maps them to 401.
+var (
+	ErrInvalidKey = errors.New("invalid api key", errors.ErrUnauthorized)
+	ErrExpiredKey = errors.New("api key expired", errors.ErrUnauthorized)
+)
+
+// Config holds the settings for the API key service.
+type Config struct {
+	// Prefix identifies keys issued by this service, e.g. "sk_live" or "sk_test".
+	Prefix string
+	// TouchInterval is the minimum time between LastUsedAt writes for a key.
+	TouchInterval time.Duration
+}
+
+// CreateParams holds the data needed to create a key.
+type CreateParams struct {
+	UserID    uuid.UUID
+	Name      string
+	Role      string
+	Scopes    []string
+	ExpiresAt *time.Time // nil means the key never expires
+}
+
+// CreatedKey is returned once on creation. Key is the raw secret and cannot be recovered later.
+type CreatedKey struct {
+	Key    string
+	APIKey *APIKey
+}
+
+// Service manages API keys.
+type Service interface {
+	Create(ctx context.Context, params CreateParams) (*CreatedKey, error)
+	Authenticate(ctx context.Context, rawKey string) (*APIKey, error)
+	List(ctx context.Context, userID uuid.UUID) ([]*APIKey, error)
+	Revoke(ctx context.Context, userID, keyID uuid.UUID) error
+	// IsKey reports whether a raw credential carries this service's key prefix.
+	IsKey(raw string) bool
+}
+
+type keyService struct {
+	db            Storage
+	prefix        string
+	touchInterval time.Duration
+	now           func() time.Time
+
+	touchMu   sync.Mutex
+	lastTouch map[uuid.UUID]time.Time
+	lastSweep time.Time
+}
+
+// NewService creates a new API key Service.
+func NewService(db Storage, cfg Config) Service {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	interval := cfg.TouchInterval
+	if interval <= 0 {
+		interval = defaultTouchInterval
+	}
+	return &keyService{
+		db:            db,
+		prefix:        strings.TrimSuffix(prefix, "_") + "_",
+		touchInterval: interval,
+		now:           time.Now,
+		lastTouch:     make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (s *keyService) Create(ctx context.Context, params CreateParams) (*CreatedKey, error) {
+	if params.UserID == uuid.Nil {
+		return nil, errors.New("api key requires a user", errors.ErrInvalidInput)
+	}
+	if strings.TrimSpace(params.Name) == "" {
+		return nil, errors.New("api key requires a name", errors.ErrInvalidInput)
+	}
+
+	secret := strutil.RandomString(secretLength, "")
+	raw := s.prefix + secret
+
+	key := &APIKey{
+		UserID:    params.UserID,
+		Name:      params.Name,
+		Hint:      s.prefix + secret[:hintLength],
+		KeyHash:   HashKey(raw),
+		Role:      params.Role,
+		Scopes:    params.Scopes,
+		ExpiresAt: params.ExpiresAt,
+	}
+	if err := s.db.Create(ctx, key); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to store api key", "userID", params.UserID, "error", err)
+		return nil, errors.New("failed to create api key", errors.ErrInternal)
+	}
+
+	return &CreatedKey{Key: raw, APIKey: key}, nil
+}
+
+func (s *keyService) Authenticate(ctx context.Context, rawKey string) (*APIKey, error) {
+	if !s.IsKey(rawKey) {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := s.db.FindByHash(ctx, HashKey(rawKey))
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidKey
+		}
+		return nil, errors.New("failed to look up api key", errors.ErrInternal)
+	}
+
+	now := s.now()
+	if key.IsRevoked() {
+		return nil, ErrInvalidKey
+	}
+	if key.IsExpired(now) {
+		return nil, ErrExpiredKey
+	}
+
+	s.touch(ctx, key.ID, now)
+	return key, nil
+}
+
+func (s *keyService) List(ctx context.Context, userID uuid.UUID) ([]*APIKey, error) {
+	return s.db.ListByUser(ctx, userID)
+}
+
+func (s *keyService) Revoke(ctx context.Context, userID, keyID uuid.UUID) error {
+	found, err := s.db.Revoke(ctx, userID, keyID, s.now())
+	if err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to revoke api key", "keyID", keyID, "error", err)
+		return errors.New("failed to revoke api key", errors.ErrInternal)
+	}
+	if !found {
+		return errors.New("api key not found", errors.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *keyService) IsKey(raw string) bool {
+	return strings.HasPrefix(raw, s.prefix) && len(raw) > len(s.prefix)
+}
+
+// touch records key usage, writing at most once per touchInterval per key so that
+// a busy key does not turn every request into a database write.
+func (s *keyService) touch(ctx context.Context, keyID uuid.UUID, now time.Time) {
+	s.touchMu.Lock()
+	if last, ok := s.lastTouch[keyID]; ok && now.Sub(last) < s.touchInterval {
+		s.touchMu.Unlock()
+		return
+	}
+	s.lastTouch[keyID] = now
+	s.sweepTouchesLocked(now)
+	s.touchMu.Unlock()
+
+	if err := s.db.TouchLastUsed(ctx, keyID, now); err != nil {
+		middleware.GetLoggerFromContext(ctx).Warn("Failed to update api key last used time", "keyID", keyID, "error", err)
+	}
+}
+
+// sweepTouchesLocked drops keys whose last touch is older than touchInterval, at most
+// once per touchInterval, so keys that are no longer used do not accumulate. The
+// caller must hold touchMu.
+func (s *keyService) sweepTouchesLocked(now time.Time) {
+	if now.Sub(s.lastSweep) < s.touchInterval {
+		return
+	}
+	s.lastSweep = now
+	for id, last := range s.lastTouch {
+		if now.Sub(last) >= s.touchInterval {
+			delete(s.lastTouch, id)
+		}
+	}
+}
+
+// HashKey returns the hex-encoded SHA-256 hash of a raw key as stored in the database.
+func HashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
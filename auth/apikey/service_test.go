@@ -0,0 +1,180 @@
+package apikey
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryStorage is an in-memory Storage used to exercise the service without a database.
+type memoryStorage struct {
+	mu      sync.Mutex
+	keys    map[uuid.UUID]*APIKey
+	touches int
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{keys: make(map[uuid.UUID]*APIKey)}
+}
+
+func (m *memoryStorage) Create(_ context.Context, key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key.ID = uuid.New()
+	copied := *key
+	m.keys[key.ID] = &copied
+	return nil
+}
+
+func (m *memoryStorage) FindByHash(_ context.Context, hash string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.keys {
+		if k.KeyHash == hash {
+			copied := *k
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListByUser(_ context.Context, userID uuid.UUID) ([]*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []*APIKey
+	for _, k := range m.keys {
+		if k.UserID == userID {
+			copied := *k
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryStorage) Revoke(_ context.Context, userID, keyID uuid.UUID, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.keys[keyID]
+	if !ok || k.UserID != userID || k.RevokedAt != nil {
+		return false, nil
+	}
+	k.RevokedAt = &at
+	return true, nil
+}
+
+func (m *memoryStorage) TouchLastUsed(_ context.Context, keyID uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touches++
+	if k, ok := m.keys[keyID]; ok {
+		k.LastUsedAt = &at
+	}
+	return nil
+}
+
+func TestAPIKeyService(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("Create returns a prefixed key and stores only its hash", func(t *testing.T) {
+		store := newMemoryStorage()
+		svc := NewService(store, Config{})
+
+		created, err := svc.Create(ctx, CreateParams{UserID: userID, Name: "ci", Role: "member", Scopes: []string{"deploy"}})
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(created.Key, "sk_live_"))
+		assert.True(t, strings.HasPrefix(created.Key, created.APIKey.Hint))
+		assert.NotContains(t, created.APIKey.KeyHash, created.Key)
+		assert.Equal(t, HashKey(created.Key), created.APIKey.KeyHash)
+	})
+
+	t.Run("Create validates input", func(t *testing.T) {
+		svc := NewService(newMemoryStorage(), Config{})
+
+		_, err := svc.Create(ctx, CreateParams{Name: "ci"})
+		assert.ErrorIs(t, err, customErrors.ErrInvalidInput)
+
+		_, err = svc.Create(ctx, CreateParams{UserID: userID})
+		assert.ErrorIs(t, err, customErrors.ErrInvalidInput)
+	})
+
+	t.Run("Authenticate", func(t *testing.T) {
+		store := newMemoryStorage()
+		svc := NewService(store, Config{Prefix: "sk_test"})
+
+		created, err := svc.Create(ctx, CreateParams{UserID: userID, Name: "ci"})
+		require.NoError(t, err)
+
+		key, err := svc.Authenticate(ctx, created.Key)
+		require.NoError(t, err)
+		assert.Equal(t, userID, key.UserID)
+
+		_, err = svc.Authenticate(ctx, "sk_test_wrong")
+		assert.ErrorIs(t, err, ErrInvalidKey)
+
+		_, err = svc.Authenticate(ctx, "sk_live_"+created.Key[len("sk_test_"):])
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+
+	t.Run("Expired and revoked keys are rejected", func(t *testing.T) {
+		svc := NewService(newMemoryStorage(), Config{})
+
+		past := time.Now().Add(-time.Minute)
+		expired, err := svc.Create(ctx, CreateParams{UserID: userID, Name: "old", ExpiresAt: &past})
+		require.NoError(t, err)
+		_, err = svc.Authenticate(ctx, expired.Key)
+		assert.ErrorIs(t, err, ErrExpiredKey)
+
+		active, err := svc.Create(ctx, CreateParams{UserID: userID, Name: "active"})
+		require.NoError(t, err)
+		require.NoError(t, svc.Revoke(ctx, userID, active.APIKey.ID))
+		_, err = svc.Authenticate(ctx, active.Key)
+		assert.ErrorIs(t, err, ErrInvalidKey)
+
+		err = svc.Revoke(ctx, uuid.New(), active.APIKey.ID)
+		assert.ErrorIs(t, err, customErrors.ErrNotFound)
+	})
+
+	t.Run("Last used is throttled", func(t *testing.T) {
+		store := newMemoryStorage()
+		svc := NewService(store, Config{TouchInterval: time.Hour})
+
+		created, err := svc.Create(ctx, CreateParams{UserID: userID, Name: "busy"})
+		require.NoError(t, err)
+
+		for i := 0; i < 5; i++ {
+			_, err := svc.Authenticate(ctx, created.Key)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 1, store.touches)
+
+		keys, err := svc.List(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		assert.NotNil(t, keys[0].LastUsedAt)
+	})
+
+	t.Run("Stale touches are evicted", func(t *testing.T) {
+		store := newMemoryStorage()
+		svc := NewService(store, Config{TouchInterval: time.Minute}).(*keyService)
+		now := time.Now()
+
+		for i := 0; i < 3; i++ {
+			svc.touch(ctx, uuid.New(), now)
+		}
+		require.Len(t, svc.lastTouch, 3)
+
+		fresh := uuid.New()
+		svc.touch(ctx, fresh, now.Add(2*time.Minute))
+		assert.Len(t, svc.lastTouch, 1)
+		assert.Contains(t, svc.lastTouch, fresh)
+	})
+}
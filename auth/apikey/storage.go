@@ -0,0 +1,18 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Storage defines the persistence operations required by the API key service.
+type Storage interface {
+	Create(ctx context.Context, key *APIKey) error
+	FindByHash(ctx context.Context, hash string) (*APIKey, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*APIKey, error)
+	// Revoke marks a key of the user as revoked and reports whether a key was found.
+	Revoke(ctx context.Context, userID, keyID uuid.UUID, at time.Time) (bool, error)
+	TouchLastUsed(ctx context.Context, keyID uuid.UUID, at time.Time) error
+}
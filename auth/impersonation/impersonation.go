@@ -0,0 +1,305 @@
+// Package impersonation lets admins act as another user, e.g. so support staff can
+// see what a customer sees.
+//
+// An admin calls the Start handler and receives a short-lived access token for the
+// target user. The token carries the admin in its "act" claim, so once it passes
+// middleware.JWTAuthMiddleware the AuthenticatedUser is the target with
+// ImpersonatedBy set to the admin. Every request log names both, and routes behind
+// middleware.DenyImpersonation refuse such tokens.
+package impersonation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/jwt"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+const (
+	// DefaultTTL is the lifetime of impersonation tokens when Config.TTL is not set.
+	DefaultTTL = 15 * time.Minute
+	// MaxTTL caps Config.TTL; impersonation is meant for a single support session.
+	MaxTTL = time.Hour
+)
+
+// DefaultAdminRoles are the roles allowed to impersonate when Config.AdminRoles is empty.
+var DefaultAdminRoles = []string{"admin"}
+
+// Actions recorded in an Event.
+const (
+	ActionStart = "impersonation.start"
+	ActionStop  = "impersonation.stop"
+)
+
+// Event is an audit record of an impersonation starting or stopping.
+type Event struct {
+	Action    string
+	ActorID   string
+	ActorRole string
+	TargetID  string
+	Reason    string
+	TokenID   string
+	ExpiresAt time.Time
+	IP        string
+	UserAgent string
+	Time      time.Time
+}
+
+// Auditor persists impersonation events, e.g. to an audit log table.
+type Auditor interface {
+	RecordImpersonation(ctx context.Context, e Event) error
+}
+
+// AuditorFunc adapts a function to Auditor.
+type AuditorFunc func(ctx context.Context, e Event) error
+
+func (f AuditorFunc) RecordImpersonation(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// UserLookup loads the user to impersonate. It returns nil with a nil error if the
+// user does not exist.
+type UserLookup func(ctx context.Context, userID string) (*middleware.AuthenticatedUser, error)
+
+// Config holds the settings for the impersonation handlers.
+type Config struct {
+	JWTSecret  string
+	LookupUser UserLookup    // Required
+	TTL        time.Duration // Defaults to DefaultTTL, capped at MaxTTL
+	// Token sets the issuer and audience of minted tokens; its TTL is ignored.
+	Token jwt.TokenOptions
+	// AdminRoles may start an impersonation. Defaults to DefaultAdminRoles.
+	AdminRoles []string
+	// ProtectedRoles cannot be impersonated. Defaults to AdminRoles, so admins cannot
+	// use each other's accounts.
+	ProtectedRoles []string
+	// RequireReason rejects requests without a reason (e.g. a ticket number).
+	RequireReason bool
+	// Audit records every start and stop. If it fails, no token is issued. Events are
+	// always logged as well.
+	Audit Auditor
+	// Revocations, when set, is used by Stop to revoke the impersonation token.
+	Revocations jwt.RevocationStore
+}
+
+// StartRequest is the JSON body of the Start handler.
+type StartRequest struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// TokenResponse is the JSON body returned by the Start handler.
+type TokenResponse struct {
+	AccessToken    string    `json:"access_token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	UserID         string    `json:"user_id"`
+	ImpersonatorID string    `json:"impersonator_id"`
+}
+
+// IssuedToken is the result of Issue.
+type IssuedToken struct {
+	Token     string
+	TokenID   string
+	ExpiresAt time.Time
+	User      *middleware.AuthenticatedUser
+}
+
+// Handler exposes HTTP endpoints for starting and stopping impersonation.
+type Handler struct {
+	cfg   Config
+	start http.Handler
+	now   func() time.Time
+}
+
+// NewHandler creates a new Handler. It panics if JWTSecret or LookupUser is missing.
+func NewHandler(cfg Config) *Handler {
+	if cfg.JWTSecret == "" || cfg.LookupUser == nil {
+		panic("impersonation: Config.JWTSecret and Config.LookupUser are required")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.TTL > MaxTTL {
+		cfg.TTL = MaxTTL
+	}
+	if len(cfg.AdminRoles) == 0 {
+		cfg.AdminRoles = DefaultAdminRoles
+	}
+	if cfg.ProtectedRoles == nil {
+		cfg.ProtectedRoles = cfg.AdminRoles
+	}
+
+	h := &Handler{cfg: cfg, now: time.Now}
+	h.start = middleware.AuthorizeRole(cfg.AdminRoles...)(http.HandlerFunc(h.serveStart))
+	return h
+}
+
+// Start mints an impersonation token for the user in the StartRequest body and
+// returns it as a TokenResponse. Only AdminRoles may call it; mount it behind
+// JWTAuthMiddleware. The admin's own cookies are left untouched, so the client sends
+// the returned token as a bearer token and simply drops it to stop.
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	h.start.ServeHTTP(w, r)
+}
+
+func (h *Handler) serveStart(w http.ResponseWriter, r *http.Request) {
+	actor, err := middleware.GetAuthenticatedUser(r.Context())
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	var req StartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse.SendErrorResponse(w, errors.New("invalid request body", errors.ErrInvalidInput), http.StatusBadRequest)
+		return
+	}
+
+	issued, err := h.Issue(r.Context(), actor, req.UserID, req.Reason, r)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse.JsonResponse(w, http.StatusCreated, TokenResponse{
+		AccessToken:    issued.Token,
+		ExpiresAt:      issued.ExpiresAt,
+		UserID:         issued.User.ID,
+		ImpersonatorID: actor.ID,
+	})
+}
+
+// Issue mints an impersonation token for targetID on behalf of actor and records the
+// start event. r is only used for the client IP and user agent of the event and may
+// be nil. The caller is responsible for checking that actor is an admin; Start does
+// this with AuthorizeRole.
+func (h *Handler) Issue(ctx context.Context, actor *middleware.AuthenticatedUser, targetID, reason string, r *http.Request) (*IssuedToken, error) {
+	if actor.IsImpersonated() {
+		return nil, errors.New("cannot impersonate while impersonating", errors.ErrForbidden)
+	}
+	if targetID == "" {
+		return nil, errors.New("user_id is required", errors.ErrInvalidInput)
+	}
+	if h.cfg.RequireReason && reason == "" {
+		return nil, errors.New("reason is required", errors.ErrInvalidInput)
+	}
+	if targetID == actor.ID {
+		return nil, errors.New("cannot impersonate yourself", errors.ErrInvalidInput)
+	}
+
+	target, err := h.cfg.LookupUser(ctx, targetID)
+	if err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to look up user to impersonate", "targetID", targetID, "error", err)
+		return nil, errors.New("failed to look up user", errors.ErrInternal)
+	}
+	if target == nil {
+		return nil, errors.New("user not found", errors.ErrNotFound)
+	}
+	for _, role := range h.cfg.ProtectedRoles {
+		if target.Role == role {
+			return nil, errors.New("user cannot be impersonated", errors.ErrForbidden)
+		}
+	}
+
+	claims := &jwt.Claims{
+		UserID:   target.ID,
+		Role:     target.Role,
+		Email:    target.Email,
+		Scopes:   target.Scopes,
+		TenantID: target.TenantID,
+		Actor:    &jwt.Actor{UserID: actor.ID, Role: actor.Role, Email: actor.Email},
+	}
+	opts := h.cfg.Token
+	opts.TTL = h.cfg.TTL
+	token, err := jwt.CreateTokenWithClaims(claims, h.cfg.JWTSecret, opts)
+	if err != nil {
+		return nil, errors.New("failed to create impersonation token", errors.ErrInternal)
+	}
+
+	issued := &IssuedToken{
+		Token:     token,
+		TokenID:   claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		User:      target,
+	}
+	event := h.event(ActionStart, actor, target.ID, reason, issued.TokenID, issued.ExpiresAt, r)
+	if err := h.record(ctx, event); err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// Stop ends the impersonation the request is authenticated with: the token is revoked
+// if Config.Revocations is set, and the stop event is recorded. Mount it behind
+// JWTAuthMiddleware; it responds with 204.
+func (h *Handler) Stop(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := middleware.GetAuthenticatedUser(ctx)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+	if !user.IsImpersonated() {
+		jsonResponse.SendErrorResponse(w, errors.New("not impersonating", errors.ErrInvalidInput), http.StatusBadRequest)
+		return
+	}
+
+	if h.cfg.Revocations != nil && user.TokenID != "" {
+		if err := h.cfg.Revocations.Revoke(ctx, user.TokenID, user.TokenExpiresAt); err != nil {
+			middleware.GetLoggerFromContext(ctx).Error("Failed to revoke impersonation token", "tokenID", user.TokenID, "error", err)
+			jsonResponse.SendAutoErrorResponse(w, errors.New("failed to revoke impersonation token", errors.ErrInternal))
+			return
+		}
+	}
+
+	event := h.event(ActionStop, user.ImpersonatedBy, user.ID, "", user.TokenID, user.TokenExpiresAt, r)
+	if err := h.record(ctx, event); err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) event(action string, actor *middleware.AuthenticatedUser, targetID, reason, tokenID string, expiresAt time.Time, r *http.Request) Event {
+	e := Event{
+		Action:    action,
+		ActorID:   actor.ID,
+		ActorRole: actor.Role,
+		TargetID:  targetID,
+		Reason:    reason,
+		TokenID:   tokenID,
+		ExpiresAt: expiresAt,
+		Time:      h.now(),
+	}
+	if r != nil {
+		e.IP = middleware.ClientIP(r)
+		e.UserAgent = r.UserAgent()
+	}
+	return e
+}
+
+// record logs the event and passes it to the auditor.
+func (h *Handler) record(ctx context.Context, e Event) error {
+	logger := middleware.GetLoggerFromContext(ctx)
+	logger.Warn("Impersonation event",
+		"action", e.Action,
+		"actor_id", e.ActorID,
+		"target_id", e.TargetID,
+		"reason", e.Reason,
+		"token_id", e.TokenID,
+		"expires_at", e.ExpiresAt,
+	)
+	if h.cfg.Audit == nil {
+		return nil
+	}
+	if err := h.cfg.Audit.RecordImpersonation(ctx, e); err != nil {
+		logger.Error("Failed to record impersonation event", "action", e.Action, "error", err)
+		return errors.New("failed to record audit event", errors.ErrInternal)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package impersonation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jwt"
+	"github.com/shashtag-ventures/go-common/jwt/revocation"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "test-secret"
+
+var testUsers = map[string]*middleware.AuthenticatedUser{
+	"admin-1":    {ID: "admin-1", Role: "admin", Email: "ops@example.com"},
+	"admin-2":    {ID: "admin-2", Role: "admin"},
+	"customer-1": {ID: "customer-1", Role: "member", Email: "jane@example.com", TenantID: "acme", Scopes: []string{"project:read"}},
+}
+
+func lookupTestUser(_ context.Context, userID string) (*middleware.AuthenticatedUser, error) {
+	return testUsers[userID], nil
+}
+
+func bearer(t *testing.T, userID string) string {
+	u := testUsers[userID]
+	token, err := jwt.CreateToken(u.ID, u.Role, testSecret, time.Hour)
+	require.NoError(t, err)
+	return "Bearer " + token
+}
+
+func TestImpersonation(t *testing.T) {
+	var events []Event
+	revocations := revocation.NewMemoryStore()
+	h := NewHandler(Config{
+		JWTSecret:     testSecret,
+		LookupUser:    lookupTestUser,
+		RequireReason: true,
+		Revocations:   revocations,
+		Audit: AuditorFunc(func(_ context.Context, e Event) error {
+			events = append(events, e)
+			return nil
+		}),
+	})
+
+	auth := middleware.JWTAuthMiddlewareWithConfig(middleware.JWTAuthConfig{
+		Secret:      testSecret,
+		Extractors:  []middleware.TokenExtractor{middleware.BearerTokenExtractor()},
+		Revocations: revocations,
+	})
+	start := func(authorization, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/impersonate", strings.NewReader(body))
+		req.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		auth(http.HandlerFunc(h.Start)).ServeHTTP(rr, req)
+		return rr
+	}
+
+	var state *middleware.LogState
+	whoami := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.GetUserFromContext(r.Context())
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":     user.ID,
+			"tenant": user.TenantID,
+			"real":   user.RealUser().ID,
+		})
+	}))
+	call := func(h http.Handler, authorization string) *httptest.ResponseRecorder {
+		state = &middleware.LogState{}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.LogStateKey, state))
+		req.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var impersonationToken string
+
+	t.Run("Admin acts as the user", func(t *testing.T) {
+		rr := start(bearer(t, "admin-1"), `{"user_id":"customer-1","reason":"TICKET-42"}`)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var resp TokenResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Equal(t, "customer-1", resp.UserID)
+		assert.Equal(t, "admin-1", resp.ImpersonatorID)
+		assert.WithinDuration(t, time.Now().Add(DefaultTTL), resp.ExpiresAt, 5*time.Second)
+		impersonationToken = "Bearer " + resp.AccessToken
+
+		claims, err := jwt.ParseToken(resp.AccessToken, testSecret)
+		require.NoError(t, err)
+		assert.True(t, claims.IsImpersonation())
+		assert.Equal(t, "admin-1", claims.Actor.UserID)
+
+		rr = call(whoami, impersonationToken)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, map[string]string{"id": "customer-1", "tenant": "acme", "real": "admin-1"}, body)
+		assert.Equal(t, "customer-1", state.UserID)
+		assert.Equal(t, "admin-1", state.Fields["impersonator_id"])
+
+		require.Len(t, events, 1)
+		assert.Equal(t, ActionStart, events[0].Action)
+		assert.Equal(t, "admin-1", events[0].ActorID)
+		assert.Equal(t, "customer-1", events[0].TargetID)
+		assert.Equal(t, "TICKET-42", events[0].Reason)
+	})
+
+	t.Run("Sensitive routes opt out", func(t *testing.T) {
+		sensitive := auth(middleware.DenyImpersonation()(whoami))
+		assert.Equal(t, http.StatusForbidden, call(sensitive, impersonationToken).Code)
+		assert.Equal(t, http.StatusOK, call(sensitive, bearer(t, "customer-1")).Code)
+	})
+
+	t.Run("Rejected requests", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			authorization string
+			body          string
+			code          int
+		}{
+			{"Non-admin", bearer(t, "customer-1"), `{"user_id":"admin-1","reason":"x"}`, http.StatusForbidden},
+			{"While impersonating", impersonationToken, `{"user_id":"customer-1","reason":"x"}`, http.StatusForbidden},
+			{"Protected role", bearer(t, "admin-1"), `{"user_id":"admin-2","reason":"x"}`, http.StatusForbidden},
+			{"Self", bearer(t, "admin-1"), `{"user_id":"admin-1","reason":"x"}`, http.StatusBadRequest},
+			{"Missing reason", bearer(t, "admin-1"), `{"user_id":"customer-1"}`, http.StatusBadRequest},
+			{"Unknown user", bearer(t, "admin-1"), `{"user_id":"ghost","reason":"x"}`, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.code, start(tt.authorization, tt.body).Code)
+			})
+		}
+		assert.Len(t, events, 1, "only successful starts are audited")
+	})
+
+	t.Run("Stop revokes the token", func(t *testing.T) {
+		stop := auth(http.HandlerFunc(h.Stop))
+		assert.Equal(t, http.StatusBadRequest, call(stop, bearer(t, "admin-1")).Code)
+
+		assert.Equal(t, http.StatusNoContent, call(stop, impersonationToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, call(whoami, impersonationToken).Code)
+
+		require.Len(t, events, 2)
+		assert.Equal(t, ActionStop, events[1].Action)
+		assert.Equal(t, "admin-1", events[1].ActorID)
+	})
+
+	t.Run("Revoking the admin revokes their impersonation tokens", func(t *testing.T) {
+		rr := start(bearer(t, "admin-1"), `{"user_id":"customer-1","reason":"TICKET-43"}`)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		var resp TokenResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+		now := time.Now().Add(time.Second)
+		require.NoError(t, revocations.RevokeUser(context.Background(), "admin-1", now, now.Add(time.Hour)))
+		assert.Equal(t, http.StatusUnauthorized, call(whoami, "Bearer "+resp.AccessToken).Code)
+	})
+}
+
+func TestImpersonationAuditFailure(t *testing.T) {
+	h := NewHandler(Config{
+		JWTSecret:  testSecret,
+		LookupUser: lookupTestUser,
+		Audit: AuditorFunc(func(context.Context, Event) error {
+			return errors.New("audit log down")
+		}),
+	})
+
+	_, err := h.Issue(context.Background(), testUsers["admin-1"], "customer-1", "", nil)
+	assert.Error(t, err, "no token is issued without an audit record")
+}
@@ -0,0 +1,239 @@
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/jwt"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+// DefaultAccessTokenTTL is the lifetime of access tokens minted by the refresh handler.
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+// RoleResolver looks up the current role of a user when minting a new access token.
+// Resolving on every refresh means role changes take effect without a new login.
+type RoleResolver func(ctx context.Context, userID uuid.UUID) (string, error)
+
+// HandlerConfig holds the configuration for the refresh and logout handlers.
+type HandlerConfig struct {
+	JWTSecret      string
+	AccessTokenTTL time.Duration // Defaults to DefaultAccessTokenTTL
+	CookieSecure   bool
+	CookieDomain   string
+	ResolveRole    RoleResolver // Required
+	// Revocations, when set, is used to deny access tokens on logout so they stop
+	// working immediately instead of at expiry.
+	Revocations jwt.RevocationStore
+	// Token sets the issuer and audience of access tokens, e.g. config.JWTConfig's
+	// TokenOptions, so they pass JWTAuthConfig.Validation. Its TTL is ignored.
+	Token jwt.TokenOptions
+}
+
+// TokenResponse is the JSON body returned by the refresh handler.
+// RefreshToken is only populated for clients that sent the token in the body
+// (CLI, mobile); browser clients receive it as an HttpOnly cookie instead.
+type TokenResponse struct {
+	AccessToken      string    `json:"access_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token,omitempty"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type tokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Handler exposes HTTP endpoints for refreshing and revoking tokens.
+type Handler struct {
+	service Service
+	cfg     HandlerConfig
+}
+
+// NewHandler creates a new Handler. It panics if ResolveRole is missing.
+func NewHandler(service Service, cfg HandlerConfig) *Handler {
+	if cfg.ResolveRole == nil {
+		panic("refresh: HandlerConfig.ResolveRole is required")
+	}
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	return &Handler{service: service, cfg: cfg}
+}
+
+// Login issues a new refresh token family and access token for an authenticated user
+// and writes both as cookies. Call it at the end of the OAuth callback.
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request, userID uuid.UUID, role string) error {
+	issued, err := h.service.Issue(r.Context(), userID, metadataFromRequest(r))
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := h.createAccessToken(userID, role)
+	if err != nil {
+		return errors.New("failed to create access token", errors.ErrInternal)
+	}
+
+	middleware.SetAuthCookiesWithTTL(w, accessToken, h.cfg.CookieSecure, h.cfg.CookieDomain, h.cfg.AccessTokenTTL)
+	middleware.SetRefreshCookie(w, issued.Token, issued.ExpiresAt, h.cfg.CookieSecure, h.cfg.CookieDomain)
+	return nil
+}
+
+// Refresh rotates the presented refresh token and returns a fresh access token.
+// The refresh token is read from the refresh_token cookie or the JSON body.
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rawToken, fromBody := readToken(r)
+
+	// Everything that can fail for transient reasons happens before the rotation is
+	// committed: a client that never receives the rotated token would present the old
+	// one next time, which counts as reuse and revokes the whole family.
+	userID, err := h.service.Owner(ctx, rawToken)
+	if err != nil {
+		h.rejectRefresh(w, err)
+		return
+	}
+
+	role, err := h.cfg.ResolveRole(ctx, userID)
+	if err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to resolve role for refresh", "userID", userID, "error", err)
+		jsonResponse.SendAutoErrorResponse(w, errors.New("failed to resolve user role", err))
+		return
+	}
+
+	accessToken, err := h.createAccessToken(userID, role)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, errors.New("failed to create access token", errors.ErrInternal))
+		return
+	}
+
+	issued, err := h.service.Rotate(ctx, rawToken, metadataFromRequest(r))
+	if err != nil {
+		h.rejectRefresh(w, err)
+		return
+	}
+
+	middleware.SetAuthCookiesWithTTL(w, accessToken, h.cfg.CookieSecure, h.cfg.CookieDomain, h.cfg.AccessTokenTTL)
+
+	resp := TokenResponse{
+		AccessToken:      accessToken,
+		ExpiresAt:        time.Now().Add(h.cfg.AccessTokenTTL),
+		RefreshExpiresAt: issued.ExpiresAt,
+	}
+	if fromBody {
+		resp.RefreshToken = issued.Token
+	} else {
+		middleware.SetRefreshCookie(w, issued.Token, issued.ExpiresAt, h.cfg.CookieSecure, h.cfg.CookieDomain)
+	}
+
+	jsonResponse.JsonResponse(w, http.StatusOK, resp)
+}
+
+func (h *Handler) createAccessToken(userID uuid.UUID, role string) (string, error) {
+	opts := h.cfg.Token
+	opts.TTL = h.cfg.AccessTokenTTL
+	return jwt.CreateTokenWithClaims(&jwt.Claims{UserID: userID.String(), Role: role}, h.cfg.JWTSecret, opts)
+}
+
+// rejectRefresh responds to a failed lookup or rotation. The auth cookies are only
+// cleared if the token was refused, not on internal errors the client can retry.
+func (h *Handler) rejectRefresh(w http.ResponseWriter, err error) {
+	if stderrors.Is(err, errors.ErrUnauthorized) {
+		middleware.ClearAuthCookies(w, h.cfg.CookieSecure, h.cfg.CookieDomain)
+		middleware.ClearRefreshCookie(w, h.cfg.CookieSecure, h.cfg.CookieDomain)
+	}
+	jsonResponse.SendAutoErrorResponse(w, err)
+}
+
+// Logout revokes the presented refresh token's family and clears all auth cookies.
+// It always succeeds from the client's perspective so a stale token cannot block logout.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if rawToken, _ := readToken(r); rawToken != "" {
+		if err := h.service.Revoke(ctx, rawToken); err != nil {
+			middleware.GetLoggerFromContext(ctx).Warn("Failed to revoke refresh token on logout", "error", err)
+		}
+	}
+	h.revokeAccessToken(r)
+
+	middleware.ClearAuthCookies(w, h.cfg.CookieSecure, h.cfg.CookieDomain)
+	middleware.ClearRefreshCookie(w, h.cfg.CookieSecure, h.cfg.CookieDomain)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll revokes every refresh token of the authenticated user.
+// It must be mounted behind JWTAuthMiddleware.
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := middleware.GetAuthenticatedUserID(ctx)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	if err := h.service.RevokeAll(ctx, userID); err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	if h.cfg.Revocations != nil {
+		// Every access token of the user was issued at most AccessTokenTTL ago.
+		now := time.Now()
+		if err := h.cfg.Revocations.RevokeUser(ctx, userID.String(), now, now.Add(h.cfg.AccessTokenTTL)); err != nil {
+			middleware.GetLoggerFromContext(ctx).Error("Failed to revoke access tokens for user", "userID", userID, "error", err)
+			jsonResponse.SendAutoErrorResponse(w, errors.New("failed to revoke access tokens", errors.ErrInternal))
+			return
+		}
+	}
+
+	middleware.ClearAuthCookies(w, h.cfg.CookieSecure, h.cfg.CookieDomain)
+	middleware.ClearRefreshCookie(w, h.cfg.CookieSecure, h.cfg.CookieDomain)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAccessToken denylists the access token cookie of the request, if any.
+func (h *Handler) revokeAccessToken(r *http.Request) {
+	if h.cfg.Revocations == nil {
+		return
+	}
+	cookie, err := r.Cookie(middleware.JWTCookieName)
+	if err != nil || cookie.Value == "" {
+		return
+	}
+	claims, err := jwt.ParseToken(cookie.Value, h.cfg.JWTSecret)
+	if err != nil || claims.ID == "" {
+		return // Invalid or expired tokens are already unusable
+	}
+	if err := jwt.RevokeToken(r.Context(), h.cfg.Revocations, claims); err != nil {
+		middleware.GetLoggerFromContext(r.Context()).Warn("Failed to revoke access token on logout", "error", err)
+	}
+}
+
+// readToken returns the raw refresh token from the cookie, falling back to the JSON body.
+// The second return value reports whether the token came from the body.
+func readToken(r *http.Request) (string, bool) {
+	if cookie, err := r.Cookie(middleware.RefreshCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, false
+	}
+	if r.Body == nil || r.ContentLength == 0 {
+		return "", false
+	}
+	var body tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return "", false
+	}
+	return body.RefreshToken, body.RefreshToken != ""
+}
+
+func metadataFromRequest(r *http.Request) Metadata {
+	return Metadata{
+		UserAgent: r.UserAgent(),
+		IP:        middleware.ClientIP(r),
+	}
+}
@@ -0,0 +1,236 @@
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/config"
+	"github.com/shashtag-ventures/go-common/jwt"
+	"github.com/shashtag-ventures/go-common/jwt/revocation"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshHandler(t *testing.T) {
+	ctx := context.Background()
+	secret := "test-secret"
+	userID := uuid.New()
+
+	svc := NewService(newMemoryStorage(), Config{})
+	h := NewHandler(svc, HandlerConfig{
+		JWTSecret: secret,
+		ResolveRole: func(_ context.Context, _ uuid.UUID) (string, error) {
+			return "member", nil
+		},
+	})
+
+	t.Run("Login sets access and refresh cookies", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		rr := httptest.NewRecorder()
+
+		require.NoError(t, h.Login(rr, req, userID, "member"))
+
+		cookies := rr.Result().Cookies()
+		assert.NotNil(t, testutil.FindCookie(cookies, middleware.JWTCookieName))
+		assert.NotNil(t, testutil.FindCookie(cookies, middleware.RefreshCookieName))
+	})
+
+	t.Run("Refresh via cookie rotates the cookie", func(t *testing.T) {
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: middleware.RefreshCookieName, Value: issued.Token})
+		rr := httptest.NewRecorder()
+
+		h.Refresh(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp TokenResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Empty(t, resp.RefreshToken)
+
+		claims, err := jwt.ParseToken(resp.AccessToken, secret)
+		require.NoError(t, err)
+		assert.Equal(t, userID.String(), claims.UserID)
+		assert.Equal(t, "member", claims.Role)
+
+		rotated := testutil.FindCookie(rr.Result().Cookies(), middleware.RefreshCookieName)
+		require.NotNil(t, rotated)
+		assert.NotEqual(t, issued.Token, rotated.Value)
+	})
+
+	t.Run("Refresh via body returns the new token in the body", func(t *testing.T) {
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+
+		body := strings.NewReader(`{"refresh_token": "` + issued.Token + `"}`)
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", body)
+		rr := httptest.NewRecorder()
+
+		h.Refresh(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp TokenResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.NotEmpty(t, resp.RefreshToken)
+		assert.NotEqual(t, issued.Token, resp.RefreshToken)
+	})
+
+	t.Run("Refresh with reused token returns 401", func(t *testing.T) {
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+		_, err = svc.Rotate(ctx, issued.Token, Metadata{})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: middleware.RefreshCookieName, Value: issued.Token})
+		rr := httptest.NewRecorder()
+
+		h.Refresh(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), "reuse detected")
+	})
+
+	t.Run("Role lookup failures do not consume the token", func(t *testing.T) {
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+		failing := NewHandler(svc, HandlerConfig{
+			JWTSecret:   secret,
+			ResolveRole: func(context.Context, uuid.UUID) (string, error) { return "", errors.New("db down") },
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: middleware.RefreshCookieName, Value: issued.Token})
+		rr := httptest.NewRecorder()
+		failing.Refresh(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Empty(t, rr.Result().Cookies(), "cookies are kept for the retry")
+
+		_, err = svc.Rotate(ctx, issued.Token, Metadata{})
+		assert.NoError(t, err, "the token can still be used")
+	})
+
+	t.Run("Access tokens carry the configured issuer and audience", func(t *testing.T) {
+		jwtCfg := config.JWTConfig{Secret: secret, Issuer: "auth-service", Audience: "deploy-api"}
+		issuing := NewHandler(svc, HandlerConfig{
+			JWTSecret:   secret,
+			Token:       jwtCfg.TokenOptions(),
+			ResolveRole: func(context.Context, uuid.UUID) (string, error) { return "member", nil },
+		})
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: middleware.RefreshCookieName, Value: issued.Token})
+		rr := httptest.NewRecorder()
+		issuing.Refresh(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp TokenResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		claims, err := jwt.ParseTokenWithClaims[jwt.Claims](resp.AccessToken, secret, jwtCfg.ParseOptions())
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(DefaultAccessTokenTTL), claims.ExpiresAt.Time, time.Minute)
+	})
+
+	t.Run("ResolveRole is required", func(t *testing.T) {
+		assert.Panics(t, func() { NewHandler(svc, HandlerConfig{JWTSecret: secret}) })
+	})
+
+	t.Run("Refresh without token returns 401", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		rr := httptest.NewRecorder()
+
+		h.Refresh(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Logout revokes the family and clears cookies", func(t *testing.T) {
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.AddCookie(&http.Cookie{Name: middleware.RefreshCookieName, Value: issued.Token})
+		rr := httptest.NewRecorder()
+
+		h.Logout(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Len(t, rr.Result().Cookies(), 3)
+
+		_, err = svc.Rotate(ctx, issued.Token, Metadata{})
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("LogoutAll requires an authenticated user", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout-all", nil)
+		rr := httptest.NewRecorder()
+
+		h.LogoutAll(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("LogoutAll revokes every token of the user", func(t *testing.T) {
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout-all", nil)
+		user := &middleware.AuthenticatedUser{ID: userID.String()}
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, user))
+		rr := httptest.NewRecorder()
+
+		h.LogoutAll(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		_, err = svc.Rotate(ctx, issued.Token, Metadata{})
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Logout and LogoutAll deny access tokens when a store is configured", func(t *testing.T) {
+		store := revocation.NewMemoryStore()
+		rh := NewHandler(svc, HandlerConfig{
+			JWTSecret:   secret,
+			Revocations: store,
+			ResolveRole: func(_ context.Context, _ uuid.UUID) (string, error) { return "member", nil },
+		})
+
+		accessToken, err := jwt.CreateToken(userID.String(), "member", secret, time.Minute)
+		require.NoError(t, err)
+		claims, err := jwt.ParseToken(accessToken, secret)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.AddCookie(&http.Cookie{Name: middleware.JWTCookieName, Value: accessToken})
+		rh.Logout(httptest.NewRecorder(), req)
+
+		revoked, err := jwt.IsTokenRevoked(ctx, store, claims)
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		other := uuid.New()
+		otherToken, _ := jwt.CreateToken(other.String(), "member", secret, time.Minute)
+		otherClaims, _ := jwt.ParseToken(otherToken, secret)
+
+		req = httptest.NewRequest(http.MethodPost, "/auth/logout-all", nil)
+		user := &middleware.AuthenticatedUser{ID: other.String()}
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, user))
+		rh.LogoutAll(httptest.NewRecorder(), req)
+
+		revoked, err = jwt.IsTokenRevoked(ctx, store, otherClaims)
+		require.NoError(t, err)
+		assert.True(t, revoked)
+	})
+}
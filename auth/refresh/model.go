@@ -0,0 +1,29 @@
+package refresh
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/gormutil"
+)
+
+// RefreshToken is a single opaque refresh token. Only the SHA-256 hash of the token
+// is persisted; the raw value is handed to the client exactly once.
+// Tokens issued from one login share a FamilyID so that reuse of a rotated token
+// can revoke every descendant in one update.
+type RefreshToken struct {
+	gormutil.BaseModel
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;index"`
+	FamilyID  uuid.UUID  `json:"family_id" gorm:"type:uuid;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at"` // Set once the token has been exchanged for a successor
+	RevokedAt *time.Time `json:"revoked_at"` // Set when the family is revoked (logout or reuse)
+	UserAgent string     `json:"user_agent"`
+	IP        string     `json:"ip"`
+}
+
+// IsExpired reports whether the token is past its expiry at the given time.
+func (t *RefreshToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
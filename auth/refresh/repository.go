@@ -0,0 +1,77 @@
+package refresh
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/gormutil"
+	"gorm.io/gorm"
+)
+
+type tokenRepository struct {
+	db   *gorm.DB
+	repo *gormutil.Repository[RefreshToken]
+}
+
+// NewRepository creates a GORM-backed Storage for refresh tokens.
+func NewRepository(db *gorm.DB) Storage {
+	return &tokenRepository{
+		db:   db,
+		repo: gormutil.NewRepository[RefreshToken](db),
+	}
+}
+
+// conn returns the transaction in ctx, if any, otherwise the base connection.
+func (r *tokenRepository) conn(ctx context.Context) *gorm.DB {
+	if tx := gormutil.GetTransaction(ctx); tx != nil {
+		return tx.WithContext(ctx)
+	}
+	return r.db.WithContext(ctx)
+}
+
+func (r *tokenRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if gormutil.GetTransaction(ctx) != nil {
+		return fn(ctx)
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(gormutil.WithTransaction(ctx, tx))
+	})
+}
+
+func (r *tokenRepository) Create(ctx context.Context, token *RefreshToken) error {
+	return r.repo.Create(ctx, gormutil.GetTransaction(ctx), token)
+}
+
+func (r *tokenRepository) FindByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	return r.repo.FindOneBy(ctx, "token_hash = ?", hash)
+}
+
+func (r *tokenRepository) MarkRotated(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	// The rotated_at IS NULL guard makes this a compare-and-swap: only one
+	// concurrent refresh of the same token can flip it.
+	res := r.conn(ctx).Model(&RefreshToken{}).
+		Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", id).
+		Update("rotated_at", at)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *tokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error {
+	return r.conn(ctx).Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error
+}
+
+func (r *tokenRepository) RevokeUser(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	return r.conn(ctx).Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error
+}
+
+func (r *tokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	res := r.conn(ctx).Unscoped().Where("expires_at < ?", before).Delete(&RefreshToken{})
+	return res.RowsAffected, res.Error
+}
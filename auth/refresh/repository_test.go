@@ -0,0 +1,108 @@
+package refresh_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/auth/refresh"
+	"github.com/shashtag-ventures/go-common/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokenRepository(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	ctx := context.Background()
+	db, teardown := testutil.SetupTestDatabase(ctx)
+	defer teardown()
+
+	require.NoError(t, db.AutoMigrate(&refresh.RefreshToken{}))
+
+	repo := refresh.NewRepository(db)
+	userID := uuid.New()
+	familyID := uuid.New()
+
+	newToken := func(hash string) *refresh.RefreshToken {
+		return &refresh.RefreshToken{
+			UserID:    userID,
+			FamilyID:  familyID,
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	}
+
+	t.Run("Create and FindByHash", func(t *testing.T) {
+		testutil.CleanTables(db, "refresh_tokens")
+
+		require.NoError(t, repo.Create(ctx, newToken("hash-1")))
+
+		found, err := repo.FindByHash(ctx, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, userID, found.UserID)
+	})
+
+	t.Run("MarkRotated only succeeds once", func(t *testing.T) {
+		testutil.CleanTables(db, "refresh_tokens")
+
+		token := newToken("hash-2")
+		require.NoError(t, repo.Create(ctx, token))
+
+		ok, err := repo.MarkRotated(ctx, token.ID, time.Now())
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = repo.MarkRotated(ctx, token.ID, time.Now())
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("Transaction rolls back MarkRotated", func(t *testing.T) {
+		testutil.CleanTables(db, "refresh_tokens")
+
+		token := newToken("hash-5")
+		require.NoError(t, repo.Create(ctx, token))
+
+		err := repo.Transaction(ctx, func(ctx context.Context) error {
+			ok, err := repo.MarkRotated(ctx, token.ID, time.Now())
+			require.NoError(t, err)
+			require.True(t, ok)
+			return errors.New("create failed")
+		})
+		require.Error(t, err)
+
+		found, err := repo.FindByHash(ctx, "hash-5")
+		require.NoError(t, err)
+		assert.Nil(t, found.RotatedAt)
+	})
+
+	t.Run("RevokeFamily", func(t *testing.T) {
+		testutil.CleanTables(db, "refresh_tokens")
+
+		require.NoError(t, repo.Create(ctx, newToken("hash-3")))
+		require.NoError(t, repo.Create(ctx, newToken("hash-4")))
+		require.NoError(t, repo.RevokeFamily(ctx, familyID, time.Now()))
+
+		found, err := repo.FindByHash(ctx, "hash-4")
+		require.NoError(t, err)
+		assert.NotNil(t, found.RevokedAt)
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		testutil.CleanTables(db, "refresh_tokens")
+
+		expired := newToken("hash-5")
+		expired.ExpiresAt = time.Now().Add(-time.Hour)
+		require.NoError(t, repo.Create(ctx, expired))
+		require.NoError(t, repo.Create(ctx, newToken("hash-6")))
+
+		n, err := repo.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+}
@@ -0,0 +1,239 @@
+package refresh
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultTTL is the lifetime of a refresh token when Config.TTL is not set.
+	DefaultTTL = 30 * 24 * time.Hour
+	// tokenBytes is the amount of entropy in a raw refresh token.
+	tokenBytes = 32
+)
+
+// Errors returned by the service. They wrap errors.ErrUnauthorized so that
+// jsonResponse.SendAutoErrorResponse maps them to 401.
+var (
+	ErrInvalidToken = errors.New("invalid refresh token", errors.ErrUnauthorized)
+	ErrExpiredToken = errors.New("refresh token expired", errors.ErrUnauthorized)
+	ErrTokenReused  = errors.New("refresh token reuse detected", errors.ErrUnauthorized)
+)
+
+// Config holds the settings for the refresh token service.
+type Config struct {
+	TTL time.Duration // Lifetime of each issued token; defaults to DefaultTTL
+}
+
+// Metadata describes the client a token is issued to. It is stored for auditing only.
+type Metadata struct {
+	UserAgent string
+	IP        string
+}
+
+// IssuedToken is the result of issuing or rotating a token.
+// Token is the raw value to hand to the client; it is never stored.
+type IssuedToken struct {
+	Token     string
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	ExpiresAt time.Time
+}
+
+// Service issues, rotates and revokes refresh tokens.
+type Service interface {
+	// Issue starts a new token family for the user, typically after login.
+	Issue(ctx context.Context, userID uuid.UUID, meta Metadata) (*IssuedToken, error)
+	// Rotate exchanges a raw token for a new one in the same family.
+	// Presenting an already-rotated token revokes the whole family and returns ErrTokenReused.
+	Rotate(ctx context.Context, rawToken string, meta Metadata) (*IssuedToken, error)
+	// Owner returns the user a raw token was issued to, without validating or rotating it.
+	Owner(ctx context.Context, rawToken string) (uuid.UUID, error)
+	// Revoke revokes the family the raw token belongs to (logout of one device).
+	Revoke(ctx context.Context, rawToken string) error
+	// RevokeAll revokes every token of the user (logout everywhere).
+	RevokeAll(ctx context.Context, userID uuid.UUID) error
+	// PurgeExpired hard-deletes tokens that expired before the given time.
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type refreshService struct {
+	db  Storage
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewService creates a new refresh token Service.
+func NewService(db Storage, cfg Config) Service {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &refreshService{
+		db:  db,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+func (s *refreshService) Issue(ctx context.Context, userID uuid.UUID, meta Metadata) (*IssuedToken, error) {
+	return s.create(ctx, userID, uuid.New(), meta)
+}
+
+func (s *refreshService) Rotate(ctx context.Context, rawToken string, meta Metadata) (*IssuedToken, error) {
+	logger := middleware.GetLoggerFromContext(ctx)
+	now := s.now()
+
+	current, err := s.lookup(ctx, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if current.RotatedAt != nil {
+		s.revokeFamilyOnReuse(ctx, current, now)
+		return nil, ErrTokenReused
+	}
+
+	if current.IsExpired(now) {
+		return nil, ErrExpiredToken
+	}
+
+	// Marking the token rotated and storing its successor commit together, so a failed
+	// insert leaves the token usable and the client's retry is not taken for reuse.
+	var issued *IssuedToken
+	err = s.db.Transaction(ctx, func(ctx context.Context) error {
+		ok, err := s.db.MarkRotated(ctx, current.ID, now)
+		if err != nil {
+			logger.Error("Failed to mark refresh token as rotated", "tokenID", current.ID, "error", err)
+			return errors.New("failed to rotate refresh token", errors.ErrInternal)
+		}
+		if !ok {
+			// Another request rotated (or revoked) this token between our read and write.
+			return ErrTokenReused
+		}
+		issued, err = s.create(ctx, current.UserID, current.FamilyID, meta)
+		return err
+	})
+	if err != nil {
+		if stderrors.Is(err, ErrTokenReused) {
+			s.revokeFamilyOnReuse(ctx, current, now)
+		}
+		return nil, err
+	}
+	return issued, nil
+}
+
+func (s *refreshService) Owner(ctx context.Context, rawToken string) (uuid.UUID, error) {
+	current, err := s.lookup(ctx, rawToken)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return current.UserID, nil
+}
+
+func (s *refreshService) Revoke(ctx context.Context, rawToken string) error {
+	current, err := s.lookup(ctx, rawToken)
+	if err != nil {
+		return err
+	}
+	if err := s.db.RevokeFamily(ctx, current.FamilyID, s.now()); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to revoke refresh token family", "familyID", current.FamilyID, "error", err)
+		return errors.New("failed to revoke refresh token", errors.ErrInternal)
+	}
+	return nil
+}
+
+func (s *refreshService) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	if err := s.db.RevokeUser(ctx, userID, s.now()); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to revoke refresh tokens for user", "userID", userID, "error", err)
+		return errors.New("failed to revoke refresh tokens", errors.ErrInternal)
+	}
+	return nil
+}
+
+func (s *refreshService) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	return s.db.DeleteExpired(ctx, before)
+}
+
+// create generates a new raw token, persists its hash and returns the raw value.
+func (s *refreshService) create(ctx context.Context, userID, familyID uuid.UUID, meta Metadata) (*IssuedToken, error) {
+	raw, err := generateToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	token := &RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(raw),
+		ExpiresAt: s.now().Add(s.ttl),
+		UserAgent: meta.UserAgent,
+		IP:        meta.IP,
+	}
+	if err := s.db.Create(ctx, token); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to store refresh token", "userID", userID, "error", err)
+		return nil, errors.New("failed to store refresh token", errors.ErrInternal)
+	}
+
+	return &IssuedToken{
+		Token:     raw,
+		UserID:    userID,
+		FamilyID:  familyID,
+		ExpiresAt: token.ExpiresAt,
+	}, nil
+}
+
+// lookup resolves a raw token to its stored record.
+func (s *refreshService) lookup(ctx context.Context, rawToken string) (*RefreshToken, error) {
+	if rawToken == "" {
+		return nil, ErrInvalidToken
+	}
+	token, err := s.db.FindByHash(ctx, HashToken(rawToken))
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, errors.New("failed to look up refresh token", errors.ErrInternal)
+	}
+	return token, nil
+}
+
+// revokeFamilyOnReuse revokes every token in the family of a replayed token.
+// A replayed rotated token means it has leaked, so neither holder can be trusted.
+func (s *refreshService) revokeFamilyOnReuse(ctx context.Context, token *RefreshToken, now time.Time) {
+	logger := middleware.GetLoggerFromContext(ctx)
+	logger.Warn("Refresh token reuse detected, revoking family", "userID", token.UserID, "familyID", token.FamilyID)
+	if err := s.db.RevokeFamily(ctx, token.FamilyID, now); err != nil {
+		logger.Error("Failed to revoke refresh token family", "familyID", token.FamilyID, "error", err)
+	}
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of a raw token as stored in the database.
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateToken returns a URL-safe random token.
+func generateToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
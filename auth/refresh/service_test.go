@@ -0,0 +1,231 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryStorage is an in-memory Storage used to exercise the service without a database.
+type memoryStorage struct {
+	mu        sync.Mutex
+	tokens    map[uuid.UUID]*RefreshToken
+	createErr error
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{tokens: make(map[uuid.UUID]*RefreshToken)}
+}
+
+// Transaction restores the tokens as they were if fn fails.
+func (m *memoryStorage) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.mu.Lock()
+	snapshot := make(map[uuid.UUID]RefreshToken, len(m.tokens))
+	for id, t := range m.tokens {
+		snapshot[id] = *t
+	}
+	m.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.tokens = make(map[uuid.UUID]*RefreshToken, len(snapshot))
+		for id, t := range snapshot {
+			m.tokens[id] = &t
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *memoryStorage) Create(_ context.Context, token *RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.createErr != nil {
+		return m.createErr
+	}
+	token.ID = uuid.New()
+	copied := *token
+	m.tokens[token.ID] = &copied
+	return nil
+}
+
+func (m *memoryStorage) FindByHash(_ context.Context, hash string) (*RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tokens {
+		if t.TokenHash == hash {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) MarkRotated(_ context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[id]
+	if !ok || t.RotatedAt != nil || t.RevokedAt != nil {
+		return false, nil
+	}
+	t.RotatedAt = &at
+	return true, nil
+}
+
+func (m *memoryStorage) RevokeFamily(_ context.Context, familyID uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *memoryStorage) RevokeUser(_ context.Context, userID uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *memoryStorage) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for id, t := range m.tokens {
+		if t.ExpiresAt.Before(before) {
+			delete(m.tokens, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestRefreshService(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("Issue stores only the hash", func(t *testing.T) {
+		store := newMemoryStorage()
+		svc := NewService(store, Config{TTL: time.Hour})
+
+		issued, err := svc.Issue(ctx, userID, Metadata{UserAgent: "test"})
+		require.NoError(t, err)
+		assert.NotEmpty(t, issued.Token)
+		assert.Equal(t, userID, issued.UserID)
+
+		stored, err := store.FindByHash(ctx, HashToken(issued.Token))
+		require.NoError(t, err)
+		assert.NotEqual(t, issued.Token, stored.TokenHash)
+		assert.Equal(t, "test", stored.UserAgent)
+	})
+
+	t.Run("Rotate issues a new token in the same family", func(t *testing.T) {
+		svc := NewService(newMemoryStorage(), Config{})
+
+		first, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+
+		second, err := svc.Rotate(ctx, first.Token, Metadata{})
+		require.NoError(t, err)
+		assert.NotEqual(t, first.Token, second.Token)
+		assert.Equal(t, first.FamilyID, second.FamilyID)
+
+		_, err = svc.Rotate(ctx, second.Token, Metadata{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Reuse of rotated token revokes the family", func(t *testing.T) {
+		svc := NewService(newMemoryStorage(), Config{})
+
+		first, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+		second, err := svc.Rotate(ctx, first.Token, Metadata{})
+		require.NoError(t, err)
+
+		_, err = svc.Rotate(ctx, first.Token, Metadata{})
+		assert.ErrorIs(t, err, ErrTokenReused)
+		assert.ErrorIs(t, err, customErrors.ErrUnauthorized)
+
+		// The legitimate successor is now revoked as well.
+		_, err = svc.Rotate(ctx, second.Token, Metadata{})
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Failed rotation leaves the token usable", func(t *testing.T) {
+		store := newMemoryStorage()
+		svc := NewService(store, Config{})
+
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+
+		store.createErr = errors.New("db down")
+		_, err = svc.Rotate(ctx, issued.Token, Metadata{})
+		assert.ErrorIs(t, err, customErrors.ErrInternal)
+
+		// The retry is not mistaken for reuse.
+		store.createErr = nil
+		_, err = svc.Rotate(ctx, issued.Token, Metadata{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Expired token is rejected", func(t *testing.T) {
+		svc := NewService(newMemoryStorage(), Config{TTL: time.Minute}).(*refreshService)
+
+		issued, err := svc.Issue(ctx, userID, Metadata{})
+		require.NoError(t, err)
+
+		svc.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		_, err = svc.Rotate(ctx, issued.Token, Metadata{})
+		assert.ErrorIs(t, err, ErrExpiredToken)
+	})
+
+	t.Run("Unknown token is rejected", func(t *testing.T) {
+		svc := NewService(newMemoryStorage(), Config{})
+
+		_, err := svc.Rotate(ctx, "does-not-exist", Metadata{})
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		_, err = svc.Rotate(ctx, "", Metadata{})
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Revoke and RevokeAll", func(t *testing.T) {
+		svc := NewService(newMemoryStorage(), Config{})
+
+		a, _ := svc.Issue(ctx, userID, Metadata{})
+		b, _ := svc.Issue(ctx, userID, Metadata{})
+
+		require.NoError(t, svc.Revoke(ctx, a.Token))
+		_, err := svc.Rotate(ctx, a.Token, Metadata{})
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		require.NoError(t, svc.RevokeAll(ctx, userID))
+		_, err = svc.Rotate(ctx, b.Token, Metadata{})
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("PurgeExpired", func(t *testing.T) {
+		svc := NewService(newMemoryStorage(), Config{TTL: time.Minute})
+		_, _ = svc.Issue(ctx, userID, Metadata{})
+
+		n, err := svc.PurgeExpired(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+}
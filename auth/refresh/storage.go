@@ -0,0 +1,22 @@
+package refresh
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Storage defines the persistence operations required by the refresh token service.
+type Storage interface {
+	// Transaction runs fn with a context carrying a database transaction.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	Create(ctx context.Context, token *RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// MarkRotated flags a token as used. It must only succeed for a token that has not
+	// been rotated yet and report false otherwise, so concurrent refreshes cannot both win.
+	MarkRotated(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+	RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error
+	RevokeUser(ctx context.Context, userID uuid.UUID, at time.Time) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,151 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// sweepInterval controls how often the memory store drops expired sessions.
+const sweepInterval = time.Minute
+
+// MemoryStore is an in-process Store. It is suitable for tests and single-instance
+// deployments; sessions are lost on restart.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	sessions  map[string][]byte // JSON, so callers never share state with the store
+	users     map[string]map[string]struct{}
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-memory session store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string][]byte),
+		users:    make(map[string]map[string]struct{}),
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryStore) Create(_ context.Context, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweepLocked()
+	m.sessions[s.ID] = data
+	if m.users[s.UserID] == nil {
+		m.users[s.UserID] = make(map[string]struct{})
+	}
+	m.users[s.UserID][s.ID] = struct{}{}
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.getLocked(id)
+}
+
+func (m *MemoryStore) Update(_ context.Context, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[s.ID]; ok {
+		m.sessions[s.ID] = data
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteLocked(id)
+	return nil
+}
+
+func (m *MemoryStore) ListByUser(_ context.Context, userID string) ([]*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []*Session
+	for id := range m.users[userID] {
+		s, err := m.getLocked(id)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MemoryStore) DeleteByUser(_ context.Context, userID string, exceptID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.users[userID] {
+		if id != exceptID {
+			m.deleteLocked(id)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) getLocked(id string) (*Session, error) {
+	data, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.IsExpired(m.now()) {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (m *MemoryStore) deleteLocked(id string) {
+	data, ok := m.sessions[id]
+	if !ok {
+		return
+	}
+	delete(m.sessions, id)
+
+	var s Session
+	if json.Unmarshal(data, &s) == nil {
+		delete(m.users[s.UserID], id)
+		if len(m.users[s.UserID]) == 0 {
+			delete(m.users, s.UserID)
+		}
+	}
+}
+
+// sweepLocked removes expired sessions at most once per sweepInterval.
+// The caller must hold the write lock.
+func (m *MemoryStore) sweepLocked() {
+	now := m.now()
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for id, data := range m.sessions {
+		var s Session
+		if json.Unmarshal(data, &s) != nil || s.IsExpired(now) {
+			m.deleteLocked(id)
+		}
+	}
+}
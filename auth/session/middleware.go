@@ -0,0 +1,62 @@
+package session
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+// MiddlewareConfig holds the configuration for the session middleware.
+type MiddlewareConfig struct {
+	// Optional lets requests without a valid session through without a user in context.
+	// Unlike JWT auth, a stale cookie is normal here (the session expired or was revoked),
+	// so it is cleared and the request continues anonymously.
+	Optional bool
+}
+
+// Middleware authenticates requests with the session cookie and stores the session's
+// user in the context as a middleware.AuthenticatedUser, so AuthorizeRole and friends
+// work unchanged. The session itself is available through FromContext.
+func Middleware(m *Manager, cfg MiddlewareConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := m.rawID(r)
+			if raw == "" {
+				if cfg.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				jsonResponse.SendErrorResponse(w, errors.New("missing session cookie", nil), http.StatusUnauthorized)
+				return
+			}
+
+			s, err := m.Load(r.Context(), raw)
+			if err != nil {
+				if !stderrors.Is(err, errors.ErrUnauthorized) {
+					jsonResponse.SendErrorResponse(w, errors.New("unable to verify session", nil), http.StatusServiceUnavailable)
+					return
+				}
+				m.clearCookie(w)
+				if cfg.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				jsonResponse.SendAutoErrorResponse(w, err)
+				return
+			}
+
+			user := s.User()
+			if state, ok := r.Context().Value(middleware.LogStateKey).(*middleware.LogState); ok {
+				state.SetUser(user.ID)
+			}
+
+			ctx := context.WithValue(r.Context(), middleware.UserContextKey, user)
+			ctx = context.WithValue(ctx, ContextKey, s)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
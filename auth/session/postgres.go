@@ -0,0 +1,74 @@
+package session
+
+import (
+	"context"
+	stderrors "errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostgresStore is a Store backed by the sessions table.
+// Run db.AutoMigrate(&session.Session{}) before use, and call DeleteExpired periodically.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore creates a Store that persists sessions via GORM.
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Create(ctx context.Context, sess *Session) error {
+	return s.db.WithContext(ctx).Create(sess).Error
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Session, error) {
+	var sess Session
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND expires_at > ?", id, time.Now()).
+		Take(&sess).Error
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *PostgresStore) Update(ctx context.Context, sess *Session) error {
+	// A plain UPDATE touches no rows once the session is deleted, so it cannot resurrect it.
+	return s.db.WithContext(ctx).Model(&Session{}).
+		Where("id = ?", sess.ID).
+		Select("*").Omit("id", "user_id", "created_at").
+		Updates(sess).Error
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Where("id = ?", id).Delete(&Session{}).Error
+}
+
+func (s *PostgresStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	var sessions []*Session
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (s *PostgresStore) DeleteByUser(ctx context.Context, userID string, exceptID string) error {
+	q := s.db.WithContext(ctx).Where("user_id = ?", userID)
+	if exceptID != "" {
+		q = q.Where("id <> ?", exceptID)
+	}
+	return q.Delete(&Session{}).Error
+}
+
+// DeleteExpired removes sessions that expired before the given time.
+func (s *PostgresStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	res := s.db.WithContext(ctx).Where("expires_at <= ?", before).Delete(&Session{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,170 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix is the key prefix used when none is configured.
+const DefaultRedisPrefix = "session:"
+
+// createScript stores a session and adds it to the user's index, whose TTL is kept at
+// least as long as the longest-lived session in it.
+var createScript = redis.NewScript(`
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("SADD", KEYS[2], ARGV[3])
+if redis.call("PTTL", KEYS[2]) < tonumber(ARGV[4]) then
+	redis.call("PEXPIRE", KEYS[2], ARGV[4])
+end
+return 1
+`)
+
+// RedisStore is a Store backed by Redis. Each session is a JSON value with a TTL at its
+// idle expiry; a set per user indexes the user's sessions for listing and revocation.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a Store using the given Redis client.
+// An empty prefix falls back to DefaultRedisPrefix.
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Create(ctx context.Context, sess *Session) error {
+	ttl := time.Until(sess.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	indexTTL := time.Until(sess.AbsoluteExpiresAt)
+	if indexTTL < ttl {
+		indexTTL = ttl
+	}
+	return createScript.Run(ctx, s.client,
+		[]string{s.sessionKey(sess.ID), s.userKey(sess.UserID)},
+		data, ttl.Milliseconds(), sess.ID, indexTTL.Milliseconds(),
+	).Err()
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := s.client.Get(ctx, s.sessionKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *RedisStore) Update(ctx context.Context, sess *Session) error {
+	ttl := time.Until(sess.ExpiresAt)
+	if ttl <= 0 {
+		return s.Delete(ctx, sess.ID)
+	}
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	// XX only overwrites an existing key, so a revoked session stays revoked.
+	return s.client.SetXX(ctx, s.sessionKey(sess.ID), data, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	sess, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, s.sessionKey(id))
+	if sess != nil {
+		pipe.SRem(ctx, s.userKey(sess.UserID), id)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	ids, err := s.client.SMembers(ctx, s.userKey(userID)).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.sessionKey(id)
+	}
+	vals, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	var stale []any
+	for i, val := range vals {
+		raw, ok := val.(string)
+		if !ok {
+			stale = append(stale, ids[i]) // Expired since it was indexed
+			continue
+		}
+		var sess Session
+		if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &sess)
+	}
+	if len(stale) > 0 {
+		s.client.SRem(ctx, s.userKey(userID), stale...)
+	}
+	return sessions, nil
+}
+
+func (s *RedisStore) DeleteByUser(ctx context.Context, userID string, exceptID string) error {
+	ids, err := s.client.SMembers(ctx, s.userKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	var members []any
+	for _, id := range ids {
+		if id == exceptID {
+			continue
+		}
+		keys = append(keys, s.sessionKey(id))
+		members = append(members, id)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, keys...)
+	pipe.SRem(ctx, s.userKey(userID), members...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) sessionKey(id string) string {
+	return s.prefix + "id:" + id
+}
+
+func (s *RedisStore) userKey(userID string) string {
+	return s.prefix + "user:" + userID
+}
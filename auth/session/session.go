@@ -0,0 +1,377 @@
+// Package session provides server-side sessions: the cookie carries only a random ID
+// and everything else lives in a Store, so sessions can hold arbitrary data and be
+// revoked instantly.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+const (
+	// DefaultCookieName is the session cookie name when Config.CookieName is not set.
+	DefaultCookieName = "session_id"
+	// DefaultIdleTimeout is how long a session survives without requests.
+	DefaultIdleTimeout = 24 * time.Hour
+	// DefaultAbsoluteTimeout caps the lifetime of a session however active it is.
+	DefaultAbsoluteTimeout = 30 * 24 * time.Hour
+	// DefaultTouchInterval limits how often activity is written back to the store.
+	DefaultTouchInterval = time.Minute
+	// idBytes is the amount of entropy in a raw session ID.
+	idBytes = 32
+)
+
+// ContextKey is the context key under which Middleware stores the current *Session.
+const ContextKey middleware.CtxKey = "session"
+
+// Errors returned by the Manager. The first two wrap errors.ErrUnauthorized so that
+// jsonResponse.SendAutoErrorResponse maps them to 401.
+var (
+	ErrInvalidSession = errors.New("invalid session", errors.ErrUnauthorized)
+	ErrExpiredSession = errors.New("session expired", errors.ErrUnauthorized)
+	ErrNotFound       = errors.New("session not found", errors.ErrNotFound)
+)
+
+// Session is a server-side session. ID is the SHA-256 hash of the raw ID held in the
+// cookie, so it is safe to show to the user (e.g. in a list of signed-in devices) and a
+// leaked store does not expose usable session IDs.
+type Session struct {
+	ID       string   `json:"id" gorm:"primaryKey"`
+	UserID   string   `json:"user_id" gorm:"index"`
+	Email    string   `json:"email"`
+	Role     string   `json:"role"`
+	Scopes   []string `json:"scopes" gorm:"type:jsonb;serializer:json"`
+	TenantID string   `json:"tenant_id"`
+	// Data holds application state. It is stored as JSON, so numbers come back as
+	// float64 and structs as maps.
+	Data map[string]any `json:"data" gorm:"type:jsonb;serializer:json"`
+
+	UserAgent         string    `json:"user_agent"`
+	IP                string    `json:"ip"`
+	CreatedAt         time.Time `json:"created_at"`
+	LastSeenAt        time.Time `json:"last_seen_at"`
+	ExpiresAt         time.Time `json:"expires_at" gorm:"index"` // Idle expiry, extended on activity
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+}
+
+// TableName overrides the default table name.
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsExpired reports whether the session is past its expiry at the given time.
+func (s *Session) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// User returns the session's user as a middleware.AuthenticatedUser.
+func (s *Session) User() *middleware.AuthenticatedUser {
+	return &middleware.AuthenticatedUser{
+		ID:        s.UserID,
+		Email:     s.Email,
+		Role:      s.Role,
+		Scopes:    s.Scopes,
+		TenantID:  s.TenantID,
+		SessionID: s.ID,
+	}
+}
+
+// Store persists sessions, keyed by Session.ID.
+type Store interface {
+	Create(ctx context.Context, s *Session) error
+	// Get returns nil, nil if the session does not exist or has expired.
+	Get(ctx context.Context, id string) (*Session, error)
+	// Update replaces a session. It must do nothing if the session no longer exists,
+	// so that a request still in flight cannot bring back a revoked session.
+	Update(ctx context.Context, s *Session) error
+	Delete(ctx context.Context, id string) error
+	// ListByUser returns the user's unexpired sessions in any order.
+	ListByUser(ctx context.Context, userID string) ([]*Session, error)
+	// DeleteByUser deletes every session of the user except exceptID, which may be empty.
+	DeleteByUser(ctx context.Context, userID string, exceptID string) error
+}
+
+// Config holds the settings for the session Manager.
+type Config struct {
+	Store Store
+	// IdleTimeout defaults to DefaultIdleTimeout. Each request extends the session by
+	// this much, up to AbsoluteTimeout after login.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout defaults to DefaultAbsoluteTimeout.
+	AbsoluteTimeout time.Duration
+	// TouchInterval defaults to DefaultTouchInterval. Requests within this interval of
+	// the last write do not extend the session again, to save store writes.
+	TouchInterval time.Duration
+
+	CookieName   string // Defaults to DefaultCookieName
+	CookieDomain string
+	CookieSecure bool
+	// CookieSameSite defaults to http.SameSiteLaxMode.
+	CookieSameSite http.SameSite
+}
+
+// Manager creates, loads and revokes sessions and manages the session cookie.
+type Manager struct {
+	store Store
+	cfg   Config
+	now   func() time.Time
+}
+
+// NewManager creates a session Manager. It panics if no Store is configured.
+func NewManager(cfg Config) *Manager {
+	if cfg.Store == nil {
+		panic("session: Config.Store is required")
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	if cfg.AbsoluteTimeout <= 0 {
+		cfg.AbsoluteTimeout = DefaultAbsoluteTimeout
+	}
+	if cfg.TouchInterval <= 0 {
+		cfg.TouchInterval = DefaultTouchInterval
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = DefaultCookieName
+	}
+	if cfg.CookieSameSite == 0 {
+		cfg.CookieSameSite = http.SameSiteLaxMode
+	}
+	return &Manager{store: cfg.Store, cfg: cfg, now: time.Now}
+}
+
+// CookieName returns the name of the session cookie.
+func (m *Manager) CookieName() string {
+	return m.cfg.CookieName
+}
+
+// Login starts a new session for user and sets the session cookie. Any session the
+// request already carries is destroyed first, so a session ID planted before login
+// (session fixation) is never promoted to an authenticated one.
+func (m *Manager) Login(w http.ResponseWriter, r *http.Request, user *middleware.AuthenticatedUser, data map[string]any) (*Session, error) {
+	ctx := r.Context()
+	if raw := m.rawID(r); raw != "" {
+		if err := m.store.Delete(ctx, HashID(raw)); err != nil {
+			middleware.GetLoggerFromContext(ctx).Warn("Failed to delete previous session on login", "error", err)
+		}
+	}
+
+	now := m.now()
+	s := &Session{
+		UserID:            user.ID,
+		Email:             user.Email,
+		Role:              user.Role,
+		Scopes:            user.Scopes,
+		TenantID:          user.TenantID,
+		Data:              data,
+		UserAgent:         r.UserAgent(),
+		IP:                middleware.ClientIP(r),
+		CreatedAt:         now,
+		AbsoluteExpiresAt: now.Add(m.cfg.AbsoluteTimeout),
+	}
+	return s, m.issue(ctx, w, s)
+}
+
+// Rotate replaces the current session with an identical one under a new ID, e.g. after
+// a privilege change. It returns ErrInvalidSession if the request has no valid session.
+func (m *Manager) Rotate(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	ctx := r.Context()
+	current, err := m.Load(ctx, m.rawID(r))
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.Delete(ctx, current.ID); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to delete rotated session", "error", err)
+		return nil, errors.New("failed to rotate session", errors.ErrInternal)
+	}
+
+	next := *current
+	return &next, m.issue(ctx, w, &next)
+}
+
+// Logout deletes the request's session, if any, and clears the cookie.
+func (m *Manager) Logout(w http.ResponseWriter, r *http.Request) error {
+	m.clearCookie(w)
+	raw := m.rawID(r)
+	if raw == "" {
+		return nil
+	}
+	if err := m.store.Delete(r.Context(), HashID(raw)); err != nil {
+		middleware.GetLoggerFromContext(r.Context()).Error("Failed to delete session on logout", "error", err)
+		return errors.New("failed to log out", errors.ErrInternal)
+	}
+	return nil
+}
+
+// Load resolves a raw session ID from the cookie and extends the session's idle expiry.
+func (m *Manager) Load(ctx context.Context, rawID string) (*Session, error) {
+	if rawID == "" {
+		return nil, ErrInvalidSession
+	}
+	s, err := m.store.Get(ctx, HashID(rawID))
+	if err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to look up session", "error", err)
+		return nil, errors.New("failed to look up session", errors.ErrInternal)
+	}
+	if s == nil {
+		return nil, ErrInvalidSession
+	}
+
+	now := m.now()
+	if s.IsExpired(now) {
+		return nil, ErrExpiredSession
+	}
+	if now.Sub(s.LastSeenAt) >= m.cfg.TouchInterval {
+		m.extend(s, now)
+		if err := m.store.Update(ctx, s); err != nil {
+			// The session is still valid; only the extension is lost.
+			middleware.GetLoggerFromContext(ctx).Warn("Failed to extend session", "error", err)
+		}
+	}
+	return s, nil
+}
+
+// Save persists changes to s.Data. It does nothing if the session has been revoked.
+func (m *Manager) Save(ctx context.Context, s *Session) error {
+	if err := m.store.Update(ctx, s); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to save session", "error", err)
+		return errors.New("failed to save session", errors.ErrInternal)
+	}
+	return nil
+}
+
+// ListUserSessions returns the user's active sessions, most recently used first.
+func (m *Manager) ListUserSessions(ctx context.Context, userID string) ([]*Session, error) {
+	sessions, err := m.store.ListByUser(ctx, userID)
+	if err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to list sessions", "userID", userID, "error", err)
+		return nil, errors.New("failed to list sessions", errors.ErrInternal)
+	}
+
+	now := m.now()
+	active := sessions[:0]
+	for _, s := range sessions {
+		if !s.IsExpired(now) {
+			active = append(active, s)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].LastSeenAt.After(active[j].LastSeenAt)
+	})
+	return active, nil
+}
+
+// Revoke deletes one of the user's sessions by its public ID. It returns ErrNotFound if
+// the session does not exist or belongs to someone else.
+func (m *Manager) Revoke(ctx context.Context, userID, sessionID string) error {
+	s, err := m.store.Get(ctx, sessionID)
+	if err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to look up session", "error", err)
+		return errors.New("failed to look up session", errors.ErrInternal)
+	}
+	if s == nil || s.UserID != userID {
+		return ErrNotFound
+	}
+	if err := m.store.Delete(ctx, sessionID); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to revoke session", "userID", userID, "error", err)
+		return errors.New("failed to revoke session", errors.ErrInternal)
+	}
+	return nil
+}
+
+// RevokeAll deletes every session of the user except exceptID, typically the caller's
+// own session ("sign out other devices"). Pass "" to sign out everywhere.
+func (m *Manager) RevokeAll(ctx context.Context, userID, exceptID string) error {
+	if err := m.store.DeleteByUser(ctx, userID, exceptID); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to revoke sessions for user", "userID", userID, "error", err)
+		return errors.New("failed to revoke sessions", errors.ErrInternal)
+	}
+	return nil
+}
+
+// FromContext returns the session stored by Middleware, or nil.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(ContextKey).(*Session)
+	return s
+}
+
+// HashID derives the stored session ID from the raw ID held in the cookie.
+func HashID(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// issue generates a new ID for s, stores it and sets the cookie.
+func (m *Manager) issue(ctx context.Context, w http.ResponseWriter, s *Session) error {
+	raw, err := generateID()
+	if err != nil {
+		return errors.New("failed to generate session id", errors.ErrInternal)
+	}
+	s.ID = HashID(raw)
+	m.extend(s, m.now())
+
+	if err := m.store.Create(ctx, s); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to store session", "userID", s.UserID, "error", err)
+		return errors.New("failed to store session", errors.ErrInternal)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cfg.CookieName,
+		Value:    raw,
+		Path:     "/",
+		Domain:   m.cfg.CookieDomain,
+		Expires:  s.AbsoluteExpiresAt,
+		HttpOnly: true,
+		Secure:   m.cfg.CookieSecure,
+		SameSite: m.cfg.CookieSameSite,
+	})
+	return nil
+}
+
+// extend moves the idle expiry forward from now, capped at the absolute expiry.
+func (m *Manager) extend(s *Session, now time.Time) {
+	s.LastSeenAt = now
+	s.ExpiresAt = now.Add(m.cfg.IdleTimeout)
+	if s.ExpiresAt.After(s.AbsoluteExpiresAt) {
+		s.ExpiresAt = s.AbsoluteExpiresAt
+	}
+}
+
+func (m *Manager) clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cfg.CookieName,
+		Value:    "",
+		Path:     "/",
+		Domain:   m.cfg.CookieDomain,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   m.cfg.CookieSecure,
+		SameSite: m.cfg.CookieSameSite,
+	})
+}
+
+func (m *Manager) rawID(r *http.Request) string {
+	cookie, err := r.Cookie(m.cfg.CookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// generateID returns a random URL-safe session ID.
+func generateID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,315 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSession(id, userID string, expiresIn time.Duration) *Session {
+	now := time.Now().Truncate(time.Millisecond)
+	return &Session{
+		ID:                id,
+		UserID:            userID,
+		Role:              "member",
+		Scopes:            []string{"read"},
+		Data:              map[string]any{"cart": "c-1"},
+		CreatedAt:         now,
+		LastSeenAt:        now,
+		ExpiresAt:         now.Add(expiresIn),
+		AbsoluteExpiresAt: now.Add(time.Hour),
+	}
+}
+
+func runStoreTests(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	t.Run("Create and Get", func(t *testing.T) {
+		require.NoError(t, store.Create(ctx, newTestSession("s1", "u1", time.Hour)))
+
+		s, err := store.Get(ctx, "s1")
+		require.NoError(t, err)
+		require.NotNil(t, s)
+		assert.Equal(t, "u1", s.UserID)
+		assert.Equal(t, []string{"read"}, s.Scopes)
+		assert.Equal(t, "c-1", s.Data["cart"])
+
+		missing, err := store.Get(ctx, "nope")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("Expired sessions are not returned", func(t *testing.T) {
+		require.NoError(t, store.Create(ctx, newTestSession("s-expired", "u1", -time.Second)))
+
+		s, err := store.Get(ctx, "s-expired")
+		require.NoError(t, err)
+		assert.Nil(t, s)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		s, err := store.Get(ctx, "s1")
+		require.NoError(t, err)
+		s.Data["cart"] = "c-2"
+		s.ExpiresAt = s.ExpiresAt.Add(time.Minute)
+		require.NoError(t, store.Update(ctx, s))
+
+		s, err = store.Get(ctx, "s1")
+		require.NoError(t, err)
+		assert.Equal(t, "c-2", s.Data["cart"])
+	})
+
+	t.Run("Update does not resurrect deleted sessions", func(t *testing.T) {
+		s := newTestSession("s-deleted", "u1", time.Hour)
+		require.NoError(t, store.Create(ctx, s))
+		require.NoError(t, store.Delete(ctx, "s-deleted"))
+		require.NoError(t, store.Update(ctx, s))
+
+		got, err := store.Get(ctx, "s-deleted")
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("ListByUser and DeleteByUser", func(t *testing.T) {
+		require.NoError(t, store.Create(ctx, newTestSession("s2", "u1", time.Hour)))
+		require.NoError(t, store.Create(ctx, newTestSession("s3", "u1", time.Hour)))
+		require.NoError(t, store.Create(ctx, newTestSession("other", "u2", time.Hour)))
+
+		ids := func(userID string) []string {
+			sessions, err := store.ListByUser(ctx, userID)
+			require.NoError(t, err)
+			var ids []string
+			for _, s := range sessions {
+				ids = append(ids, s.ID)
+			}
+			return ids
+		}
+		assert.ElementsMatch(t, []string{"s1", "s2", "s3"}, ids("u1"))
+
+		require.NoError(t, store.DeleteByUser(ctx, "u1", "s2"))
+		assert.Equal(t, []string{"s2"}, ids("u1"))
+		assert.Equal(t, []string{"other"}, ids("u2"))
+
+		require.NoError(t, store.DeleteByUser(ctx, "u1", ""))
+		assert.Empty(t, ids("u1"))
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	runStoreTests(t, NewRedisStore(client, ""))
+}
+
+func TestPostgresStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	ctx := context.Background()
+	db, teardown := testutil.SetupTestDatabase(ctx)
+	defer teardown()
+
+	require.NoError(t, db.AutoMigrate(&Session{}))
+
+	store := NewPostgresStore(db)
+	runStoreTests(t, store)
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		require.NoError(t, store.Create(ctx, newTestSession("old", "u3", -time.Minute)))
+
+		n, err := store.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+}
+
+// testClock is a settable clock shared by the manager and the memory store.
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestManager(t *testing.T) (*Manager, *MemoryStore, *testClock) {
+	clock := &testClock{now: time.Now()}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	m := NewManager(Config{
+		Store:           store,
+		IdleTimeout:     time.Hour,
+		AbsoluteTimeout: 3 * time.Hour,
+	})
+	m.now = clock.Now
+	return m, store, clock
+}
+
+// login performs Login and returns the session cookie.
+func login(t *testing.T, m *Manager, existing *http.Cookie) (*Session, *http.Cookie) {
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	if existing != nil {
+		req.AddCookie(existing)
+	}
+	rr := httptest.NewRecorder()
+	s, err := m.Login(rr, req, &middleware.AuthenticatedUser{ID: "u1", Role: "admin"}, map[string]any{"theme": "dark"})
+	require.NoError(t, err)
+
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, HashID(cookies[0].Value), s.ID, "only the hash is stored")
+	return s, cookies[0]
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Login rotates the session ID", func(t *testing.T) {
+		m, _, _ := newTestManager(t)
+		_, first := login(t, m, nil)
+		_, second := login(t, m, first)
+		assert.NotEqual(t, first.Value, second.Value)
+
+		_, err := m.Load(ctx, first.Value)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+		_, err = m.Load(ctx, second.Value)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Rolling expiry up to the absolute timeout", func(t *testing.T) {
+		m, _, clock := newTestManager(t)
+		_, cookie := login(t, m, nil)
+
+		// Activity every 50 minutes keeps a one-hour idle session alive...
+		for i := 0; i < 3; i++ {
+			clock.now = clock.now.Add(50 * time.Minute)
+			_, err := m.Load(ctx, cookie.Value)
+			require.NoError(t, err, "iteration %d", i)
+		}
+		// ...but not past the absolute timeout.
+		clock.now = clock.now.Add(40 * time.Minute)
+		_, err := m.Load(ctx, cookie.Value)
+		assert.Error(t, err)
+	})
+
+	t.Run("Idle sessions expire", func(t *testing.T) {
+		m, _, clock := newTestManager(t)
+		_, cookie := login(t, m, nil)
+
+		clock.now = clock.now.Add(61 * time.Minute)
+		_, err := m.Load(ctx, cookie.Value)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+	})
+
+	t.Run("Rotate keeps the data", func(t *testing.T) {
+		m, _, _ := newTestManager(t)
+		original, cookie := login(t, m, nil)
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		rotated, err := m.Rotate(rr, req)
+		require.NoError(t, err)
+		assert.NotEqual(t, original.ID, rotated.ID)
+		assert.Equal(t, "dark", rotated.Data["theme"])
+		assert.True(t, original.AbsoluteExpiresAt.Equal(rotated.AbsoluteExpiresAt))
+
+		_, err = m.Load(ctx, cookie.Value)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+		_, err = m.Load(ctx, rr.Result().Cookies()[0].Value)
+		assert.NoError(t, err)
+	})
+
+	t.Run("List and revoke", func(t *testing.T) {
+		m, _, clock := newTestManager(t)
+		first, firstCookie := login(t, m, nil)
+		clock.now = clock.now.Add(time.Minute)
+		second, secondCookie := login(t, m, nil)
+		clock.now = clock.now.Add(time.Minute)
+		third, _ := login(t, m, nil)
+
+		sessions, err := m.ListUserSessions(ctx, "u1")
+		require.NoError(t, err)
+		require.Len(t, sessions, 3)
+		assert.Equal(t, third.ID, sessions[0].ID, "most recently used first")
+
+		assert.ErrorIs(t, m.Revoke(ctx, "someone-else", first.ID), ErrNotFound)
+		require.NoError(t, m.Revoke(ctx, "u1", first.ID))
+		_, err = m.Load(ctx, firstCookie.Value)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+
+		require.NoError(t, m.RevokeAll(ctx, "u1", second.ID))
+		sessions, err = m.ListUserSessions(ctx, "u1")
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		_, err = m.Load(ctx, secondCookie.Value)
+		assert.NoError(t, err)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	m, _, _ := newTestManager(t)
+	_, cookie := login(t, m, nil)
+
+	handler := func(cfg MiddlewareConfig) http.Handler {
+		return Middleware(m, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := r.Context().Value(middleware.UserContextKey).(*middleware.AuthenticatedUser)
+			s := FromContext(r.Context())
+			if user == nil || s == nil {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"id": user.ID, "role": user.Role, "session": user.SessionID, "theme": s.Data["theme"].(string)})
+		}))
+	}
+	serve := func(h http.Handler, c *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c != nil {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Valid session", func(t *testing.T) {
+		rr := serve(handler(MiddlewareConfig{}), cookie)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, "u1", body["id"])
+		assert.Equal(t, "admin", body["role"])
+		assert.Equal(t, HashID(cookie.Value), body["session"])
+		assert.Equal(t, "dark", body["theme"])
+	})
+
+	t.Run("Missing and invalid sessions", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve(handler(MiddlewareConfig{}), nil).Code)
+
+		stale := &http.Cookie{Name: DefaultCookieName, Value: "stale"}
+		rr := serve(handler(MiddlewareConfig{}), stale)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Len(t, rr.Result().Cookies(), 1)
+		assert.Empty(t, rr.Result().Cookies()[0].Value, "stale cookie is cleared")
+	})
+
+	t.Run("Optional", func(t *testing.T) {
+		stale := &http.Cookie{Name: DefaultCookieName, Value: "stale"}
+		assert.Equal(t, http.StatusNoContent, serve(handler(MiddlewareConfig{Optional: true}), stale).Code)
+		assert.Equal(t, http.StatusNoContent, serve(handler(MiddlewareConfig{Optional: true}), nil).Code)
+	})
+}
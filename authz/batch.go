@@ -0,0 +1,54 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/errors"
+)
+
+// BatchMembershipStore checks membership for many resources in one round-trip.
+// Implement it alongside MembershipStore to avoid N+1 queries in listing endpoints.
+type BatchMembershipStore interface {
+	// MembersOf returns the subset of resourceIDs the user is a member of.
+	MembersOf(ctx context.Context, userID uuid.UUID, resourceIDs []uuid.UUID) ([]uuid.UUID, error)
+}
+
+// FilterAccessible returns the resourceIDs the user is a member of, in their original order.
+// It uses a single MembersOf call when the store implements BatchMembershipStore and
+// falls back to one IsMember call per resource otherwise.
+func FilterAccessible(ctx context.Context, store MembershipStore, userID uuid.UUID, resourceIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(resourceIDs) == 0 {
+		return nil, nil
+	}
+
+	if batch, ok := store.(BatchMembershipStore); ok {
+		members, err := batch.MembersOf(ctx, userID, resourceIDs)
+		if err != nil {
+			return nil, errors.New("failed to verify membership", err)
+		}
+		allowed := make(map[uuid.UUID]struct{}, len(members))
+		for _, id := range members {
+			allowed[id] = struct{}{}
+		}
+		accessible := make([]uuid.UUID, 0, len(members))
+		for _, id := range resourceIDs {
+			if _, ok := allowed[id]; ok {
+				accessible = append(accessible, id)
+			}
+		}
+		return accessible, nil
+	}
+
+	var accessible []uuid.UUID
+	for _, id := range resourceIDs {
+		isMember, err := store.IsMember(ctx, id, userID)
+		if err != nil {
+			return nil, errors.New("failed to verify membership", err)
+		}
+		if isMember {
+			accessible = append(accessible, id)
+		}
+	}
+	return accessible, nil
+}
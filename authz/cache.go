@@ -0,0 +1,266 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+const (
+	// DefaultMembershipCacheTTL is used when MembershipCacheConfig.TTL is zero.
+	DefaultMembershipCacheTTL = 30 * time.Second
+	// defaultMembershipCacheSize bounds the number of cached answers.
+	defaultMembershipCacheSize = 10000
+)
+
+// membershipMemoKey is the context key for the per-request memo.
+const membershipMemoKey middleware.CtxKey = "membershipMemo"
+
+// MembershipCacheConfig holds the settings for CachedMembershipStore.
+type MembershipCacheConfig struct {
+	// TTL bounds how stale a cached answer may be. Zero uses DefaultMembershipCacheTTL;
+	// a negative value disables the shared cache, leaving only per-request memoization.
+	TTL time.Duration
+	// MaxEntries bounds memory use. Defaults to 10000.
+	MaxEntries int
+}
+
+type membershipKind uint8
+
+const (
+	kindMember membershipKind = iota
+	kindAdmin
+)
+
+type membershipKey struct {
+	kind       membershipKind
+	resourceID uuid.UUID
+	userID     uuid.UUID
+}
+
+type membershipEntry struct {
+	value     bool
+	expiresAt time.Time
+}
+
+// CachedMembershipStore decorates a MembershipStore with a short-lived shared cache and
+// per-request memoization (see MemoizeMembership). It also implements AdminMembershipStore
+// and BatchMembershipStore, delegating to the wrapped store when it supports them.
+//
+// Call Invalidate after changing a membership so the change is visible immediately.
+type CachedMembershipStore struct {
+	store      MembershipStore
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[membershipKey]membershipEntry
+}
+
+// NewCachedMembershipStore wraps store with a cache.
+func NewCachedMembershipStore(store MembershipStore, cfg MembershipCacheConfig) *CachedMembershipStore {
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultMembershipCacheTTL
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultMembershipCacheSize
+	}
+	return &CachedMembershipStore{
+		store:      store,
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		now:        time.Now,
+		entries:    make(map[membershipKey]membershipEntry),
+	}
+}
+
+// IsMember implements MembershipStore.
+func (c *CachedMembershipStore) IsMember(ctx context.Context, resourceID, userID uuid.UUID) (bool, error) {
+	return c.lookup(ctx, membershipKey{kindMember, resourceID, userID}, func() (bool, error) {
+		return c.store.IsMember(ctx, resourceID, userID)
+	})
+}
+
+// IsAdmin implements AdminMembershipStore. It fails if the wrapped store does not.
+func (c *CachedMembershipStore) IsAdmin(ctx context.Context, resourceID, userID uuid.UUID) (bool, error) {
+	admins, ok := c.store.(AdminMembershipStore)
+	if !ok {
+		return false, fmt.Errorf("authz: %T does not implement AdminMembershipStore", c.store)
+	}
+	return c.lookup(ctx, membershipKey{kindAdmin, resourceID, userID}, func() (bool, error) {
+		return admins.IsAdmin(ctx, resourceID, userID)
+	})
+}
+
+// MembersOf implements BatchMembershipStore. Only resources without a cached answer
+// are sent to the wrapped store, in a single batch when it supports one.
+func (c *CachedMembershipStore) MembersOf(ctx context.Context, userID uuid.UUID, resourceIDs []uuid.UUID) ([]uuid.UUID, error) {
+	memo := memoFromContext(ctx)
+
+	var members, misses []uuid.UUID
+	for _, id := range resourceIDs {
+		key := membershipKey{kindMember, id, userID}
+		if value, ok := c.cached(memo, key); ok {
+			if value {
+				members = append(members, id)
+			}
+			continue
+		}
+		misses = append(misses, id)
+	}
+	if len(misses) == 0 {
+		return members, nil
+	}
+
+	found, err := FilterAccessible(ctx, c.store, userID, misses)
+	if err != nil {
+		return nil, err
+	}
+	foundSet := make(map[uuid.UUID]struct{}, len(found))
+	for _, id := range found {
+		foundSet[id] = struct{}{}
+	}
+	for _, id := range misses {
+		_, isMember := foundSet[id]
+		c.remember(memo, membershipKey{kindMember, id, userID}, isMember)
+	}
+
+	return append(members, found...), nil
+}
+
+// Invalidate drops cached answers for one user on one resource.
+func (c *CachedMembershipStore) Invalidate(resourceID, userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, membershipKey{kindMember, resourceID, userID})
+	delete(c.entries, membershipKey{kindAdmin, resourceID, userID})
+}
+
+// InvalidateResource drops cached answers for every user of a resource, e.g. when it is deleted.
+func (c *CachedMembershipStore) InvalidateResource(resourceID uuid.UUID) {
+	c.invalidateWhere(func(k membershipKey) bool { return k.resourceID == resourceID })
+}
+
+// InvalidateUser drops cached answers for every resource of a user, e.g. when they are deactivated.
+func (c *CachedMembershipStore) InvalidateUser(userID uuid.UUID) {
+	c.invalidateWhere(func(k membershipKey) bool { return k.userID == userID })
+}
+
+func (c *CachedMembershipStore) invalidateWhere(match func(membershipKey) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if match(k) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func (c *CachedMembershipStore) lookup(ctx context.Context, key membershipKey, load func() (bool, error)) (bool, error) {
+	memo := memoFromContext(ctx)
+	if value, ok := c.cached(memo, key); ok {
+		return value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return false, err // Errors are never cached
+	}
+	c.remember(memo, key, value)
+	return value, nil
+}
+
+// cached returns the memoized or cached answer for key, if any.
+func (c *CachedMembershipStore) cached(memo *membershipMemo, key membershipKey) (bool, bool) {
+	if memo != nil {
+		if value, ok := memo.get(key); ok {
+			return value, true
+		}
+	}
+	if c.ttl < 0 {
+		return false, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || !c.now().Before(entry.expiresAt) {
+		return false, false
+	}
+	if memo != nil {
+		memo.set(key, entry.value)
+	}
+	return entry.value, true
+}
+
+// remember records an answer in the memo and the shared cache.
+func (c *CachedMembershipStore) remember(memo *membershipMemo, key membershipKey, value bool) {
+	if memo != nil {
+		memo.set(key, value)
+	}
+	if c.ttl < 0 {
+		return
+	}
+
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			c.entries = make(map[membershipKey]membershipEntry)
+		}
+	}
+	c.entries[key] = membershipEntry{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// membershipMemo holds membership answers for the lifetime of one request.
+type membershipMemo struct {
+	mu      sync.Mutex
+	entries map[membershipKey]bool
+}
+
+func (m *membershipMemo) get(key membershipKey) (bool, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.entries[key]
+	return value, ok
+}
+
+func (m *membershipMemo) set(key membershipKey, value bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = value
+}
+
+func memoFromContext(ctx context.Context) *membershipMemo {
+	memo, _ := ctx.Value(membershipMemoKey).(*membershipMemo)
+	return memo
+}
+
+// WithMembershipMemo returns a context in which CachedMembershipStore answers are
+// memoized, so repeated checks for the same resource cost nothing. Use it to scope
+// memoization to a worker task; HTTP requests can use MemoizeMembership instead.
+func WithMembershipMemo(ctx context.Context) context.Context {
+	if memoFromContext(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, membershipMemoKey, &membershipMemo{entries: make(map[membershipKey]bool)})
+}
+
+// MemoizeMembership is a middleware that memoizes membership answers for the duration of each request.
+func MemoizeMembership(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithMembershipMemo(r.Context())))
+	})
+}
@@ -0,0 +1,163 @@
+package authz_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/authz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore answers from fixed sets and counts the calls it receives.
+type countingStore struct {
+	members map[uuid.UUID]bool
+	calls   atomic.Int32
+	batches atomic.Int32
+	err     error
+}
+
+func (s *countingStore) IsMember(_ context.Context, resourceID, _ uuid.UUID) (bool, error) {
+	s.calls.Add(1)
+	return s.members[resourceID], s.err
+}
+
+func (s *countingStore) IsAdmin(_ context.Context, resourceID, _ uuid.UUID) (bool, error) {
+	s.calls.Add(1)
+	return false, s.err
+}
+
+// batchStore adds MembersOf to countingStore.
+type batchStore struct {
+	*countingStore
+}
+
+func (s batchStore) MembersOf(_ context.Context, _ uuid.UUID, ids []uuid.UUID) ([]uuid.UUID, error) {
+	s.batches.Add(1)
+	var members []uuid.UUID
+	for _, id := range ids {
+		if s.members[id] {
+			members = append(members, id)
+		}
+	}
+	return members, s.err
+}
+
+func TestFilterAccessible(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	userID := uuid.New()
+
+	t.Run("Uses a single batch call when supported", func(t *testing.T) {
+		store := batchStore{&countingStore{members: map[uuid.UUID]bool{a: true, c: true}}}
+
+		ids, err := authz.FilterAccessible(ctx, store, userID, []uuid.UUID{c, b, a})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{c, a}, ids)
+		assert.Equal(t, int32(1), store.batches.Load())
+		assert.Equal(t, int32(0), store.calls.Load())
+	})
+
+	t.Run("Falls back to IsMember", func(t *testing.T) {
+		store := &countingStore{members: map[uuid.UUID]bool{b: true}}
+
+		ids, err := authz.FilterAccessible(ctx, store, userID, []uuid.UUID{a, b})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{b}, ids)
+		assert.Equal(t, int32(2), store.calls.Load())
+	})
+}
+
+func TestCachedMembershipStore(t *testing.T) {
+	ctx := context.Background()
+	resourceID := uuid.New()
+	userID := uuid.New()
+
+	t.Run("Caches answers until invalidated", func(t *testing.T) {
+		inner := &countingStore{members: map[uuid.UUID]bool{resourceID: true}}
+		cache := authz.NewCachedMembershipStore(inner, authz.MembershipCacheConfig{})
+
+		for i := 0; i < 3; i++ {
+			ok, err := cache.IsMember(ctx, resourceID, userID)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		}
+		assert.Equal(t, int32(1), inner.calls.Load())
+
+		inner.members[resourceID] = false
+		cache.Invalidate(resourceID, userID)
+		ok, err := cache.IsMember(ctx, resourceID, userID)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, int32(2), inner.calls.Load())
+
+		cache.InvalidateUser(userID)
+		_, _ = cache.IsMember(ctx, resourceID, userID)
+		cache.InvalidateResource(resourceID)
+		_, _ = cache.IsMember(ctx, resourceID, userID)
+		assert.Equal(t, int32(4), inner.calls.Load())
+	})
+
+	t.Run("Errors are not cached", func(t *testing.T) {
+		inner := &countingStore{err: errors.New("db down")}
+		cache := authz.NewCachedMembershipStore(inner, authz.MembershipCacheConfig{})
+
+		_, err := cache.IsMember(ctx, resourceID, userID)
+		assert.Error(t, err)
+		_, err = cache.IsMember(ctx, resourceID, userID)
+		assert.Error(t, err)
+		assert.Equal(t, int32(2), inner.calls.Load())
+	})
+
+	t.Run("Per-request memoization without shared cache", func(t *testing.T) {
+		inner := &countingStore{members: map[uuid.UUID]bool{resourceID: true}}
+		cache := authz.NewCachedMembershipStore(inner, authz.MembershipCacheConfig{TTL: -1})
+
+		handler := authz.MemoizeMembership(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 3; i++ {
+				_, _ = cache.IsMember(r.Context(), resourceID, userID)
+			}
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, int32(1), inner.calls.Load())
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, int32(2), inner.calls.Load())
+	})
+
+	t.Run("MembersOf only fetches misses", func(t *testing.T) {
+		other := uuid.New()
+		inner := batchStore{&countingStore{members: map[uuid.UUID]bool{resourceID: true}}}
+		cache := authz.NewCachedMembershipStore(inner, authz.MembershipCacheConfig{})
+
+		_, err := cache.IsMember(ctx, resourceID, userID)
+		require.NoError(t, err)
+
+		ids, err := authz.FilterAccessible(ctx, cache, userID, []uuid.UUID{other, resourceID})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{resourceID}, ids)
+		assert.Equal(t, int32(1), inner.batches.Load())
+
+		_, err = cache.MembersOf(ctx, userID, []uuid.UUID{other, resourceID})
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), inner.batches.Load())
+	})
+
+	t.Run("IsAdmin requires an admin-capable store", func(t *testing.T) {
+		cache := authz.NewCachedMembershipStore(&memberOnlyStore{}, authz.MembershipCacheConfig{})
+		_, err := cache.IsAdmin(ctx, resourceID, userID)
+		assert.Error(t, err)
+	})
+}
+
+type memberOnlyStore struct{}
+
+func (memberOnlyStore) IsMember(context.Context, uuid.UUID, uuid.UUID) (bool, error) {
+	return true, nil
+}
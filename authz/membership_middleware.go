@@ -0,0 +1,111 @@
+package authz
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+// MembershipContextKey is the context key under which RequireMembership stores the verified Membership.
+const MembershipContextKey middleware.CtxKey = "membership"
+
+// Membership is the verified access of the authenticated user to the resource named in the path.
+type Membership struct {
+	ResourceID uuid.UUID
+	UserID     uuid.UUID
+	IsAdmin    bool // True when the check was made against an AdminMembershipStore
+}
+
+// MembershipConfig holds the configuration for RequireMembership.
+type MembershipConfig struct {
+	// PathParam is the wildcard name in the route pattern, e.g. "teamID" for "/teams/{teamID}".
+	PathParam string
+	// Store checks plain membership. Ignored when AdminStore is set.
+	Store MembershipStore
+	// AdminStore, when set, requires admin access instead of plain membership.
+	AdminStore AdminMembershipStore
+	// HideForbidden responds 404 instead of 403 so callers cannot tell which
+	// resources exist.
+	HideForbidden bool
+}
+
+// RequireMembership checks that the authenticated user is a member (or admin) of the
+// resource whose UUID is in the PathParam path value. The verified Membership is stored
+// in the context for handlers to read with GetMembershipFromContext.
+// It must run after JWTAuthMiddleware and on a route registered with the path wildcard.
+func RequireMembership(cfg MembershipConfig) func(http.Handler) http.Handler {
+	if cfg.PathParam == "" {
+		panic("authz: RequireMembership requires a PathParam")
+	}
+	if cfg.Store == nil && cfg.AdminStore == nil {
+		panic("authz: RequireMembership requires a Store or AdminStore")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			userID, err := middleware.GetAuthenticatedUserID(ctx)
+			if err != nil {
+				jsonResponse.SendErrorResponse(w, customErrors.New("unauthorized: user not found in context", nil), http.StatusUnauthorized)
+				return
+			}
+
+			// A malformed ID can never match a resource, so it is reported as not found.
+			resourceID, err := uuid.Parse(r.PathValue(cfg.PathParam))
+			if err != nil {
+				jsonResponse.SendErrorResponse(w, customErrors.New("resource not found", nil), http.StatusNotFound)
+				return
+			}
+
+			membership := &Membership{ResourceID: resourceID, UserID: userID}
+			if cfg.AdminStore != nil {
+				err = CheckAdminMembership(ctx, cfg.AdminStore, resourceID, userID)
+				membership.IsAdmin = err == nil
+			} else {
+				err = CheckMembership(ctx, cfg.Store, resourceID, userID)
+			}
+
+			if err != nil {
+				writeMembershipError(w, r, err, cfg.HideForbidden)
+				return
+			}
+
+			if state, ok := ctx.Value(middleware.LogStateKey).(*middleware.LogState); ok {
+				state.Set(cfg.PathParam, resourceID.String())
+			}
+
+			ctx = context.WithValue(ctx, MembershipContextKey, membership)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// writeMembershipError maps a failed membership check to a JSON response.
+func writeMembershipError(w http.ResponseWriter, r *http.Request, err error, hideForbidden bool) {
+	switch {
+	case stderrors.Is(err, customErrors.ErrForbidden):
+		if hideForbidden {
+			jsonResponse.SendErrorResponse(w, customErrors.New("resource not found", nil), http.StatusNotFound)
+			return
+		}
+		jsonResponse.SendErrorResponse(w, customErrors.New("forbidden: not a member of this resource", nil), http.StatusForbidden)
+	case stderrors.Is(err, customErrors.ErrNotFound):
+		jsonResponse.SendErrorResponse(w, customErrors.New("resource not found", nil), http.StatusNotFound)
+	default:
+		middleware.GetLoggerFromContext(r.Context()).Error("Membership check failed", "error", err)
+		jsonResponse.SendErrorResponse(w, fmt.Errorf("failed to verify membership"), http.StatusInternalServerError)
+	}
+}
+
+// GetMembershipFromContext returns the Membership stored by RequireMembership.
+func GetMembershipFromContext(ctx context.Context) (*Membership, bool) {
+	m, ok := ctx.Value(MembershipContextKey).(*Membership)
+	return m, ok
+}
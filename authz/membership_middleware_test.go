@@ -0,0 +1,109 @@
+package authz_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/authz"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMembershipStore struct {
+	members map[uuid.UUID]uuid.UUID
+	admins  map[uuid.UUID]uuid.UUID
+	err     error
+}
+
+func (s *fakeMembershipStore) IsMember(_ context.Context, resourceID, userID uuid.UUID) (bool, error) {
+	return s.members[resourceID] == userID, s.err
+}
+
+func (s *fakeMembershipStore) IsAdmin(_ context.Context, resourceID, userID uuid.UUID) (bool, error) {
+	return s.admins[resourceID] == userID, s.err
+}
+
+func TestRequireMembership(t *testing.T) {
+	userID := uuid.New()
+	teamID := uuid.New()
+	adminTeamID := uuid.New()
+	store := &fakeMembershipStore{
+		members: map[uuid.UUID]uuid.UUID{teamID: userID, adminTeamID: userID},
+		admins:  map[uuid.UUID]uuid.UUID{adminTeamID: userID},
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, ok := authz.GetMembershipFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		w.Header().Set("X-Resource-ID", m.ResourceID.String())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(cfg authz.MembershipConfig, path string, user *middleware.AuthenticatedUser) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		mux.Handle("GET /teams/{teamID}", authz.RequireMembership(cfg)(nextHandler))
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, user))
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	member := &middleware.AuthenticatedUser{ID: userID.String()}
+	stranger := &middleware.AuthenticatedUser{ID: uuid.NewString()}
+
+	t.Run("Member passes and membership is in context", func(t *testing.T) {
+		rr := serve(authz.MembershipConfig{PathParam: "teamID", Store: store}, "/teams/"+teamID.String(), member)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, teamID.String(), rr.Header().Get("X-Resource-ID"))
+	})
+
+	t.Run("Non-member gets 403", func(t *testing.T) {
+		rr := serve(authz.MembershipConfig{PathParam: "teamID", Store: store}, "/teams/"+teamID.String(), stranger)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Non-member gets 404 when forbidden is hidden", func(t *testing.T) {
+		rr := serve(authz.MembershipConfig{PathParam: "teamID", Store: store, HideForbidden: true}, "/teams/"+teamID.String(), stranger)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Contains(t, rr.Body.String(), "resource not found")
+	})
+
+	t.Run("Admin store requires admin", func(t *testing.T) {
+		cfg := authz.MembershipConfig{PathParam: "teamID", AdminStore: store}
+		assert.Equal(t, http.StatusForbidden, serve(cfg, "/teams/"+teamID.String(), member).Code)
+		assert.Equal(t, http.StatusOK, serve(cfg, "/teams/"+adminTeamID.String(), member).Code)
+	})
+
+	t.Run("Malformed ID gets 404", func(t *testing.T) {
+		rr := serve(authz.MembershipConfig{PathParam: "teamID", Store: store}, "/teams/not-a-uuid", member)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Missing user gets 401", func(t *testing.T) {
+		rr := serve(authz.MembershipConfig{PathParam: "teamID", Store: store}, "/teams/"+teamID.String(), nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Store errors", func(t *testing.T) {
+		notFound := &fakeMembershipStore{err: customErrors.ErrNotFound}
+		rr := serve(authz.MembershipConfig{PathParam: "teamID", Store: notFound}, "/teams/"+teamID.String(), member)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		broken := &fakeMembershipStore{err: errors.New("connection refused")}
+		rr = serve(authz.MembershipConfig{PathParam: "teamID", Store: broken}, "/teams/"+teamID.String(), member)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "connection refused")
+	})
+}
@@ -0,0 +1,46 @@
+package authz
+
+import (
+	"net/http"
+
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+// AuthorizePermission checks that the authenticated user holds every one of the
+// given permissions under the default policy. Unlike middleware.AuthorizeRole it
+// follows role inheritance and honours token scopes. Conditions are evaluated with a
+// nil resource; check resource-level access inside the handler with Can.
+func AuthorizePermission(perms ...string) func(http.Handler) http.Handler {
+	return authorizePermission(DefaultPolicy, perms)
+}
+
+// AuthorizePermission is like the package-level AuthorizePermission but checks against p.
+func (p *Policy) AuthorizePermission(perms ...string) func(http.Handler) http.Handler {
+	return authorizePermission(func() *Policy { return p }, perms)
+}
+
+// authorizePermission looks the policy up per request so that SetDefaultPolicy
+// takes effect for routes registered before it was called.
+func authorizePermission(policy func() *Policy, perms []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := middleware.GetUserFromContext(r.Context())
+			if !ok || user == nil {
+				jsonResponse.SendErrorResponse(w, customErrors.New("unauthorized: user not found in context", nil), http.StatusUnauthorized)
+				return
+			}
+
+			p := policy()
+			for _, perm := range perms {
+				if !p.Can(r.Context(), user, perm, nil) {
+					jsonResponse.SendErrorResponse(w, customErrors.New("forbidden: insufficient permissions", nil), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
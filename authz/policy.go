@@ -0,0 +1,246 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"gopkg.in/yaml.v3"
+)
+
+// Wildcard grants every permission, or every action of a resource when used as "project:*".
+const Wildcard = "*"
+
+// RoleConfig declares the permissions of a single role.
+type RoleConfig struct {
+	// Inherits lists roles whose permissions this role also receives,
+	// e.g. admin inherits member, member inherits viewer.
+	Inherits    []string `json:"inherits" yaml:"inherits"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+}
+
+// PolicyConfig is the declarative form of a Policy. It can be built in Go or
+// loaded from a JSON or YAML file with LoadPolicyFile:
+//
+//	roles:
+//	  viewer:
+//	    permissions: ["project:read"]
+//	  member:
+//	    inherits: ["viewer"]
+//	    permissions: ["project:write"]
+//	  admin:
+//	    inherits: ["member"]
+//	    permissions: ["*"]
+type PolicyConfig struct {
+	Roles map[string]RoleConfig `json:"roles" yaml:"roles"`
+}
+
+// Condition is an extra check for a permission that depends on the resource,
+// such as "members may only edit their own documents". It runs only after the
+// user's role has been granted the permission.
+type Condition func(ctx context.Context, user *middleware.AuthenticatedUser, resource any) bool
+
+// Policy maps roles to permissions with inheritance resolved. It is safe for
+// concurrent use once built.
+type Policy struct {
+	roles      map[string]map[string]struct{} // role -> effective permissions
+	ancestors  map[string]map[string]struct{} // role -> roles it includes, itself included
+	conditions map[string]Condition
+}
+
+// NewPolicy resolves role inheritance and returns a Policy.
+// It fails on references to undefined roles and on inheritance cycles.
+func NewPolicy(cfg PolicyConfig) (*Policy, error) {
+	p := &Policy{
+		roles:      make(map[string]map[string]struct{}, len(cfg.Roles)),
+		ancestors:  make(map[string]map[string]struct{}, len(cfg.Roles)),
+		conditions: make(map[string]Condition),
+	}
+
+	for role := range cfg.Roles {
+		if _, err := p.resolve(cfg, role, nil); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// resolve computes the included roles of role depth-first, memoizing the result.
+func (p *Policy) resolve(cfg PolicyConfig, role string, visiting []string) (map[string]struct{}, error) {
+	if included, ok := p.ancestors[role]; ok {
+		return included, nil
+	}
+	for _, v := range visiting {
+		if v == role {
+			return nil, fmt.Errorf("authz: role inheritance cycle: %s -> %s", strings.Join(visiting, " -> "), role)
+		}
+	}
+	rc, ok := cfg.Roles[role]
+	if !ok {
+		return nil, fmt.Errorf("authz: role %q is inherited but not defined", role)
+	}
+
+	included := map[string]struct{}{role: {}}
+	perms := make(map[string]struct{}, len(rc.Permissions))
+	for _, perm := range rc.Permissions {
+		perms[perm] = struct{}{}
+	}
+	for _, parent := range rc.Inherits {
+		parentIncluded, err := p.resolve(cfg, parent, append(visiting, role))
+		if err != nil {
+			return nil, err
+		}
+		for r := range parentIncluded {
+			included[r] = struct{}{}
+		}
+		for perm := range p.roles[parent] {
+			perms[perm] = struct{}{}
+		}
+	}
+
+	p.ancestors[role] = included
+	p.roles[role] = perms
+	return included, nil
+}
+
+// LoadPolicyFile reads a PolicyConfig from a .json, .yaml or .yml file and builds a Policy.
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("authz: failed to read policy file: %w", err)
+	}
+
+	var cfg PolicyConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		return nil, fmt.Errorf("authz: unsupported policy file extension %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authz: failed to parse policy file: %w", err)
+	}
+
+	return NewPolicy(cfg)
+}
+
+// WithCondition registers a resource condition for a permission and returns the policy.
+// Register conditions during setup, before the policy is used concurrently.
+func (p *Policy) WithCondition(perm string, cond Condition) *Policy {
+	p.conditions[perm] = cond
+	return p
+}
+
+// Permissions returns the effective, sorted permissions of a role.
+func (p *Policy) Permissions(role string) []string {
+	perms := make([]string, 0, len(p.roles[role]))
+	for perm := range p.roles[role] {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// Includes reports whether role is, or inherits from, other.
+// With admin ⊇ member ⊇ viewer, Includes("admin", "viewer") is true.
+func (p *Policy) Includes(role, other string) bool {
+	_, ok := p.ancestors[role][other]
+	return ok
+}
+
+// Can reports whether the user may perform perm on resource. The user's role must
+// grant the permission; if the user carries scopes (API keys, scoped tokens), one of
+// them must also cover it. resource may be nil when no condition is registered for perm.
+func (p *Policy) Can(ctx context.Context, user *middleware.AuthenticatedUser, perm string, resource any) bool {
+	if user == nil {
+		return false
+	}
+	if !matchAny(p.roles[user.Role], perm) {
+		return false
+	}
+	if len(user.Scopes) > 0 && !matchAny(toSet(user.Scopes), perm) {
+		return false
+	}
+	if cond, ok := p.conditions[perm]; ok {
+		return cond(ctx, user, resource)
+	}
+	return true
+}
+
+// Authorize is like Can but returns a wrapped errors.ErrForbidden when access is denied.
+func (p *Policy) Authorize(ctx context.Context, user *middleware.AuthenticatedUser, perm string, resource any) error {
+	if user == nil {
+		return errors.New("unauthorized: user not found in context", errors.ErrUnauthorized)
+	}
+	if !p.Can(ctx, user, perm, resource) {
+		return errors.New(fmt.Sprintf("forbidden: missing permission %s", perm), errors.ErrForbidden)
+	}
+	return nil
+}
+
+// matchAny reports whether any granted permission covers perm,
+// honouring "*" and "resource:*" wildcards.
+func matchAny(granted map[string]struct{}, perm string) bool {
+	if _, ok := granted[perm]; ok {
+		return true
+	}
+	if _, ok := granted[Wildcard]; ok {
+		return true
+	}
+	if resource, _, found := strings.Cut(perm, ":"); found {
+		if _, ok := granted[resource+":"+Wildcard]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+var defaultPolicy atomic.Pointer[Policy]
+
+func init() {
+	defaultPolicy.Store(&Policy{
+		roles:      map[string]map[string]struct{}{},
+		ancestors:  map[string]map[string]struct{}{},
+		conditions: map[string]Condition{},
+	})
+}
+
+// SetDefaultPolicy installs the policy used by the package-level Can, Authorize and
+// AuthorizePermission. Until it is called every permission check is denied.
+func SetDefaultPolicy(p *Policy) {
+	defaultPolicy.Store(p)
+}
+
+// DefaultPolicy returns the policy installed with SetDefaultPolicy.
+func DefaultPolicy() *Policy {
+	return defaultPolicy.Load()
+}
+
+// Can checks a permission against the default policy. It works equally in HTTP
+// handlers and worker tasks, as it only needs the user, not the request.
+func Can(ctx context.Context, user *middleware.AuthenticatedUser, perm string, resource any) bool {
+	return DefaultPolicy().Can(ctx, user, perm, resource)
+}
+
+// Authorize checks a permission against the default policy, returning a wrapped
+// errors.ErrForbidden when access is denied.
+func Authorize(ctx context.Context, user *middleware.AuthenticatedUser, perm string, resource any) error {
+	return DefaultPolicy().Authorize(ctx, user, perm, resource)
+}
@@ -0,0 +1,165 @@
+package authz_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shashtag-ventures/go-common/authz"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPolicyConfig() authz.PolicyConfig {
+	return authz.PolicyConfig{Roles: map[string]authz.RoleConfig{
+		"viewer": {Permissions: []string{"project:read"}},
+		"member": {Inherits: []string{"viewer"}, Permissions: []string{"project:write", "comment:*"}},
+		"admin":  {Inherits: []string{"member"}, Permissions: []string{"*"}},
+	}}
+}
+
+type document struct {
+	OwnerID string
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	policy, err := authz.NewPolicy(testPolicyConfig())
+	require.NoError(t, err)
+
+	viewer := &middleware.AuthenticatedUser{ID: "1", Role: "viewer"}
+	member := &middleware.AuthenticatedUser{ID: "2", Role: "member"}
+	admin := &middleware.AuthenticatedUser{ID: "3", Role: "admin"}
+
+	t.Run("Inheritance", func(t *testing.T) {
+		assert.True(t, policy.Can(ctx, viewer, "project:read", nil))
+		assert.False(t, policy.Can(ctx, viewer, "project:write", nil))
+		assert.True(t, policy.Can(ctx, member, "project:read", nil))
+		assert.True(t, policy.Can(ctx, member, "project:write", nil))
+		assert.True(t, policy.Can(ctx, admin, "billing:manage", nil))
+
+		assert.True(t, policy.Includes("admin", "viewer"))
+		assert.False(t, policy.Includes("viewer", "member"))
+		assert.Equal(t, []string{"comment:*", "project:read", "project:write"}, policy.Permissions("member"))
+	})
+
+	t.Run("Resource wildcard", func(t *testing.T) {
+		assert.True(t, policy.Can(ctx, member, "comment:delete", nil))
+		assert.False(t, policy.Can(ctx, viewer, "comment:delete", nil))
+	})
+
+	t.Run("Unknown role and nil user are denied", func(t *testing.T) {
+		assert.False(t, policy.Can(ctx, &middleware.AuthenticatedUser{Role: "ghost"}, "project:read", nil))
+		assert.False(t, policy.Can(ctx, nil, "project:read", nil))
+	})
+
+	t.Run("Scopes narrow the role", func(t *testing.T) {
+		scoped := &middleware.AuthenticatedUser{ID: "4", Role: "admin", Scopes: []string{"project:read"}}
+		assert.True(t, policy.Can(ctx, scoped, "project:read", nil))
+		assert.False(t, policy.Can(ctx, scoped, "project:write", nil))
+	})
+
+	t.Run("Conditions check the resource", func(t *testing.T) {
+		p, err := authz.NewPolicy(testPolicyConfig())
+		require.NoError(t, err)
+		p.WithCondition("project:write", func(_ context.Context, user *middleware.AuthenticatedUser, resource any) bool {
+			doc, ok := resource.(*document)
+			return ok && doc.OwnerID == user.ID
+		})
+
+		assert.True(t, p.Can(ctx, member, "project:write", &document{OwnerID: "2"}))
+		assert.False(t, p.Can(ctx, member, "project:write", &document{OwnerID: "9"}))
+	})
+
+	t.Run("Authorize returns typed errors", func(t *testing.T) {
+		assert.NoError(t, policy.Authorize(ctx, member, "project:write", nil))
+		assert.ErrorIs(t, policy.Authorize(ctx, viewer, "project:write", nil), customErrors.ErrForbidden)
+		assert.ErrorIs(t, policy.Authorize(ctx, nil, "project:write", nil), customErrors.ErrUnauthorized)
+	})
+
+	t.Run("Invalid configurations", func(t *testing.T) {
+		_, err := authz.NewPolicy(authz.PolicyConfig{Roles: map[string]authz.RoleConfig{
+			"a": {Inherits: []string{"b"}},
+			"b": {Inherits: []string{"a"}},
+		}})
+		assert.ErrorContains(t, err, "cycle")
+
+		_, err = authz.NewPolicy(authz.PolicyConfig{Roles: map[string]authz.RoleConfig{
+			"a": {Inherits: []string{"missing"}},
+		}})
+		assert.ErrorContains(t, err, "not defined")
+	})
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("YAML", func(t *testing.T) {
+		path := filepath.Join(dir, "policy.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+roles:
+  viewer:
+    permissions: ["project:read"]
+  member:
+    inherits: ["viewer"]
+    permissions: ["project:write"]
+`), 0o600))
+
+		policy, err := authz.LoadPolicyFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"project:read", "project:write"}, policy.Permissions("member"))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		path := filepath.Join(dir, "policy.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"roles": {"viewer": {"permissions": ["project:read"]}}}`), 0o600))
+
+		policy, err := authz.LoadPolicyFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"project:read"}, policy.Permissions("viewer"))
+	})
+
+	t.Run("Unsupported extension", func(t *testing.T) {
+		path := filepath.Join(dir, "policy.toml")
+		require.NoError(t, os.WriteFile(path, []byte(""), 0o600))
+
+		_, err := authz.LoadPolicyFile(path)
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthorizePermission(t *testing.T) {
+	policy, err := authz.NewPolicy(testPolicyConfig())
+	require.NoError(t, err)
+	authz.SetDefaultPolicy(policy)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(handler http.Handler, user *middleware.AuthenticatedUser) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, user))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	handler := authz.AuthorizePermission("project:read", "project:write")(nextHandler)
+
+	assert.Equal(t, http.StatusOK, serve(handler, &middleware.AuthenticatedUser{Role: "member"}))
+	assert.Equal(t, http.StatusForbidden, serve(handler, &middleware.AuthenticatedUser{Role: "viewer"}))
+	assert.Equal(t, http.StatusUnauthorized, serve(handler, nil))
+
+	assert.True(t, authz.Can(context.Background(), &middleware.AuthenticatedUser{Role: "admin"}, "project:delete", nil))
+
+	scoped := policy.AuthorizePermission("project:read")(nextHandler)
+	assert.Equal(t, http.StatusOK, serve(scoped, &middleware.AuthenticatedUser{Role: "viewer"}))
+}
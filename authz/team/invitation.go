@@ -0,0 +1,317 @@
+package team
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultInvitationTTL is how long an invitation stays valid when InvitationConfig.TTL is not set.
+	DefaultInvitationTTL = 7 * 24 * time.Hour
+	// invitationTokenBytes is the amount of entropy in a raw invitation token.
+	invitationTokenBytes = 32
+)
+
+// Errors returned by the invitation service.
+var (
+	ErrInvitationNotFound = errors.New("invitation not found", errors.ErrNotFound)
+	ErrInvitationInvalid  = errors.New("invitation is invalid or has already been used", errors.ErrNotFound)
+	ErrInvitationExpired  = errors.New("invitation has expired", errors.ErrInvalidInput)
+	ErrInvitationPending  = errors.New("an invitation for this email is already pending", errors.ErrAlreadyExists)
+	ErrInvitationEmail    = errors.New("invitation was sent to a different email address", errors.ErrForbidden)
+	ErrInvitationRole     = errors.New("cannot invite with a role above your own", errors.ErrForbidden)
+)
+
+// Notifier delivers invitations, e.g. by email. token is the raw single-use token
+// to embed in the accept link; it is not stored anywhere else.
+type Notifier interface {
+	SendInvitation(ctx context.Context, inv *Invitation, team *Team, token string) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface.
+type NotifierFunc func(ctx context.Context, inv *Invitation, team *Team, token string) error
+
+// SendInvitation calls f.
+func (f NotifierFunc) SendInvitation(ctx context.Context, inv *Invitation, team *Team, token string) error {
+	return f(ctx, inv, team, token)
+}
+
+// InvitationConfig holds the settings for the invitation service.
+type InvitationConfig struct {
+	TTL time.Duration // Defaults to DefaultInvitationTTL
+	// RequireEmailMatch only lets a user accept invitations sent to their own email.
+	RequireEmailMatch bool
+}
+
+// InviteParams holds the data needed to invite someone to a team.
+type InviteParams struct {
+	TeamID    uuid.UUID
+	Email     string
+	Role      Role
+	InvitedBy uuid.UUID
+	// InviterRole is the inviter's role in the team. Role may not outrank it, so only
+	// owners can invite owners. If empty, it is looked up from InvitedBy's membership.
+	InviterRole Role
+}
+
+// InvitationService creates, delivers and redeems team invitations.
+type InvitationService interface {
+	Invite(ctx context.Context, params InviteParams) (*Invitation, error)
+	ListPending(ctx context.Context, teamID uuid.UUID) ([]*Invitation, error)
+	// Resend issues a fresh token, which invalidates the previous one, and extends the expiry.
+	Resend(ctx context.Context, teamID, invitationID uuid.UUID) (*Invitation, error)
+	Revoke(ctx context.Context, teamID, invitationID uuid.UUID) error
+	// Accept redeems a raw token for the given user, creating the membership in the
+	// same transaction that marks the invitation as used.
+	Accept(ctx context.Context, rawToken string, userID uuid.UUID, email string) (*Member, error)
+}
+
+type invitationService struct {
+	db       Storage
+	notifier Notifier
+	cfg      InvitationConfig
+	now      func() time.Time
+}
+
+// NewInvitationService creates a new InvitationService.
+func NewInvitationService(db Storage, notifier Notifier, cfg InvitationConfig) InvitationService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultInvitationTTL
+	}
+	return &invitationService{db: db, notifier: notifier, cfg: cfg, now: time.Now}
+}
+
+func (s *invitationService) Invite(ctx context.Context, params InviteParams) (*Invitation, error) {
+	email := normalizeEmail(params.Email)
+	if email == "" {
+		return nil, errors.New("invitation requires an email", errors.ErrInvalidInput)
+	}
+	if !params.Role.IsValid() {
+		return nil, ErrInvalidRole
+	}
+
+	token, hash, err := newInvitationToken()
+	if err != nil {
+		return nil, errors.New("failed to generate invitation token", errors.ErrInternal)
+	}
+
+	now := s.now()
+	inv := &Invitation{
+		TeamID:    params.TeamID,
+		Email:     email,
+		Role:      params.Role,
+		TokenHash: hash,
+		InvitedBy: params.InvitedBy,
+		ExpiresAt: now.Add(s.cfg.TTL),
+	}
+
+	// Delivery happens inside the transaction so a failed send leaves no dangling invitation.
+	err = s.db.Transaction(ctx, func(ctx context.Context) error {
+		team, err := s.findTeam(ctx, params.TeamID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkInviterRole(ctx, params); err != nil {
+			return err
+		}
+		if _, err := s.db.FindPendingInvitation(ctx, params.TeamID, email, now); err == nil {
+			return ErrInvitationPending
+		} else if !stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return internalError(ctx, "failed to check pending invitations", err)
+		}
+		if err := s.db.CreateInvitation(ctx, inv); err != nil {
+			return internalError(ctx, "failed to create invitation", err)
+		}
+		return s.send(ctx, inv, team, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *invitationService) ListPending(ctx context.Context, teamID uuid.UUID) ([]*Invitation, error) {
+	invs, err := s.db.ListPendingInvitations(ctx, teamID, s.now())
+	if err != nil {
+		return nil, internalError(ctx, "failed to list invitations", err)
+	}
+	return invs, nil
+}
+
+func (s *invitationService) Resend(ctx context.Context, teamID, invitationID uuid.UUID) (*Invitation, error) {
+	token, hash, err := newInvitationToken()
+	if err != nil {
+		return nil, errors.New("failed to generate invitation token", errors.ErrInternal)
+	}
+
+	var inv *Invitation
+	err = s.db.Transaction(ctx, func(ctx context.Context) error {
+		inv, err = s.db.FindInvitation(ctx, teamID, invitationID)
+		if err != nil {
+			if stderrors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvitationNotFound
+			}
+			return internalError(ctx, "failed to load invitation", err)
+		}
+
+		expiresAt := s.now().Add(s.cfg.TTL)
+		ok, err := s.db.ReissueInvitation(ctx, inv.ID, hash, expiresAt)
+		if err != nil {
+			return internalError(ctx, "failed to reissue invitation", err)
+		}
+		if !ok {
+			return ErrInvitationNotFound // Accepted or revoked
+		}
+		inv.TokenHash = hash
+		inv.ExpiresAt = expiresAt
+
+		team, err := s.findTeam(ctx, teamID)
+		if err != nil {
+			return err
+		}
+		return s.send(ctx, inv, team, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *invitationService) Revoke(ctx context.Context, teamID, invitationID uuid.UUID) error {
+	ok, err := s.db.RevokeInvitation(ctx, teamID, invitationID, s.now())
+	if err != nil {
+		return internalError(ctx, "failed to revoke invitation", err)
+	}
+	if !ok {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+func (s *invitationService) Accept(ctx context.Context, rawToken string, userID uuid.UUID, email string) (*Member, error) {
+	if rawToken == "" {
+		return nil, ErrInvitationInvalid
+	}
+
+	var member *Member
+	err := s.db.Transaction(ctx, func(ctx context.Context) error {
+		inv, err := s.db.FindInvitationByHash(ctx, HashInvitationToken(rawToken))
+		if err != nil {
+			if stderrors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvitationInvalid
+			}
+			return internalError(ctx, "failed to load invitation", err)
+		}
+
+		now := s.now()
+		if inv.AcceptedAt != nil || inv.RevokedAt != nil {
+			return ErrInvitationInvalid
+		}
+		if !now.Before(inv.ExpiresAt) {
+			return ErrInvitationExpired
+		}
+		if s.cfg.RequireEmailMatch && normalizeEmail(email) != inv.Email {
+			return ErrInvitationEmail
+		}
+
+		ok, err := s.db.MarkInvitationAccepted(ctx, inv.ID, now)
+		if err != nil {
+			return internalError(ctx, "failed to accept invitation", err)
+		}
+		if !ok {
+			return ErrInvitationInvalid // Lost a race with another accept or a revoke
+		}
+
+		if isMember, err := s.db.IsMember(ctx, inv.TeamID, userID); err != nil {
+			return internalError(ctx, "failed to check membership", err)
+		} else if isMember {
+			return ErrAlreadyMember
+		}
+
+		member = &Member{TeamID: inv.TeamID, UserID: userID, Role: inv.Role}
+		if err := s.db.AddMember(ctx, member); err != nil {
+			return internalError(ctx, "failed to add team member", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *invitationService) send(ctx context.Context, inv *Invitation, team *Team, token string) error {
+	if s.notifier == nil {
+		return nil
+	}
+	if err := s.notifier.SendInvitation(ctx, inv, team, token); err != nil {
+		return internalError(ctx, "failed to send invitation", err)
+	}
+	return nil
+}
+
+func (s *invitationService) findTeam(ctx context.Context, teamID uuid.UUID) (*Team, error) {
+	team, err := s.db.FindTeam(ctx, teamID)
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, internalError(ctx, "failed to load team", err)
+	}
+	return team, nil
+}
+
+// checkInviterRole returns ErrInvitationRole if the invited role outranks the inviter's.
+func (s *invitationService) checkInviterRole(ctx context.Context, params InviteParams) error {
+	role := params.InviterRole
+	if role == "" {
+		inviter, err := s.db.FindMember(ctx, params.TeamID, params.InvitedBy)
+		if err != nil && !stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return internalError(ctx, "failed to load inviter", err)
+		}
+		if inviter != nil {
+			role = inviter.Role
+		}
+	}
+	if params.Role.rank() > role.rank() {
+		return ErrInvitationRole
+	}
+	return nil
+}
+
+// HashInvitationToken returns the hex-encoded SHA-256 hash of a raw token as stored in the database.
+func HashInvitationToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func newInvitationToken() (token, hash string, err error) {
+	b := make([]byte, invitationTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashInvitationToken(token), nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// internalError logs a storage error and hides it behind errors.ErrInternal.
+func internalError(ctx context.Context, msg string, err error) error {
+	middleware.GetLoggerFromContext(ctx).Error(msg, "error", err)
+	return errors.New(msg, errors.ErrInternal)
+}
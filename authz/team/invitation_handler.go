@@ -0,0 +1,199 @@
+package team
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/authz"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/request"
+)
+
+// Mux is satisfied by router.Router and http.ServeMux.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// InvitationHandlerConfig holds the configuration for the invitation handlers.
+type InvitationHandlerConfig struct {
+	// Authenticate authenticates every invitation route, e.g. middleware.JWTAuthMiddleware(secret).
+	Authenticate func(http.Handler) http.Handler
+	// Admins restricts managing invitations to team admins. Usually the team Storage.
+	Admins authz.AdminMembershipStore
+	// HideForbidden responds 404 instead of 403 to non-admins.
+	HideForbidden bool
+}
+
+type inviteRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  Role   `json:"role" validate:"required"`
+}
+
+type acceptRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// InvitationHandler exposes HTTP endpoints for team invitations.
+type InvitationHandler struct {
+	service InvitationService
+	cfg     InvitationHandlerConfig
+}
+
+// NewInvitationHandler creates a new InvitationHandler.
+func NewInvitationHandler(service InvitationService, cfg InvitationHandlerConfig) *InvitationHandler {
+	return &InvitationHandler{service: service, cfg: cfg}
+}
+
+// Mount registers the invitation routes on mux:
+//
+//	POST   /teams/{teamID}/invitations                       (team admins)
+//	GET    /teams/{teamID}/invitations                       (team admins)
+//	POST   /teams/{teamID}/invitations/{invitationID}/resend (team admins)
+//	DELETE /teams/{teamID}/invitations/{invitationID}        (team admins)
+//	POST   /invitations/accept                               (any authenticated user)
+func (h *InvitationHandler) Mount(mux Mux) {
+	admin := authz.RequireMembership(authz.MembershipConfig{
+		PathParam:     "teamID",
+		AdminStore:    h.cfg.Admins,
+		HideForbidden: h.cfg.HideForbidden,
+	})
+	guard := func(fn http.HandlerFunc) http.Handler {
+		return h.cfg.Authenticate(admin(fn))
+	}
+
+	mux.Handle("POST /teams/{teamID}/invitations", guard(h.Create))
+	mux.Handle("GET /teams/{teamID}/invitations", guard(h.List))
+	mux.Handle("POST /teams/{teamID}/invitations/{invitationID}/resend", guard(h.Resend))
+	mux.Handle("DELETE /teams/{teamID}/invitations/{invitationID}", guard(h.Revoke))
+	mux.Handle("POST /invitations/accept", h.cfg.Authenticate(http.HandlerFunc(h.Accept)))
+}
+
+// Create invites an email address to the team in the path, with a role no higher than
+// the inviter's own.
+func (h *InvitationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := middleware.GetAuthenticatedUserID(ctx)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+	teamID, ok := pathUUID(w, r, "teamID")
+	if !ok {
+		return
+	}
+
+	var req inviteRequest
+	if err := request.DecodeAndValidate(r, &req); err != nil {
+		jsonResponse.SendErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+
+	inv, err := h.service.Invite(ctx, InviteParams{
+		TeamID:    teamID,
+		Email:     req.Email,
+		Role:      req.Role,
+		InvitedBy: userID,
+	})
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse.JsonResponse(w, http.StatusCreated, inv)
+}
+
+// List returns the pending invitations of the team in the path.
+func (h *InvitationHandler) List(w http.ResponseWriter, r *http.Request) {
+	teamID, ok := pathUUID(w, r, "teamID")
+	if !ok {
+		return
+	}
+
+	invs, err := h.service.ListPending(r.Context(), teamID)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse.JsonResponse(w, http.StatusOK, invs)
+}
+
+// Resend sends a pending invitation again with a fresh token.
+func (h *InvitationHandler) Resend(w http.ResponseWriter, r *http.Request) {
+	teamID, ok := pathUUID(w, r, "teamID")
+	if !ok {
+		return
+	}
+	invitationID, ok := pathUUID(w, r, "invitationID")
+	if !ok {
+		return
+	}
+
+	inv, err := h.service.Resend(r.Context(), teamID, invitationID)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse.JsonResponse(w, http.StatusOK, inv)
+}
+
+// Revoke revokes a pending invitation.
+func (h *InvitationHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	teamID, ok := pathUUID(w, r, "teamID")
+	if !ok {
+		return
+	}
+	invitationID, ok := pathUUID(w, r, "invitationID")
+	if !ok {
+		return
+	}
+
+	if err := h.service.Revoke(r.Context(), teamID, invitationID); err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Accept redeems an invitation token for the authenticated user.
+func (h *InvitationHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := middleware.GetAuthenticatedUser(ctx)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+	userID, err := uuid.Parse(user.ID)
+	if err != nil {
+		jsonResponse.SendErrorResponse(w, customErrors.New("invalid user id", nil), http.StatusUnauthorized)
+		return
+	}
+
+	var req acceptRequest
+	if err := request.DecodeAndValidate(r, &req); err != nil {
+		jsonResponse.SendErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.service.Accept(ctx, req.Token, userID, user.Email)
+	if err != nil {
+		jsonResponse.SendAutoErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse.JsonResponse(w, http.StatusOK, member)
+}
+
+// pathUUID parses a path value as a UUID, writing a 404 response if it is malformed.
+func pathUUID(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue(name))
+	if err != nil {
+		jsonResponse.SendErrorResponse(w, customErrors.New("resource not found", nil), http.StatusNotFound)
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,113 @@
+package team
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvitationHandler(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	invitee := uuid.New()
+
+	store := newMemoryStorage()
+	notifier := &recordingNotifier{}
+	team, err := NewService(store).CreateTeam(ctx, "Acme", owner, nil)
+	require.NoError(t, err)
+
+	// fakeAuth authenticates as the user in the X-User-ID header.
+	fakeAuth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := &middleware.AuthenticatedUser{ID: r.Header.Get("X-User-ID")}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middleware.UserContextKey, user)))
+		})
+	}
+
+	mainRouter, apiRouter := router.New(router.Config{ApiVersion: "v1"})
+	NewInvitationHandler(NewInvitationService(store, notifier, InvitationConfig{}), InvitationHandlerConfig{
+		Authenticate: fakeAuth,
+		Admins:       store,
+	}).Mount(apiRouter)
+
+	do := func(method, path, body string, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", userID.String())
+		rr := httptest.NewRecorder()
+		mainRouter.ServeHTTP(rr, req)
+		return rr
+	}
+
+	invitations := "/teams/" + team.ID.String() + "/invitations"
+
+	t.Run("Non-admins cannot invite", func(t *testing.T) {
+		rr := do(http.MethodPost, invitations, `{"email": "dev@example.com", "role": "member"}`, invitee)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Admins cannot invite owners", func(t *testing.T) {
+		admin := uuid.New()
+		require.NoError(t, store.AddMember(ctx, &Member{TeamID: team.ID, UserID: admin, Role: RoleAdmin}))
+		rr := do(http.MethodPost, invitations, `{"email": "boss@example.com", "role": "owner"}`, admin)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Invalid body returns 400", func(t *testing.T) {
+		rr := do(http.MethodPost, invitations, `{"email": "not-an-email", "role": "member"}`, owner)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	var inv Invitation
+	t.Run("Admins can invite and list", func(t *testing.T) {
+		rr := do(http.MethodPost, invitations, `{"email": "dev@example.com", "role": "member"}`, owner)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&inv))
+		assert.NotContains(t, rr.Body.String(), "token_hash")
+
+		rr = do(http.MethodPost, invitations, `{"email": "dev@example.com", "role": "member"}`, owner)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = do(http.MethodGet, invitations, "", owner)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "dev@example.com")
+	})
+
+	t.Run("Resend", func(t *testing.T) {
+		rr := do(http.MethodPost, invitations+"/"+inv.ID.String()+"/resend", "", owner)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = do(http.MethodPost, invitations+"/"+uuid.NewString()+"/resend", "", owner)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Accept", func(t *testing.T) {
+		rr := do(http.MethodPost, "/invitations/accept", `{"token": "bogus"}`, invitee)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = do(http.MethodPost, "/invitations/accept", `{"token": "`+notifier.last()+`"}`, invitee)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		isMember, _ := store.IsMember(ctx, team.ID, invitee)
+		assert.True(t, isMember)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		rr := do(http.MethodPost, invitations, `{"email": "ops@example.com", "role": "viewer"}`, owner)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		var other Invitation
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&other))
+
+		rr = do(http.MethodDelete, invitations+"/"+other.ID.String(), "", owner)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+}
@@ -0,0 +1,173 @@
+package team
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier captures the raw tokens handed to the notifier.
+type recordingNotifier struct {
+	tokens []string
+	err    error
+}
+
+func (n *recordingNotifier) SendInvitation(_ context.Context, _ *Invitation, _ *Team, token string) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.tokens = append(n.tokens, token)
+	return nil
+}
+
+func (n *recordingNotifier) last() string {
+	return n.tokens[len(n.tokens)-1]
+}
+
+func TestInvitationService(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	invitee := uuid.New()
+
+	setup := func(t *testing.T, cfg InvitationConfig) (*memoryStorage, *recordingNotifier, InvitationService, *Team) {
+		store := newMemoryStorage()
+		notifier := &recordingNotifier{}
+		team, err := NewService(store).CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+		return store, notifier, NewInvitationService(store, notifier, cfg), team
+	}
+
+	t.Run("Invite and accept creates the membership", func(t *testing.T) {
+		store, notifier, svc, team := setup(t, InvitationConfig{})
+
+		inv, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: " Dev@Example.com ", Role: RoleMember, InvitedBy: owner})
+		require.NoError(t, err)
+		assert.Equal(t, "dev@example.com", inv.Email)
+		require.Len(t, notifier.tokens, 1)
+		assert.NotEqual(t, notifier.last(), inv.TokenHash)
+
+		member, err := svc.Accept(ctx, notifier.last(), invitee, "dev@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, RoleMember, member.Role)
+
+		isMember, _ := store.IsMember(ctx, team.ID, invitee)
+		assert.True(t, isMember)
+
+		// Tokens are single-use.
+		_, err = svc.Accept(ctx, notifier.last(), uuid.New(), "")
+		assert.ErrorIs(t, err, ErrInvitationInvalid)
+	})
+
+	t.Run("Duplicate pending invitations are rejected", func(t *testing.T) {
+		_, _, svc, team := setup(t, InvitationConfig{})
+
+		_, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "dev@example.com", Role: RoleMember, InvitedBy: owner})
+		require.NoError(t, err)
+		_, err = svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "DEV@example.com", Role: RoleAdmin, InvitedBy: owner})
+		assert.ErrorIs(t, err, customErrors.ErrAlreadyExists)
+	})
+
+	t.Run("Invalid input", func(t *testing.T) {
+		_, _, svc, team := setup(t, InvitationConfig{})
+
+		_, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Role: RoleMember, InvitedBy: owner})
+		assert.ErrorIs(t, err, customErrors.ErrInvalidInput)
+		_, err = svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "dev@example.com", Role: "root", InvitedBy: owner})
+		assert.ErrorIs(t, err, ErrInvalidRole)
+		_, err = svc.Invite(ctx, InviteParams{TeamID: uuid.New(), Email: "dev@example.com", Role: RoleMember, InvitedBy: owner})
+		assert.ErrorIs(t, err, ErrTeamNotFound)
+	})
+
+	t.Run("Invited role cannot outrank the inviter", func(t *testing.T) {
+		store, _, svc, team := setup(t, InvitationConfig{})
+		admin := uuid.New()
+		require.NoError(t, store.AddMember(ctx, &Member{TeamID: team.ID, UserID: admin, Role: RoleAdmin}))
+
+		_, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "boss@example.com", Role: RoleOwner, InvitedBy: admin})
+		assert.ErrorIs(t, err, ErrInvitationRole)
+		assert.ErrorIs(t, err, customErrors.ErrForbidden)
+		_, err = svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "boss@example.com", Role: RoleOwner, InviterRole: RoleAdmin})
+		assert.ErrorIs(t, err, ErrInvitationRole)
+		_, err = svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "boss@example.com", Role: RoleViewer, InvitedBy: uuid.New()})
+		assert.ErrorIs(t, err, ErrInvitationRole, "non-members cannot invite")
+
+		_, err = svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "ops@example.com", Role: RoleAdmin, InvitedBy: admin})
+		assert.NoError(t, err)
+		_, err = svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "boss@example.com", Role: RoleOwner, InvitedBy: owner})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Expired invitations cannot be accepted", func(t *testing.T) {
+		_, notifier, svc, team := setup(t, InvitationConfig{TTL: time.Hour})
+		svc.(*invitationService).now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+
+		_, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "dev@example.com", Role: RoleMember, InvitedBy: owner})
+		require.NoError(t, err)
+		svc.(*invitationService).now = time.Now
+
+		_, err = svc.Accept(ctx, notifier.last(), invitee, "")
+		assert.ErrorIs(t, err, ErrInvitationExpired)
+	})
+
+	t.Run("Resend invalidates the old token", func(t *testing.T) {
+		_, notifier, svc, team := setup(t, InvitationConfig{})
+
+		inv, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "dev@example.com", Role: RoleMember, InvitedBy: owner})
+		require.NoError(t, err)
+		oldToken := notifier.last()
+
+		_, err = svc.Resend(ctx, team.ID, inv.ID)
+		require.NoError(t, err)
+		require.Len(t, notifier.tokens, 2)
+
+		_, err = svc.Accept(ctx, oldToken, invitee, "")
+		assert.ErrorIs(t, err, ErrInvitationInvalid)
+		_, err = svc.Accept(ctx, notifier.last(), invitee, "")
+		assert.NoError(t, err)
+
+		_, err = svc.Resend(ctx, team.ID, inv.ID)
+		assert.ErrorIs(t, err, ErrInvitationNotFound)
+	})
+
+	t.Run("Revoked invitations cannot be accepted", func(t *testing.T) {
+		_, notifier, svc, team := setup(t, InvitationConfig{})
+
+		inv, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "dev@example.com", Role: RoleMember, InvitedBy: owner})
+		require.NoError(t, err)
+		require.NoError(t, svc.Revoke(ctx, team.ID, inv.ID))
+		assert.ErrorIs(t, svc.Revoke(ctx, team.ID, inv.ID), ErrInvitationNotFound)
+
+		_, err = svc.Accept(ctx, notifier.last(), invitee, "")
+		assert.ErrorIs(t, err, ErrInvitationInvalid)
+
+		pending, err := svc.ListPending(ctx, team.ID)
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("Email must match when required", func(t *testing.T) {
+		_, notifier, svc, team := setup(t, InvitationConfig{RequireEmailMatch: true})
+
+		_, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "dev@example.com", Role: RoleMember, InvitedBy: owner})
+		require.NoError(t, err)
+
+		_, err = svc.Accept(ctx, notifier.last(), invitee, "other@example.com")
+		assert.ErrorIs(t, err, customErrors.ErrForbidden)
+		_, err = svc.Accept(ctx, notifier.last(), invitee, "DEV@example.com")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Notifier failures are reported", func(t *testing.T) {
+		_, notifier, svc, team := setup(t, InvitationConfig{})
+		notifier.err = errors.New("smtp down")
+
+		_, err := svc.Invite(ctx, InviteParams{TeamID: team.ID, Email: "dev@example.com", Role: RoleMember, InvitedBy: owner})
+		assert.ErrorIs(t, err, customErrors.ErrInternal)
+	})
+}
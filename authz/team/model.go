@@ -0,0 +1,101 @@
+package team
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/gormutil"
+)
+
+// Role is the role of a member within a team.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleViewer Role = "viewer"
+)
+
+// IsValid reports whether r is one of the known roles.
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleOwner, RoleAdmin, RoleMember, RoleViewer:
+		return true
+	}
+	return false
+}
+
+// IsAdmin reports whether the role grants admin access to the team.
+func (r Role) IsAdmin() bool {
+	return r == RoleOwner || r == RoleAdmin
+}
+
+// rank orders the roles by the access they grant; unknown roles rank lowest.
+func (r Role) rank() int {
+	switch r {
+	case RoleOwner:
+		return 4
+	case RoleAdmin:
+		return 3
+	case RoleMember:
+		return 2
+	case RoleViewer:
+		return 1
+	}
+	return 0
+}
+
+// Team is an organization or a team. Organizations are teams without a parent;
+// teams inside an organization point to it with ParentID.
+type Team struct {
+	gormutil.BaseModel
+	Name     string     `json:"name"`
+	ParentID *uuid.UUID `json:"parent_id" gorm:"type:uuid;index"`
+}
+
+// Member is a user's membership of a team. Members are hard-deleted on removal so
+// the (team, user) pair can be re-added later.
+type Member struct {
+	gormutil.BaseModel
+	TeamID uuid.UUID `json:"team_id" gorm:"type:uuid;uniqueIndex:idx_team_members_team_user"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:uuid;uniqueIndex:idx_team_members_team_user;index"`
+	Role   Role      `json:"role" gorm:"index"`
+}
+
+// TableName keeps membership rows in team_members rather than members.
+func (Member) TableName() string {
+	return "team_members"
+}
+
+// Invitation is a pending invitation for an email address to join a team.
+// Only the SHA-256 hash of the invitation token is stored.
+type Invitation struct {
+	gormutil.BaseModel
+	TeamID     uuid.UUID  `json:"team_id" gorm:"type:uuid;index"`
+	Email      string     `json:"email" gorm:"index"`
+	Role       Role       `json:"role"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	InvitedBy  uuid.UUID  `json:"invited_by" gorm:"type:uuid"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// TableName keeps invitation rows in team_invitations rather than invitations.
+func (Invitation) TableName() string {
+	return "team_invitations"
+}
+
+// IsPending reports whether the invitation can still be accepted.
+func (i *Invitation) IsPending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// Memberships describes team_members for gormutil.AccessibleBy, restricting team
+// queries to teams the user belongs to.
+var Memberships = gormutil.MembershipTable{
+	Table:          "team_members",
+	ResourceColumn: "team_id",
+	UserColumn:     "user_id",
+}
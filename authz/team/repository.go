@@ -0,0 +1,181 @@
+package team
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/gormutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type teamRepository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a GORM-backed Storage for teams, members and invitations.
+func NewRepository(db *gorm.DB) Storage {
+	return &teamRepository{db: db}
+}
+
+// conn returns the transaction in ctx, if any, otherwise the base connection.
+func (r *teamRepository) conn(ctx context.Context) *gorm.DB {
+	if tx := gormutil.GetTransaction(ctx); tx != nil {
+		return tx.WithContext(ctx)
+	}
+	return r.db.WithContext(ctx)
+}
+
+func (r *teamRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if gormutil.GetTransaction(ctx) != nil {
+		return fn(ctx)
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(gormutil.WithTransaction(ctx, tx))
+	})
+}
+
+func (r *teamRepository) IsMember(ctx context.Context, teamID, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.conn(ctx).Model(&Member{}).
+		Where("team_id = ? AND user_id = ?", teamID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *teamRepository) IsAdmin(ctx context.Context, teamID, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.conn(ctx).Model(&Member{}).
+		Where("team_id = ? AND user_id = ? AND role IN ?", teamID, userID, []Role{RoleOwner, RoleAdmin}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *teamRepository) CreateTeam(ctx context.Context, team *Team) error {
+	return r.conn(ctx).Create(team).Error
+}
+
+func (r *teamRepository) FindTeam(ctx context.Context, teamID uuid.UUID) (*Team, error) {
+	var team Team
+	if err := r.conn(ctx).First(&team, "id = ?", teamID).Error; err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+func (r *teamRepository) AddMember(ctx context.Context, member *Member) error {
+	return r.conn(ctx).Create(member).Error
+}
+
+func (r *teamRepository) FindMember(ctx context.Context, teamID, userID uuid.UUID) (*Member, error) {
+	var member Member
+	if err := r.conn(ctx).Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *teamRepository) ListMembers(ctx context.Context, teamID uuid.UUID) ([]*Member, error) {
+	var members []*Member
+	err := r.conn(ctx).Where("team_id = ?", teamID).Order("created_at ASC").Find(&members).Error
+	return members, err
+}
+
+func (r *teamRepository) UpdateMemberRole(ctx context.Context, teamID, userID uuid.UUID, role Role) error {
+	return r.conn(ctx).Model(&Member{}).
+		Where("team_id = ? AND user_id = ?", teamID, userID).
+		Update("role", role).Error
+}
+
+func (r *teamRepository) RemoveMember(ctx context.Context, teamID, userID uuid.UUID) error {
+	return r.conn(ctx).Unscoped().
+		Where("team_id = ? AND user_id = ?", teamID, userID).
+		Delete(&Member{}).Error
+}
+
+func (r *teamRepository) LockOwners(ctx context.Context, teamID uuid.UUID) ([]uuid.UUID, error) {
+	var owners []uuid.UUID
+	err := r.conn(ctx).Model(&Member{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("team_id = ? AND role = ?", teamID, RoleOwner).
+		Pluck("user_id", &owners).Error
+	return owners, err
+}
+
+func (r *teamRepository) CreateInvitation(ctx context.Context, inv *Invitation) error {
+	return r.conn(ctx).Create(inv).Error
+}
+
+func (r *teamRepository) FindInvitation(ctx context.Context, teamID, invitationID uuid.UUID) (*Invitation, error) {
+	var inv Invitation
+	if err := r.conn(ctx).Where("id = ? AND team_id = ?", invitationID, teamID).First(&inv).Error; err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *teamRepository) FindInvitationByHash(ctx context.Context, hash string) (*Invitation, error) {
+	var inv Invitation
+	err := r.conn(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", hash).
+		First(&inv).Error
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *teamRepository) FindPendingInvitation(ctx context.Context, teamID uuid.UUID, email string, now time.Time) (*Invitation, error) {
+	var inv Invitation
+	err := r.pending(ctx, teamID, now).Where("email = ?", email).First(&inv).Error
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *teamRepository) ListPendingInvitations(ctx context.Context, teamID uuid.UUID, now time.Time) ([]*Invitation, error) {
+	var invs []*Invitation
+	err := r.pending(ctx, teamID, now).Order("created_at DESC").Find(&invs).Error
+	return invs, err
+}
+
+func (r *teamRepository) ReissueInvitation(ctx context.Context, invitationID uuid.UUID, hash string, expiresAt time.Time) (bool, error) {
+	res := r.conn(ctx).Model(&Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitationID).
+		Updates(map[string]any{"token_hash": hash, "expires_at": expiresAt})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *teamRepository) RevokeInvitation(ctx context.Context, teamID, invitationID uuid.UUID, at time.Time) (bool, error) {
+	res := r.conn(ctx).Model(&Invitation{}).
+		Where("id = ? AND team_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitationID, teamID).
+		Update("revoked_at", at)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *teamRepository) MarkInvitationAccepted(ctx context.Context, invitationID uuid.UUID, at time.Time) (bool, error) {
+	res := r.conn(ctx).Model(&Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitationID).
+		Update("accepted_at", at)
+	return res.RowsAffected == 1, res.Error
+}
+
+// pending scopes a query to invitations of the team that can still be accepted.
+func (r *teamRepository) pending(ctx context.Context, teamID uuid.UUID, now time.Time) *gorm.DB {
+	return r.conn(ctx).
+		Where("team_id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", teamID, now)
+}
+
+func (r *teamRepository) MembersOf(ctx context.Context, userID uuid.UUID, teamIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(teamIDs) == 0 {
+		return nil, nil
+	}
+	var members []uuid.UUID
+	err := r.conn(ctx).Model(&Member{}).
+		Where("user_id = ? AND team_id IN ?", userID, teamIDs).
+		Pluck("team_id", &members).Error
+	return members, err
+}
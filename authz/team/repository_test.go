@@ -0,0 +1,118 @@
+package team_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/authz/team"
+	"github.com/shashtag-ventures/go-common/gormutil"
+	"github.com/shashtag-ventures/go-common/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeamRepository(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	ctx := context.Background()
+	db, teardown := testutil.SetupTestDatabase(ctx)
+	defer teardown()
+
+	require.NoError(t, db.AutoMigrate(&team.Team{}, &team.Member{}, &team.Invitation{}))
+
+	repo := team.NewRepository(db)
+	svc := team.NewService(repo)
+	owner := uuid.New()
+	user := uuid.New()
+
+	t.Run("Membership checks", func(t *testing.T) {
+		testutil.CleanTables(db, "teams", "team_members")
+
+		tm, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+		_, err = svc.AddMember(ctx, tm.ID, owner, user, team.RoleViewer)
+		require.NoError(t, err)
+
+		isMember, err := repo.IsMember(ctx, tm.ID, user)
+		require.NoError(t, err)
+		assert.True(t, isMember)
+
+		isAdmin, err := repo.IsAdmin(ctx, tm.ID, user)
+		require.NoError(t, err)
+		assert.False(t, isAdmin)
+
+		isAdmin, err = repo.IsAdmin(ctx, tm.ID, owner)
+		require.NoError(t, err)
+		assert.True(t, isAdmin)
+	})
+
+	t.Run("Batch checks and accessible scope", func(t *testing.T) {
+		testutil.CleanTables(db, "teams", "team_members")
+
+		mine, err := svc.CreateTeam(ctx, "Mine", user, nil)
+		require.NoError(t, err)
+		_, err = svc.CreateTeam(ctx, "Theirs", owner, nil)
+		require.NoError(t, err)
+
+		members, err := repo.MembersOf(ctx, user, []uuid.UUID{mine.ID, uuid.New()})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{mine.ID}, members)
+
+		var teams []team.Team
+		require.NoError(t, db.Scopes(gormutil.AccessibleBy(user, team.Memberships)).Find(&teams).Error)
+		require.Len(t, teams, 1)
+		assert.Equal(t, "Mine", teams[0].Name)
+	})
+
+	t.Run("Removed members can be re-added", func(t *testing.T) {
+		testutil.CleanTables(db, "teams", "team_members")
+
+		tm, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+		_, err = svc.AddMember(ctx, tm.ID, owner, user, team.RoleMember)
+		require.NoError(t, err)
+		require.NoError(t, svc.RemoveMember(ctx, tm.ID, owner, user))
+
+		_, err = svc.AddMember(ctx, tm.ID, owner, user, team.RoleAdmin)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Last owner guard", func(t *testing.T) {
+		testutil.CleanTables(db, "teams", "team_members")
+
+		tm, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+
+		err = svc.RemoveMember(ctx, tm.ID, owner, owner)
+		assert.ErrorIs(t, err, team.ErrLastOwner)
+
+		owners, err := repo.LockOwners(ctx, tm.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{owner}, owners)
+	})
+
+	t.Run("Invitation acceptance is single-use", func(t *testing.T) {
+		testutil.CleanTables(db, "teams", "team_members", "team_invitations")
+
+		tm, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+
+		var token string
+		notifier := team.NotifierFunc(func(_ context.Context, _ *team.Invitation, _ *team.Team, raw string) error {
+			token = raw
+			return nil
+		})
+		invitations := team.NewInvitationService(repo, notifier, team.InvitationConfig{})
+
+		_, err = invitations.Invite(ctx, team.InviteParams{TeamID: tm.ID, Email: "dev@example.com", Role: team.RoleMember, InvitedBy: owner})
+		require.NoError(t, err)
+
+		_, err = invitations.Accept(ctx, token, user, "")
+		require.NoError(t, err)
+		_, err = invitations.Accept(ctx, token, uuid.New(), "")
+		assert.ErrorIs(t, err, team.ErrInvitationInvalid)
+	})
+}
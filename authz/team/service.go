@@ -0,0 +1,230 @@
+package team
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/errors"
+	"gorm.io/gorm"
+)
+
+// Errors returned by the service.
+var (
+	ErrTeamNotFound   = errors.New("team not found", errors.ErrNotFound)
+	ErrMemberNotFound = errors.New("member not found", errors.ErrNotFound)
+	ErrAlreadyMember  = errors.New("user is already a member of this team", errors.ErrAlreadyExists)
+	ErrInvalidRole    = errors.New("invalid team role", errors.ErrInvalidInput)
+	ErrLastOwner      = errors.New("a team must keep at least one owner", errors.ErrInvalidInput)
+	ErrRoleTooHigh    = errors.New("cannot manage a role above your own", errors.ErrForbidden)
+)
+
+// Service manages teams and their members. The member changes take the acting
+// user and return ErrRoleTooHigh if they would assign or remove a role above the
+// actor's own, so only owners can manage owners. Who may make changes at all is up
+// to the routes; guard them with authz.RequireMembership using the same Storage.
+type Service interface {
+	// CreateTeam creates a team with the given user as its first owner.
+	CreateTeam(ctx context.Context, name string, ownerID uuid.UUID, parentID *uuid.UUID) (*Team, error)
+	GetTeam(ctx context.Context, teamID uuid.UUID) (*Team, error)
+	ListMembers(ctx context.Context, teamID uuid.UUID) ([]*Member, error)
+	AddMember(ctx context.Context, teamID, actorID, userID uuid.UUID, role Role) (*Member, error)
+	// ChangeRole updates a member's role. Demoting the last owner returns ErrLastOwner.
+	ChangeRole(ctx context.Context, teamID, actorID, userID uuid.UUID, role Role) (*Member, error)
+	// RemoveMember removes a member. Removing the last owner returns ErrLastOwner.
+	RemoveMember(ctx context.Context, teamID, actorID, userID uuid.UUID) error
+}
+
+type teamService struct {
+	db Storage
+}
+
+// NewService creates a new team Service.
+func NewService(db Storage) Service {
+	return &teamService{db: db}
+}
+
+func (s *teamService) CreateTeam(ctx context.Context, name string, ownerID uuid.UUID, parentID *uuid.UUID) (*Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("team name is required", errors.ErrInvalidInput)
+	}
+	if ownerID == uuid.Nil {
+		return nil, errors.New("team requires an owner", errors.ErrInvalidInput)
+	}
+
+	team := &Team{Name: name, ParentID: parentID}
+	err := s.db.Transaction(ctx, func(ctx context.Context) error {
+		if parentID != nil {
+			if _, err := s.findTeam(ctx, *parentID); err != nil {
+				return err
+			}
+		}
+		if err := s.db.CreateTeam(ctx, team); err != nil {
+			return internalError(ctx, "failed to create team", err)
+		}
+		if err := s.db.AddMember(ctx, &Member{TeamID: team.ID, UserID: ownerID, Role: RoleOwner}); err != nil {
+			return internalError(ctx, "failed to add team owner", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+func (s *teamService) GetTeam(ctx context.Context, teamID uuid.UUID) (*Team, error) {
+	return s.findTeam(ctx, teamID)
+}
+
+func (s *teamService) ListMembers(ctx context.Context, teamID uuid.UUID) ([]*Member, error) {
+	members, err := s.db.ListMembers(ctx, teamID)
+	if err != nil {
+		return nil, internalError(ctx, "failed to list team members", err)
+	}
+	return members, nil
+}
+
+func (s *teamService) AddMember(ctx context.Context, teamID, actorID, userID uuid.UUID, role Role) (*Member, error) {
+	if !role.IsValid() {
+		return nil, ErrInvalidRole
+	}
+
+	member := &Member{TeamID: teamID, UserID: userID, Role: role}
+	err := s.db.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.findTeam(ctx, teamID); err != nil {
+			return err
+		}
+		if err := s.checkActorRole(ctx, teamID, actorID, role); err != nil {
+			return err
+		}
+		if _, err := s.findMember(ctx, teamID, userID); err == nil {
+			return ErrAlreadyMember
+		} else if !stderrors.Is(err, ErrMemberNotFound) {
+			return err
+		}
+		if err := s.db.AddMember(ctx, member); err != nil {
+			return internalError(ctx, "failed to add team member", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *teamService) ChangeRole(ctx context.Context, teamID, actorID, userID uuid.UUID, role Role) (*Member, error) {
+	if !role.IsValid() {
+		return nil, ErrInvalidRole
+	}
+
+	var member *Member
+	err := s.db.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		member, err = s.findMember(ctx, teamID, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkActorRole(ctx, teamID, actorID, member.Role, role); err != nil {
+			return err
+		}
+		if member.Role == role {
+			return nil
+		}
+		if member.Role == RoleOwner {
+			if err := s.ensureAnotherOwner(ctx, teamID, userID); err != nil {
+				return err
+			}
+		}
+		if err := s.db.UpdateMemberRole(ctx, teamID, userID, role); err != nil {
+			return internalError(ctx, "failed to change team role", err)
+		}
+		member.Role = role
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *teamService) RemoveMember(ctx context.Context, teamID, actorID, userID uuid.UUID) error {
+	return s.db.Transaction(ctx, func(ctx context.Context) error {
+		member, err := s.findMember(ctx, teamID, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkActorRole(ctx, teamID, actorID, member.Role); err != nil {
+			return err
+		}
+		if member.Role == RoleOwner {
+			if err := s.ensureAnotherOwner(ctx, teamID, userID); err != nil {
+				return err
+			}
+		}
+		if err := s.db.RemoveMember(ctx, teamID, userID); err != nil {
+			return internalError(ctx, "failed to remove team member", err)
+		}
+		return nil
+	})
+}
+
+// checkActorRole returns ErrRoleTooHigh if any of roles outranks the actor's role in
+// the team. Actors outside the team have no role and outrank nothing.
+func (s *teamService) checkActorRole(ctx context.Context, teamID, actorID uuid.UUID, roles ...Role) error {
+	actor, err := s.db.FindMember(ctx, teamID, actorID)
+	if err != nil && !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return internalError(ctx, "failed to load acting member", err)
+	}
+	var actorRole Role
+	if err == nil {
+		actorRole = actor.Role
+	}
+	for _, role := range roles {
+		if role.rank() > actorRole.rank() {
+			return ErrRoleTooHigh
+		}
+	}
+	return nil
+}
+
+// ensureAnotherOwner returns ErrLastOwner unless an owner other than userID exists.
+// The owner rows stay locked until the transaction ends, so two owners demoting
+// each other concurrently cannot leave the team ownerless.
+func (s *teamService) ensureAnotherOwner(ctx context.Context, teamID, userID uuid.UUID) error {
+	owners, err := s.db.LockOwners(ctx, teamID)
+	if err != nil {
+		return internalError(ctx, "failed to check team owners", err)
+	}
+	for _, owner := range owners {
+		if owner != userID {
+			return nil
+		}
+	}
+	return ErrLastOwner
+}
+
+func (s *teamService) findTeam(ctx context.Context, teamID uuid.UUID) (*Team, error) {
+	team, err := s.db.FindTeam(ctx, teamID)
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, internalError(ctx, "failed to load team", err)
+	}
+	return team, nil
+}
+
+func (s *teamService) findMember(ctx context.Context, teamID, userID uuid.UUID) (*Member, error) {
+	member, err := s.db.FindMember(ctx, teamID, userID)
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, internalError(ctx, "failed to load team member", err)
+	}
+	return member, nil
+}
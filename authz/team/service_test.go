@@ -0,0 +1,337 @@
+package team
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/authz"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryStorage is an in-memory Storage used to exercise the service without a database.
+type memoryStorage struct {
+	mu          sync.Mutex
+	teams       map[uuid.UUID]*Team
+	members     map[[2]uuid.UUID]*Member
+	invitations map[uuid.UUID]*Invitation
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		teams:       make(map[uuid.UUID]*Team),
+		members:     make(map[[2]uuid.UUID]*Member),
+		invitations: make(map[uuid.UUID]*Invitation),
+	}
+}
+
+func (m *memoryStorage) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m *memoryStorage) IsMember(_ context.Context, teamID, userID uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.members[[2]uuid.UUID{teamID, userID}]
+	return ok, nil
+}
+
+func (m *memoryStorage) IsAdmin(_ context.Context, teamID, userID uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	member, ok := m.members[[2]uuid.UUID{teamID, userID}]
+	return ok && member.Role.IsAdmin(), nil
+}
+
+func (m *memoryStorage) MembersOf(_ context.Context, userID uuid.UUID, teamIDs []uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var members []uuid.UUID
+	for _, teamID := range teamIDs {
+		if _, ok := m.members[[2]uuid.UUID{teamID, userID}]; ok {
+			members = append(members, teamID)
+		}
+	}
+	return members, nil
+}
+
+func (m *memoryStorage) CreateTeam(_ context.Context, team *Team) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	team.ID = uuid.New()
+	m.teams[team.ID] = team
+	return nil
+}
+
+func (m *memoryStorage) FindTeam(_ context.Context, teamID uuid.UUID) (*Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if team, ok := m.teams[teamID]; ok {
+		return team, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) AddMember(_ context.Context, member *Member) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	member.ID = uuid.New()
+	copied := *member
+	m.members[[2]uuid.UUID{member.TeamID, member.UserID}] = &copied
+	return nil
+}
+
+func (m *memoryStorage) FindMember(_ context.Context, teamID, userID uuid.UUID) (*Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if member, ok := m.members[[2]uuid.UUID{teamID, userID}]; ok {
+		copied := *member
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListMembers(_ context.Context, teamID uuid.UUID) ([]*Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var members []*Member
+	for key, member := range m.members {
+		if key[0] == teamID {
+			copied := *member
+			members = append(members, &copied)
+		}
+	}
+	return members, nil
+}
+
+func (m *memoryStorage) UpdateMemberRole(_ context.Context, teamID, userID uuid.UUID, role Role) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if member, ok := m.members[[2]uuid.UUID{teamID, userID}]; ok {
+		member.Role = role
+	}
+	return nil
+}
+
+func (m *memoryStorage) RemoveMember(_ context.Context, teamID, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.members, [2]uuid.UUID{teamID, userID})
+	return nil
+}
+
+func (m *memoryStorage) LockOwners(_ context.Context, teamID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var owners []uuid.UUID
+	for key, member := range m.members {
+		if key[0] == teamID && member.Role == RoleOwner {
+			owners = append(owners, key[1])
+		}
+	}
+	return owners, nil
+}
+
+func (m *memoryStorage) CreateInvitation(_ context.Context, inv *Invitation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv.ID = uuid.New()
+	copied := *inv
+	m.invitations[inv.ID] = &copied
+	return nil
+}
+
+func (m *memoryStorage) FindInvitation(_ context.Context, teamID, invitationID uuid.UUID) (*Invitation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if inv, ok := m.invitations[invitationID]; ok && inv.TeamID == teamID {
+		copied := *inv
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) FindInvitationByHash(_ context.Context, hash string) (*Invitation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, inv := range m.invitations {
+		if inv.TokenHash == hash {
+			copied := *inv
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) FindPendingInvitation(ctx context.Context, teamID uuid.UUID, email string, now time.Time) (*Invitation, error) {
+	invs, _ := m.ListPendingInvitations(ctx, teamID, now)
+	for _, inv := range invs {
+		if inv.Email == email {
+			return inv, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListPendingInvitations(_ context.Context, teamID uuid.UUID, now time.Time) ([]*Invitation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var invs []*Invitation
+	for _, inv := range m.invitations {
+		if inv.TeamID == teamID && inv.IsPending(now) {
+			copied := *inv
+			invs = append(invs, &copied)
+		}
+	}
+	return invs, nil
+}
+
+func (m *memoryStorage) ReissueInvitation(_ context.Context, invitationID uuid.UUID, hash string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv, ok := m.invitations[invitationID]
+	if !ok || inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return false, nil
+	}
+	inv.TokenHash = hash
+	inv.ExpiresAt = expiresAt
+	return true, nil
+}
+
+func (m *memoryStorage) RevokeInvitation(_ context.Context, teamID, invitationID uuid.UUID, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv, ok := m.invitations[invitationID]
+	if !ok || inv.TeamID != teamID || inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return false, nil
+	}
+	inv.RevokedAt = &at
+	return true, nil
+}
+
+func (m *memoryStorage) MarkInvitationAccepted(_ context.Context, invitationID uuid.UUID, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv, ok := m.invitations[invitationID]
+	if !ok || inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return false, nil
+	}
+	inv.AcceptedAt = &at
+	return true, nil
+}
+
+func TestTeamService(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	user := uuid.New()
+
+	t.Run("CreateTeam adds the owner", func(t *testing.T) {
+		store := newMemoryStorage()
+		svc := NewService(store)
+
+		team, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+
+		isAdmin, err := store.IsAdmin(ctx, team.ID, owner)
+		require.NoError(t, err)
+		assert.True(t, isAdmin)
+
+		_, err = svc.CreateTeam(ctx, "  ", owner, nil)
+		assert.ErrorIs(t, err, customErrors.ErrInvalidInput)
+
+		missing := uuid.New()
+		_, err = svc.CreateTeam(ctx, "Orphan", owner, &missing)
+		assert.ErrorIs(t, err, ErrTeamNotFound)
+	})
+
+	t.Run("AddMember", func(t *testing.T) {
+		store := newMemoryStorage()
+		svc := NewService(store)
+		team, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+
+		member, err := svc.AddMember(ctx, team.ID, owner, user, RoleMember)
+		require.NoError(t, err)
+		assert.Equal(t, RoleMember, member.Role)
+
+		_, err = svc.AddMember(ctx, team.ID, owner, user, RoleMember)
+		assert.ErrorIs(t, err, ErrAlreadyMember)
+
+		_, err = svc.AddMember(ctx, team.ID, owner, uuid.New(), Role("superuser"))
+		assert.ErrorIs(t, err, ErrInvalidRole)
+
+		_, err = svc.AddMember(ctx, uuid.New(), owner, user, RoleMember)
+		assert.ErrorIs(t, err, customErrors.ErrNotFound)
+
+		members, err := svc.ListMembers(ctx, team.ID)
+		require.NoError(t, err)
+		assert.Len(t, members, 2)
+
+		assert.NoError(t, authz.CheckMembership(ctx, store, team.ID, user))
+		assert.ErrorIs(t, authz.CheckAdminMembership(ctx, store, team.ID, user), customErrors.ErrForbidden)
+	})
+
+	t.Run("The last owner cannot be demoted or removed", func(t *testing.T) {
+		svc := NewService(newMemoryStorage())
+		team, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+
+		_, err = svc.ChangeRole(ctx, team.ID, owner, owner, RoleAdmin)
+		assert.ErrorIs(t, err, ErrLastOwner)
+		assert.ErrorIs(t, svc.RemoveMember(ctx, team.ID, owner, owner), ErrLastOwner)
+
+		_, err = svc.AddMember(ctx, team.ID, owner, user, RoleOwner)
+		require.NoError(t, err)
+
+		member, err := svc.ChangeRole(ctx, team.ID, owner, owner, RoleAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, RoleAdmin, member.Role)
+
+		assert.ErrorIs(t, svc.RemoveMember(ctx, team.ID, user, user), ErrLastOwner)
+		assert.NoError(t, svc.RemoveMember(ctx, team.ID, owner, owner))
+	})
+
+	t.Run("Admins cannot manage owners", func(t *testing.T) {
+		svc := NewService(newMemoryStorage())
+		team, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+		_, err = svc.AddMember(ctx, team.ID, owner, user, RoleAdmin)
+		require.NoError(t, err)
+		other := uuid.New()
+		_, err = svc.AddMember(ctx, team.ID, owner, other, RoleMember)
+		require.NoError(t, err)
+
+		_, err = svc.ChangeRole(ctx, team.ID, user, user, RoleOwner)
+		assert.ErrorIs(t, err, ErrRoleTooHigh)
+		_, err = svc.ChangeRole(ctx, team.ID, user, other, RoleOwner)
+		assert.ErrorIs(t, err, ErrRoleTooHigh)
+		_, err = svc.ChangeRole(ctx, team.ID, user, owner, RoleViewer)
+		assert.ErrorIs(t, err, ErrRoleTooHigh)
+		_, err = svc.AddMember(ctx, team.ID, user, uuid.New(), RoleOwner)
+		assert.ErrorIs(t, err, ErrRoleTooHigh)
+		assert.ErrorIs(t, svc.RemoveMember(ctx, team.ID, user, owner), customErrors.ErrForbidden)
+
+		member, err := svc.ChangeRole(ctx, team.ID, user, other, RoleAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, RoleAdmin, member.Role)
+		assert.NoError(t, svc.RemoveMember(ctx, team.ID, user, other))
+
+		_, err = svc.AddMember(ctx, team.ID, uuid.New(), uuid.New(), RoleViewer)
+		assert.ErrorIs(t, err, ErrRoleTooHigh, "outsiders have no role")
+	})
+
+	t.Run("Unknown members", func(t *testing.T) {
+		svc := NewService(newMemoryStorage())
+		team, err := svc.CreateTeam(ctx, "Acme", owner, nil)
+		require.NoError(t, err)
+
+		_, err = svc.ChangeRole(ctx, team.ID, owner, user, RoleAdmin)
+		assert.ErrorIs(t, err, ErrMemberNotFound)
+		assert.ErrorIs(t, svc.RemoveMember(ctx, team.ID, owner, user), customErrors.ErrNotFound)
+	})
+}
@@ -0,0 +1,51 @@
+package team
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/authz"
+)
+
+// Storage defines the persistence operations required by the team service.
+// It also satisfies the authz membership interfaces, so the same store can back
+// authz.RequireMembership and authz.FilterAccessible.
+type Storage interface {
+	authz.MembershipStore
+	authz.AdminMembershipStore
+	authz.BatchMembershipStore
+
+	// Transaction runs fn with a context carrying a database transaction.
+	// Storage methods called with that context take part in the transaction.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+
+	CreateTeam(ctx context.Context, team *Team) error
+	FindTeam(ctx context.Context, teamID uuid.UUID) (*Team, error)
+
+	AddMember(ctx context.Context, member *Member) error
+	FindMember(ctx context.Context, teamID, userID uuid.UUID) (*Member, error)
+	ListMembers(ctx context.Context, teamID uuid.UUID) ([]*Member, error)
+	UpdateMemberRole(ctx context.Context, teamID, userID uuid.UUID, role Role) error
+	RemoveMember(ctx context.Context, teamID, userID uuid.UUID) error
+	// LockOwners returns the user IDs of the team's owners, locking their rows until
+	// the surrounding transaction ends so concurrent demotions cannot race.
+	LockOwners(ctx context.Context, teamID uuid.UUID) ([]uuid.UUID, error)
+
+	CreateInvitation(ctx context.Context, inv *Invitation) error
+	FindInvitation(ctx context.Context, teamID, invitationID uuid.UUID) (*Invitation, error)
+	// FindInvitationByHash loads an invitation by token hash, locking the row
+	// until the surrounding transaction ends.
+	FindInvitationByHash(ctx context.Context, hash string) (*Invitation, error)
+	// FindPendingInvitation returns the unaccepted, unrevoked invitation for an email, if any.
+	FindPendingInvitation(ctx context.Context, teamID uuid.UUID, email string, now time.Time) (*Invitation, error)
+	ListPendingInvitations(ctx context.Context, teamID uuid.UUID, now time.Time) ([]*Invitation, error)
+	// ReissueInvitation replaces the token of a pending invitation and extends its expiry.
+	// It reports whether a pending invitation was updated.
+	ReissueInvitation(ctx context.Context, invitationID uuid.UUID, hash string, expiresAt time.Time) (bool, error)
+	// RevokeInvitation revokes a pending invitation and reports whether one was found.
+	RevokeInvitation(ctx context.Context, teamID, invitationID uuid.UUID, at time.Time) (bool, error)
+	// MarkInvitationAccepted atomically marks a pending invitation as accepted.
+	// It returns false if the invitation was accepted or revoked concurrently.
+	MarkInvitationAccepted(ctx context.Context, invitationID uuid.UUID, at time.Time) (bool, error)
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log/slog"
 	"strconv"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jwt"
 )
 
 // GitHubConfig holds credentials for GitHub OAuth and GitHub App.
@@ -58,6 +61,26 @@ type GoogleConfig struct {
 type JWTConfig struct {
 	Secret            string `env:"JWT_SECRET"`
 	ExpirationSeconds int    `env:"JWT_EXPIRATION_SECONDS" envDefault:"86400"`
+	Issuer            string `env:"JWT_ISSUER"`   // Expected "iss" claim; empty disables the check
+	Audience          string `env:"JWT_AUDIENCE"` // Expected "aud" entry; empty disables the check
+}
+
+// TokenOptions returns the options for minting tokens with the configured expiration,
+// issuer and audience, so they pass ParseOptions.
+func (c JWTConfig) TokenOptions() jwt.TokenOptions {
+	opts := jwt.TokenOptions{
+		TTL:    time.Duration(c.ExpirationSeconds) * time.Second,
+		Issuer: c.Issuer,
+	}
+	if c.Audience != "" {
+		opts.Audience = []string{c.Audience}
+	}
+	return opts
+}
+
+// ParseOptions returns the validation for tokens, e.g. for JWTAuthConfig.Validation.
+func (c JWTConfig) ParseOptions() jwt.ParseOptions {
+	return jwt.ParseOptions{Issuer: c.Issuer, Audience: c.Audience}
 }
 
 // SessionConfig holds settings for session management.
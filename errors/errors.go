@@ -14,6 +14,7 @@ var (
 	ErrForbidden     = errors.New("forbidden")             // Indicates that the server understood the request but refuses to authorize it.
 	ErrInternal      = errors.New("internal server error") // Indicates an unexpected internal server error.
 	ErrAlreadyExists = errors.New("resource already exists") // Indicates that a resource with the same identifier already exists.
+	ErrTooLarge      = errors.New("request body too large")  // Indicates that the request body exceeds the allowed size.
 )
 
 // New wraps an error with a message, preserving the original error.
@@ -0,0 +1,67 @@
+package gormutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MembershipTable describes the table that links users to the resources they can access.
+type MembershipTable struct {
+	Table          string // e.g. "team_members"
+	ResourceColumn string // Column holding the resource ID, e.g. "team_id"
+	UserColumn     string // Column holding the user ID, e.g. "user_id"
+	// KeyColumn is the column of the queried model matched against ResourceColumn.
+	// Defaults to "id"; set it to e.g. "team_id" for resources owned by a team. Columns
+	// without a table are qualified with the queried table, so joins stay unambiguous.
+	KeyColumn string
+	// SoftDeleteColumn marks removed memberships, which grant no access. Defaults to
+	// "deleted_at" as in BaseModel; "-" means the table has no soft deletes.
+	SoftDeleteColumn string
+}
+
+// AccessibleBy returns a scope restricting a query to rows the user is a member of,
+// using a subquery on the membership table so it composes with pagination:
+//
+//	db.Scopes(gormutil.AccessibleBy(userID, team.Memberships)).Find(&teams)
+func AccessibleBy(userID uuid.UUID, m MembershipTable) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		key := clause.Column{Table: clause.CurrentTable, Name: m.KeyColumn}
+		if key.Name == "" {
+			key.Name = "id"
+		}
+		if strings.Contains(key.Name, ".") {
+			key = clause.Column{Name: key.Name, Raw: true}
+		}
+
+		sub := db.Session(&gorm.Session{NewDB: true}).
+			Table(m.Table).
+			Select(m.ResourceColumn).
+			Where(fmt.Sprintf("%s = ?", m.UserColumn), userID)
+		switch m.SoftDeleteColumn {
+		case "-":
+		case "":
+			sub = sub.Where("deleted_at IS NULL")
+		default:
+			sub = sub.Where(fmt.Sprintf("%s IS NULL", m.SoftDeleteColumn))
+		}
+		return db.Where("? IN (?)", key, sub)
+	}
+}
+
+// AccessibleByCurrentUser is like AccessibleBy for the authenticated user in ctx.
+// Without an authenticated user the query matches no rows.
+func AccessibleByCurrentUser(ctx context.Context, m MembershipTable) func(*gorm.DB) *gorm.DB {
+	userID, err := middleware.GetAuthenticatedUserID(ctx)
+	if err != nil {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("1 = 0")
+		}
+	}
+	return AccessibleBy(userID, m)
+}
@@ -0,0 +1,64 @@
+package gormutil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/gormutil"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type scopedProject struct {
+	gormutil.BaseModel
+	TeamID uuid.UUID
+}
+
+func TestAccessibleBy(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	require.NoError(t, err)
+
+	memberships := gormutil.MembershipTable{
+		Table:          "team_members",
+		ResourceColumn: "team_id",
+		UserColumn:     "user_id",
+		KeyColumn:      "scoped_projects.team_id",
+	}
+	userID := uuid.New()
+
+	t.Run("Restricts to the user's resources", func(t *testing.T) {
+		stmt := db.Scopes(gormutil.AccessibleBy(userID, memberships)).Find(&[]scopedProject{}).Statement
+
+		assert.Contains(t, stmt.SQL.String(), "scoped_projects.team_id IN (SELECT team_id FROM \"team_members\" WHERE user_id = $1 AND deleted_at IS NULL)")
+		assert.Equal(t, []any{userID}, stmt.Vars)
+	})
+
+	t.Run("Qualifies the key with the queried table", func(t *testing.T) {
+		m := memberships
+		m.KeyColumn = ""
+		m.SoftDeleteColumn = "-"
+		stmt := db.Scopes(gormutil.AccessibleBy(userID, m)).Joins("JOIN teams ON teams.id = scoped_projects.team_id").Find(&[]scopedProject{}).Statement
+
+		assert.Contains(t, stmt.SQL.String(), "\"scoped_projects\".\"id\" IN (SELECT team_id FROM \"team_members\" WHERE user_id = $1)")
+	})
+
+	t.Run("Uses the authenticated user from context", func(t *testing.T) {
+		user := &middleware.AuthenticatedUser{ID: userID.String()}
+		ctx := context.WithValue(context.Background(), middleware.UserContextKey, user)
+
+		stmt := db.Scopes(gormutil.AccessibleByCurrentUser(ctx, memberships)).Find(&[]scopedProject{}).Statement
+		assert.Equal(t, []any{userID}, stmt.Vars)
+	})
+
+	t.Run("Matches nothing without a user", func(t *testing.T) {
+		stmt := db.Scopes(gormutil.AccessibleByCurrentUser(context.Background(), memberships)).Find(&[]scopedProject{}).Statement
+		assert.Contains(t, stmt.SQL.String(), "1 = 0")
+	})
+}
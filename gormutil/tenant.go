@@ -0,0 +1,225 @@
+package gormutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultTenantColumn is the column TenantPlugin scopes on when none is configured.
+const DefaultTenantColumn = "tenant_id"
+
+// ErrMissingTenant is returned for queries on tenant-scoped models when the context
+// carries no tenant and the scope has not been explicitly skipped.
+var ErrMissingTenant = errors.New("gormutil: no tenant in context for tenant-scoped query")
+
+// ErrTenantMismatch is returned when creating a row that is set to another tenant, or
+// when an update would move a row to another tenant.
+var ErrTenantMismatch = errors.New("gormutil: row belongs to another tenant")
+
+type skipTenantKey struct{}
+
+// WithoutTenantScope returns a context in which TenantPlugin does not scope queries,
+// for cross-tenant work such as admin tools and migrations.
+func WithoutTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipTenantKey{}, true)
+}
+
+// TenantPlugin scopes every query on models that have a tenant column to the tenant in
+// the statement context (see middleware.GetTenantID), and sets the column on create:
+//
+//	db.Use(&gormutil.TenantPlugin{})
+//	db.WithContext(r.Context()).Find(&projects) // ... WHERE projects.tenant_id = ?
+//
+// Queries on such models fail with ErrMissingTenant when the context has no tenant, so
+// a missing WithContext cannot leak rows across tenants. Updates cannot change the
+// tenant column, and upserts (including the fallback of Save when no row was updated)
+// only overwrite rows of the current tenant. Use WithoutTenantScope to opt out. Raw
+// SQL (db.Raw, db.Exec) is not scoped.
+type TenantPlugin struct {
+	Column string // Defaults to DefaultTenantColumn
+}
+
+// Name implements gorm.Plugin.
+func (p *TenantPlugin) Name() string {
+	return "gormutil:tenant"
+}
+
+// Initialize implements gorm.Plugin.
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	if p.Column == "" {
+		p.Column = DefaultTenantColumn
+	}
+
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("gormutil:tenant_create", p.assign); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("gormutil:tenant_query", p.scope); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("gormutil:tenant_row", p.scope); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("gormutil:tenant_update", p.scopeUpdate); err != nil {
+		return err
+	}
+	return cb.Delete().Before("gorm:delete").Register("gormutil:tenant_delete", p.scope)
+}
+
+// tenantField returns the tenant field of the statement's model, or nil if it has none
+// or scoping is skipped.
+func (p *TenantPlugin) tenantField(db *gorm.DB) *schema.Field {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+	if skip, _ := db.Statement.Context.Value(skipTenantKey{}).(bool); skip {
+		return nil
+	}
+	return db.Statement.Schema.LookUpField(p.Column)
+}
+
+func (p *TenantPlugin) scope(db *gorm.DB) {
+	field := p.tenantField(db)
+	if field == nil {
+		return
+	}
+	tenantID := middleware.GetTenantID(db.Statement.Context)
+	if tenantID == "" {
+		db.AddError(ErrMissingTenant)
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID},
+	}})
+}
+
+func (p *TenantPlugin) assign(db *gorm.DB) {
+	field := p.tenantField(db)
+	if field == nil {
+		return
+	}
+	tenantID := middleware.GetTenantID(db.Statement.Context)
+	if tenantID == "" {
+		db.AddError(ErrMissingTenant)
+		return
+	}
+	value, err := tenantValue(field, tenantID)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			row := reflect.Indirect(rv.Index(i))
+			if row.Kind() == reflect.Struct {
+				p.setRow(db, field, row, value)
+			}
+		}
+	case reflect.Struct:
+		p.setRow(db, field, rv, value)
+	}
+
+	// An upsert must not overwrite a conflicting row of another tenant, which Save
+	// would otherwise do for a row ID that the tenant-scoped UPDATE did not match.
+	if c, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			onConflict.Where.Exprs = append(onConflict.Where.Exprs, clause.Eq{
+				Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID,
+			})
+			c.Expression = onConflict
+			db.Statement.Clauses["ON CONFLICT"] = c
+		}
+	}
+}
+
+// scopeUpdate scopes the update to the current tenant and rejects assignments that
+// would move the row to another tenant.
+func (p *TenantPlugin) scopeUpdate(db *gorm.DB) {
+	p.scope(db)
+	field := p.tenantField(db)
+	if field == nil || db.Error != nil {
+		return
+	}
+	value, err := tenantValue(field, middleware.GetTenantID(db.Statement.Context))
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]any:
+		for column, v := range dest {
+			if column != field.DBName && column != field.Name {
+				continue
+			}
+			if !sameTenant(v, value) {
+				db.AddError(ErrTenantMismatch)
+			}
+		}
+	default:
+		// Save and Updates with a model write every selected column, so a zero tenant
+		// would clear it.
+		row := reflect.Indirect(reflect.ValueOf(dest))
+		if row.Kind() == reflect.Struct && row.Type() == db.Statement.Schema.ModelType {
+			p.setRow(db, field, row, value)
+		}
+	}
+}
+
+// setRow sets the tenant of a row with none, and fails if it belongs to another tenant.
+func (p *TenantPlugin) setRow(db *gorm.DB, field *schema.Field, row reflect.Value, value any) {
+	ctx := db.Statement.Context
+	current, zero := field.ValueOf(ctx, row)
+	if zero {
+		if err := field.Set(ctx, row, value); err != nil {
+			db.AddError(err)
+		}
+		return
+	}
+	if !sameTenant(current, value) {
+		db.AddError(ErrTenantMismatch)
+	}
+}
+
+func sameTenant(current, value any) bool {
+	v := reflect.Indirect(reflect.ValueOf(current))
+	return v.IsValid() && fmt.Sprint(v.Interface()) == fmt.Sprint(value)
+}
+
+// tenantValue converts the tenant ID to the field's type.
+func tenantValue(field *schema.Field, tenantID string) (any, error) {
+	switch field.FieldType {
+	case reflect.TypeOf(uuid.UUID{}), reflect.TypeOf(&uuid.UUID{}):
+		id, err := uuid.Parse(tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("gormutil: invalid tenant id %q: %w", tenantID, err)
+		}
+		return id, nil
+	}
+	return tenantID, nil
+}
+
+// TenantScope restricts a query to the tenant in ctx, for use without TenantPlugin or
+// on joined tables. Without a tenant the query matches no rows.
+//
+//	db.Scopes(gormutil.TenantScope(ctx, "projects.tenant_id")).Find(&projects)
+func TenantScope(ctx context.Context, column string) func(*gorm.DB) *gorm.DB {
+	tenantID := middleware.GetTenantID(ctx)
+	return func(db *gorm.DB) *gorm.DB {
+		if tenantID == "" {
+			return db.Where("1 = 0")
+		}
+		return db.Where(fmt.Sprintf("%s = ?", column), tenantID)
+	}
+}
@@ -0,0 +1,128 @@
+package gormutil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashtag-ventures/go-common/gormutil"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type tenantInvoice struct {
+	gormutil.BaseModel
+	TenantID uuid.UUID
+	Number   string
+}
+
+type tenantTag struct {
+	ID       uint
+	TenantID string
+}
+
+type globalCountry struct {
+	Code string `gorm:"primaryKey"`
+}
+
+func TestTenantPlugin(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(&gormutil.TenantPlugin{}))
+
+	tenantID := uuid.New()
+	ctx := middleware.WithTenantID(context.Background(), tenantID.String())
+
+	t.Run("Scopes queries", func(t *testing.T) {
+		stmt := db.WithContext(ctx).Where("number = ?", "INV-1").Find(&[]tenantInvoice{}).Statement
+		assert.Contains(t, stmt.SQL.String(), `"tenant_invoices"."tenant_id" = $2`)
+		assert.Contains(t, stmt.Vars, tenantID.String())
+	})
+
+	t.Run("Scopes updates and deletes", func(t *testing.T) {
+		stmt := db.WithContext(ctx).Model(&tenantInvoice{}).Where("number = ?", "INV-1").Update("number", "INV-2").Statement
+		assert.Contains(t, stmt.SQL.String(), `"tenant_invoices"."tenant_id" =`)
+
+		stmt = db.WithContext(ctx).Where("number = ?", "INV-1").Delete(&tenantInvoice{}).Statement
+		assert.Contains(t, stmt.SQL.String(), `"tenant_invoices"."tenant_id" =`)
+	})
+
+	t.Run("Sets the tenant on create", func(t *testing.T) {
+		invoice := &tenantInvoice{Number: "INV-3"}
+		require.NoError(t, db.WithContext(ctx).Create(invoice).Error)
+		assert.Equal(t, tenantID, invoice.TenantID)
+
+		tags := []tenantTag{{}, {}}
+		require.NoError(t, db.WithContext(ctx).Create(&tags).Error)
+		assert.Equal(t, tenantID.String(), tags[1].TenantID)
+	})
+
+	t.Run("Rejects rows of another tenant", func(t *testing.T) {
+		err := db.WithContext(ctx).Create(&tenantInvoice{TenantID: uuid.New()}).Error
+		assert.ErrorIs(t, err, gormutil.ErrTenantMismatch)
+	})
+
+	t.Run("Updates cannot move rows to another tenant", func(t *testing.T) {
+		err := db.WithContext(ctx).Model(&tenantInvoice{}).Where("number = ?", "INV-1").Update("tenant_id", uuid.New()).Error
+		assert.ErrorIs(t, err, gormutil.ErrTenantMismatch)
+
+		invoice := &tenantInvoice{BaseModel: gormutil.BaseModel{ID: uuid.New()}, TenantID: uuid.New()}
+		assert.ErrorIs(t, db.WithContext(ctx).Save(invoice).Error, gormutil.ErrTenantMismatch)
+
+		invoice.TenantID = uuid.Nil
+		require.NoError(t, db.WithContext(ctx).Save(invoice).Error)
+		assert.Equal(t, tenantID, invoice.TenantID, "Save does not clear the tenant")
+	})
+
+	t.Run("Save cannot overwrite rows of another tenant", func(t *testing.T) {
+		// When the scoped UPDATE matches no row, e.g. because the ID belongs to another
+		// tenant, Save falls back to this upsert.
+		invoice := &tenantInvoice{BaseModel: gormutil.BaseModel{ID: uuid.New()}, Number: "INV-4"}
+		stmt := db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(invoice).Statement
+		require.NoError(t, stmt.Error)
+		assert.Regexp(t, `ON CONFLICT \("id"\) DO UPDATE SET .* WHERE "tenant_invoices"."tenant_id" = \$\d+`, stmt.SQL.String())
+		assert.Contains(t, stmt.Vars, tenantID.String())
+	})
+
+	t.Run("Fails closed without a tenant", func(t *testing.T) {
+		err := db.WithContext(context.Background()).Find(&[]tenantInvoice{}).Error
+		assert.ErrorIs(t, err, gormutil.ErrMissingTenant)
+
+		err = db.Find(&[]tenantInvoice{}).Error
+		assert.ErrorIs(t, err, gormutil.ErrMissingTenant)
+	})
+
+	t.Run("Opt out and unscoped models", func(t *testing.T) {
+		stmt := db.WithContext(gormutil.WithoutTenantScope(context.Background())).Find(&[]tenantInvoice{}).Statement
+		assert.NoError(t, stmt.Error)
+		assert.NotContains(t, stmt.SQL.String(), "tenant_id")
+
+		stmt = db.WithContext(context.Background()).Find(&[]globalCountry{}).Statement
+		assert.NoError(t, stmt.Error)
+	})
+}
+
+func TestTenantScope(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	require.NoError(t, err)
+
+	ctx := middleware.WithTenantID(context.Background(), "t-1")
+	stmt := db.Scopes(gormutil.TenantScope(ctx, "tenant_tags.tenant_id")).Find(&[]tenantTag{}).Statement
+	assert.Contains(t, stmt.SQL.String(), "tenant_tags.tenant_id = $1")
+	assert.Equal(t, []any{"t-1"}, stmt.Vars)
+
+	stmt = db.Scopes(gormutil.TenantScope(context.Background(), "tenant_id")).Find(&[]tenantTag{}).Statement
+	assert.Contains(t, stmt.SQL.String(), "1 = 0")
+}
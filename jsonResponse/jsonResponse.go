@@ -16,6 +16,8 @@ type ErrorResponse struct {
 	Status  int    `json:"status"`  // HTTP status code
 	Error   string `json:"error"`   // A short, human-readable summary of the error
 	Message string `json:"message"` // A more detailed, human-readable message about the error
+	// RequestID is set on server errors so clients can quote it when reporting a problem.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // errorStatusCodeMap maps custom error types to their corresponding HTTP status codes.
@@ -26,6 +28,7 @@ var errorStatusCodeMap = map[error]int{
 	customErrors.ErrForbidden:     http.StatusForbidden,
 	customErrors.ErrAlreadyExists: http.StatusConflict,
 	customErrors.ErrInternal:      http.StatusInternalServerError,
+	customErrors.ErrTooLarge:      http.StatusRequestEntityTooLarge,
 }
 
 // JsonResponse sends a JSON response with the given status code and data.
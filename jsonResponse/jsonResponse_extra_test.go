@@ -31,6 +31,11 @@ func TestSendAutoErrorResponse(t *testing.T) {
 			err:        customErrors.ErrInternal,
 			wantStatus: http.StatusInternalServerError,
 		},
+		{
+			name:       "Too Large Error",
+			err:        customErrors.New("upload rejected", customErrors.ErrTooLarge),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
 		{
 			name:       "Unmapped Generic Error",
 			err:        errors.New("something went wrong"),
@@ -5,23 +5,103 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // Claims defines the structure of the JWT claims, embedding standard registered claims.
+// Embed Claims in your own struct to carry application-specific claims.
 type Claims struct {
-	UserID string
-	Role   string
+	UserID   string
+	Role     string
+	Email    string   `json:"email,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	TenantID string   `json:"tenant_id,omitempty"`
+	// Actor is set on impersonation tokens and identifies the user who is really
+	// acting, while UserID is the user being impersonated (RFC 8693 "act" claim).
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor identifies the real user behind an impersonation token.
+type Actor struct {
+	UserID string `json:"sub"`
+	Role   string `json:"role,omitempty"`
+	Email  string `json:"email,omitempty"`
+}
+
+// IsImpersonation reports whether the token was issued to an actor on behalf of UserID.
+func (c *Claims) IsImpersonation() bool {
+	return c.Actor != nil && c.Actor.UserID != ""
+}
+
+// BaseClaims returns the common claims. Structs embedding Claims inherit it,
+// which is what lets them satisfy CustomClaims.
+func (c *Claims) BaseClaims() *Claims {
+	return c
+}
+
+// CustomClaims is the constraint for claim types accepted by the generic API.
+// Any struct embedding Claims satisfies it through a pointer.
+type CustomClaims interface {
+	jwt.Claims
+	BaseClaims() *Claims
+}
+
+// TokenOptions controls the registered claims set when a token is created.
+type TokenOptions struct {
+	TTL       time.Duration // Lifetime of the token; required unless ExpiresAt is already set on the claims
+	Issuer    string        // Sets the "iss" claim
+	Audience  []string      // Sets the "aud" claim
+	NotBefore time.Time     // Sets the "nbf" claim when non-zero
+}
+
+// ParseOptions controls the validation applied when a token is parsed.
+type ParseOptions struct {
+	Issuer   string        // When set, the "iss" claim must match
+	Audience string        // When set, the "aud" claim must contain this value
+	Leeway   time.Duration // Clock skew tolerated for "exp", "nbf" and "iat"
+}
+
 // CreateToken generates a new JWT token for the given user ID, role, and duration.
+// Every token gets a unique ID (jti) and issued-at time so it can be revoked individually
+// or as part of a user-wide revocation.
 func CreateToken(userID string, role string, jwtSecret string, duration time.Duration) (string, error) {
 	claims := &Claims{
 		UserID: userID,
 		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-		},
+	}
+	return CreateTokenWithClaims(claims, jwtSecret, TokenOptions{TTL: duration})
+}
+
+// CreateTokenWithClaims signs a token for any claims type embedding Claims.
+// Registered claims that are unset (jti, iat, exp) are generated and iss, aud and nbf
+// are set from opts. This modifies the passed claims, so callers can read the generated
+// ID and expiry afterwards; use a fresh claims value for every token, or tokens created
+// from the same value share one jti and expiry.
+func CreateTokenWithClaims[C CustomClaims](claims C, jwtSecret string, opts TokenOptions) (string, error) {
+	now := time.Now()
+	rc := &claims.BaseClaims().RegisteredClaims
+
+	if rc.ID == "" {
+		rc.ID = uuid.NewString()
+	}
+	if rc.IssuedAt == nil {
+		rc.IssuedAt = jwt.NewNumericDate(now)
+	}
+	if rc.ExpiresAt == nil {
+		if opts.TTL == 0 {
+			return "", fmt.Errorf("token must have an expiry: set TokenOptions.TTL")
+		}
+		rc.ExpiresAt = jwt.NewNumericDate(now.Add(opts.TTL))
+	}
+	if opts.Issuer != "" {
+		rc.Issuer = opts.Issuer
+	}
+	if len(opts.Audience) > 0 {
+		rc.Audience = opts.Audience
+	}
+	if !opts.NotBefore.IsZero() {
+		rc.NotBefore = jwt.NewNumericDate(opts.NotBefore)
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -29,21 +109,44 @@ func CreateToken(userID string, role string, jwtSecret string, duration time.Dur
 }
 
 // ParseToken parses and validates a JWT token string.
+// It does not check issuer or audience; use ParseTokenWithClaims for that.
 func ParseToken(tokenString string, jwtSecret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+	return ParseTokenWithClaims[Claims](tokenString, jwtSecret, ParseOptions{})
+}
+
+// ParseTokenWithClaims parses and validates a token into a user-defined claims type:
+//
+//	claims, err := jwt.ParseTokenWithClaims[MyClaims](token, secret, jwt.ParseOptions{Issuer: "api"})
+func ParseTokenWithClaims[T any, PT interface {
+	*T
+	CustomClaims
+}](tokenString string, jwtSecret string, opts ParseOptions) (*T, error) {
+	var parserOpts []jwt.ParserOption
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+	if opts.Leeway > 0 {
+		parserOpts = append(parserOpts, jwt.WithLeeway(opts.Leeway))
+	}
+
+	claims := PT(new(T))
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(jwtSecret), nil
-	})
+	}, parserOpts...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	return (*T)(claims), nil
 }
@@ -32,6 +32,8 @@ func TestCreateToken(t *testing.T) {
 	assert.Equal(t, userID, claims.UserID)
 	assert.Equal(t, role, claims.Role)
 	assert.True(t, claims.ExpiresAt.Time.After(time.Now()))
+	assert.NotEmpty(t, claims.ID)
+	assert.NotNil(t, claims.IssuedAt)
 }
 
 func TestParseToken(t *testing.T) {
@@ -102,3 +104,93 @@ func TestParseToken(t *testing.T) {
 		assert.Contains(t, err.Error(), "unexpected signing method")
 	})
 }
+
+type projectClaims struct {
+	jwt.Claims
+	ProjectID string `json:"project_id"`
+}
+
+func TestCustomClaims(t *testing.T) {
+	t.Run("Round trip of custom claims", func(t *testing.T) {
+		claims := &projectClaims{
+			Claims: jwt.Claims{
+				UserID:   "42",
+				Role:     "member",
+				Email:    "jane@example.com",
+				Scopes:   []string{"project:read"},
+				TenantID: "acme",
+			},
+			ProjectID: "p-1",
+		}
+
+		tokenString, err := jwt.CreateTokenWithClaims(claims, testSecret, jwt.TokenOptions{
+			TTL:      time.Hour,
+			Issuer:   "auth-service",
+			Audience: []string{"deploy-api"},
+		})
+		assert.NoError(t, err)
+
+		parsed, err := jwt.ParseTokenWithClaims[projectClaims](tokenString, testSecret, jwt.ParseOptions{
+			Issuer:   "auth-service",
+			Audience: "deploy-api",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "p-1", parsed.ProjectID)
+		assert.Equal(t, "42", parsed.UserID)
+		assert.Equal(t, "jane@example.com", parsed.Email)
+		assert.Equal(t, []string{"project:read"}, parsed.Scopes)
+		assert.Equal(t, "acme", parsed.TenantID)
+		assert.NotEmpty(t, parsed.ID)
+	})
+
+	t.Run("Wrong audience is rejected", func(t *testing.T) {
+		tokenString, err := jwt.CreateTokenWithClaims(&jwt.Claims{UserID: "1"}, testSecret, jwt.TokenOptions{
+			TTL:      time.Hour,
+			Audience: []string{"billing-api"},
+		})
+		assert.NoError(t, err)
+
+		_, err = jwt.ParseTokenWithClaims[jwt.Claims](tokenString, testSecret, jwt.ParseOptions{Audience: "deploy-api"})
+		assert.ErrorIs(t, err, gojwt.ErrTokenInvalidAudience)
+	})
+
+	t.Run("Wrong issuer is rejected", func(t *testing.T) {
+		tokenString, err := jwt.CreateTokenWithClaims(&jwt.Claims{UserID: "1"}, testSecret, jwt.TokenOptions{
+			TTL:    time.Hour,
+			Issuer: "someone-else",
+		})
+		assert.NoError(t, err)
+
+		_, err = jwt.ParseTokenWithClaims[jwt.Claims](tokenString, testSecret, jwt.ParseOptions{Issuer: "auth-service"})
+		assert.ErrorIs(t, err, gojwt.ErrTokenInvalidIssuer)
+	})
+
+	t.Run("Not before is enforced", func(t *testing.T) {
+		tokenString, err := jwt.CreateTokenWithClaims(&jwt.Claims{UserID: "1"}, testSecret, jwt.TokenOptions{
+			TTL:       time.Hour,
+			NotBefore: time.Now().Add(10 * time.Minute),
+		})
+		assert.NoError(t, err)
+
+		_, err = jwt.ParseTokenWithClaims[jwt.Claims](tokenString, testSecret, jwt.ParseOptions{})
+		assert.ErrorIs(t, err, gojwt.ErrTokenNotValidYet)
+	})
+
+	t.Run("Leeway tolerates clock skew", func(t *testing.T) {
+		claims := &jwt.Claims{UserID: "1"}
+		claims.ExpiresAt = gojwt.NewNumericDate(time.Now().Add(-30 * time.Second))
+		tokenString, err := jwt.CreateTokenWithClaims(claims, testSecret, jwt.TokenOptions{})
+		assert.NoError(t, err)
+
+		_, err = jwt.ParseTokenWithClaims[jwt.Claims](tokenString, testSecret, jwt.ParseOptions{})
+		assert.ErrorIs(t, err, gojwt.ErrTokenExpired)
+
+		_, err = jwt.ParseTokenWithClaims[jwt.Claims](tokenString, testSecret, jwt.ParseOptions{Leeway: time.Minute})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Missing expiry is refused", func(t *testing.T) {
+		_, err := jwt.CreateTokenWithClaims(&jwt.Claims{UserID: "1"}, testSecret, jwt.TokenOptions{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,48 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RevocationStore is a denylist for issued tokens. Entries only need to live as long
+// as the tokens they reject, so implementations expire them at the given expiry.
+type RevocationStore interface {
+	// Revoke denylists a single token by its ID (jti) until expiresAt.
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeUser rejects every token of the user issued at or before the given time.
+	// Issued-at has second precision, so tokens minted later in the same second are rejected too.
+	// The entry is kept until expiresAt, which should be at least before plus the
+	// maximum access token lifetime.
+	RevokeUser(ctx context.Context, userID string, before time.Time, expiresAt time.Time) error
+	// IsRevoked reports whether a token is revoked either by ID or by a user-wide
+	// cutoff. Implementations answer both questions in a single lookup.
+	IsRevoked(ctx context.Context, tokenID string, userID string, issuedAt time.Time) (bool, error)
+}
+
+// RevokeToken denylists the token described by claims until it would have expired anyway.
+func RevokeToken(ctx context.Context, store RevocationStore, claims *Claims) error {
+	if claims.ID == "" {
+		return fmt.Errorf("token has no id to revoke")
+	}
+	expiresAt := time.Now()
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return store.Revoke(ctx, claims.ID, expiresAt)
+}
+
+// IsTokenRevoked checks claims against a RevocationStore. Impersonation tokens are
+// also revoked by a user-wide revocation of their actor.
+func IsTokenRevoked(ctx context.Context, store RevocationStore, claims *Claims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	revoked, err := store.IsRevoked(ctx, claims.ID, claims.UserID, issuedAt)
+	if err != nil || revoked || !claims.IsImpersonation() {
+		return revoked, err
+	}
+	return store.IsRevoked(ctx, "", claims.Actor.UserID, issuedAt)
+}
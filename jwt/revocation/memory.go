@@ -0,0 +1,104 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jwt"
+)
+
+// sweepInterval controls how often the memory store drops expired entries.
+const sweepInterval = time.Minute
+
+type memoryEntry struct {
+	before    time.Time // Only used for user-wide entries
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-process RevocationStore. It is suitable for tests and
+// single-instance deployments; revocations are lost on restart.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	tokens    map[string]memoryEntry
+	users     map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+var _ jwt.RevocationStore = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-memory revocation store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens: make(map[string]memoryEntry),
+		users:  make(map[string]memoryEntry),
+		now:    time.Now,
+	}
+}
+
+func (s *MemoryStore) Revoke(_ context.Context, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked()
+	if existing, ok := s.tokens[tokenID]; ok && existing.expiresAt.After(expiresAt) {
+		expiresAt = existing.expiresAt
+	}
+	s.tokens[tokenID] = memoryEntry{expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStore) RevokeUser(_ context.Context, userID string, before time.Time, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked()
+	// Like the other stores, keep the later cutoff and the later expiry.
+	if existing, ok := s.users[userID]; ok {
+		if existing.before.After(before) {
+			before = existing.before
+		}
+		if existing.expiresAt.After(expiresAt) {
+			expiresAt = existing.expiresAt
+		}
+	}
+	s.users[userID] = memoryEntry{before: before, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(_ context.Context, tokenID string, userID string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := s.now()
+
+	if tokenID != "" {
+		if e, ok := s.tokens[tokenID]; ok && now.Before(e.expiresAt) {
+			return true, nil
+		}
+	}
+	if userID != "" {
+		if e, ok := s.users[userID]; ok && now.Before(e.expiresAt) && !issuedAt.After(e.before) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sweepLocked removes expired entries at most once per sweepInterval.
+// The caller must hold the write lock.
+func (s *MemoryStore) sweepLocked() {
+	now := s.now()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.tokens {
+		if !now.Before(e.expiresAt) {
+			delete(s.tokens, k)
+		}
+	}
+	for k, e := range s.users {
+		if !now.Before(e.expiresAt) {
+			delete(s.users, k)
+		}
+	}
+}
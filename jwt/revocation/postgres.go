@@ -0,0 +1,93 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jwt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	tokenSubjectPrefix = "jti:"
+	userSubjectPrefix  = "user:"
+)
+
+// Revocation is a single denylist row. Subject is either "jti:<token id>" or
+// "user:<user id>"; RevokedBefore is only set for user-wide revocations.
+type Revocation struct {
+	Subject       string `gorm:"primaryKey"`
+	RevokedBefore *time.Time
+	ExpiresAt     time.Time `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+// TableName overrides the default table name.
+func (Revocation) TableName() string {
+	return "jwt_revocations"
+}
+
+// PostgresStore is a RevocationStore backed by a single GORM table.
+// Run db.AutoMigrate(&revocation.Revocation{}) before use.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+var _ jwt.RevocationStore = (*PostgresStore)(nil)
+
+// NewPostgresStore creates a RevocationStore that persists entries via GORM.
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	row := &Revocation{
+		Subject:   tokenSubjectPrefix + tokenID,
+		ExpiresAt: expiresAt,
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"expires_at": gorm.Expr("GREATEST(jwt_revocations.expires_at, excluded.expires_at)"),
+		}),
+	}).Create(row).Error
+}
+
+func (s *PostgresStore) RevokeUser(ctx context.Context, userID string, before time.Time, expiresAt time.Time) error {
+	row := &Revocation{
+		Subject:       userSubjectPrefix + userID,
+		RevokedBefore: &before,
+		ExpiresAt:     expiresAt,
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"revoked_before": gorm.Expr("GREATEST(jwt_revocations.revoked_before, excluded.revoked_before)"),
+			"expires_at":     gorm.Expr("GREATEST(jwt_revocations.expires_at, excluded.expires_at)"),
+		}),
+	}).Create(row).Error
+}
+
+func (s *PostgresStore) IsRevoked(ctx context.Context, tokenID string, userID string, issuedAt time.Time) (bool, error) {
+	db := s.db.WithContext(ctx)
+	match := db.Where("subject = ?", tokenSubjectPrefix+tokenID).
+		Or("subject = ? AND revoked_before >= ?", userSubjectPrefix+userID, issuedAt)
+
+	var count int64
+	err := db.Model(&Revocation{}).
+		Where("expires_at > ?", time.Now()).
+		Where(match).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DeleteExpired removes entries whose tokens can no longer be presented.
+// Call it periodically, e.g. from a worker task.
+func (s *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	res := s.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&Revocation{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,137 @@
+package revocation_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/shashtag-ventures/go-common/jwt"
+	"github.com/shashtag-ventures/go-common/jwt/revocation"
+	"github.com/shashtag-ventures/go-common/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runStoreTests exercises the RevocationStore contract shared by all implementations.
+// advance lets time pass for the store.
+func runStoreTests(t *testing.T, store jwt.RevocationStore, advance func(time.Duration)) {
+	ctx := context.Background()
+	now := time.Now()
+
+	t.Run("Revoke by token ID", func(t *testing.T) {
+		require.NoError(t, store.Revoke(ctx, "token-1", now.Add(time.Hour)))
+
+		revoked, err := store.IsRevoked(ctx, "token-1", "user-1", now)
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = store.IsRevoked(ctx, "token-2", "user-1", now)
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("Expired entries no longer match", func(t *testing.T) {
+		require.NoError(t, store.Revoke(ctx, "token-old", now.Add(-time.Minute)))
+
+		revoked, err := store.IsRevoked(ctx, "token-old", "user-1", now)
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("RevokeUser rejects tokens issued before the cutoff", func(t *testing.T) {
+		cutoff := now.Truncate(time.Second)
+		require.NoError(t, store.RevokeUser(ctx, "user-2", cutoff, now.Add(time.Hour)))
+
+		revoked, err := store.IsRevoked(ctx, "token-3", "user-2", cutoff.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = store.IsRevoked(ctx, "token-4", "user-2", cutoff.Add(time.Minute))
+		require.NoError(t, err)
+		assert.False(t, revoked)
+
+		revoked, err = store.IsRevoked(ctx, "token-5", "user-3", cutoff.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("Revoking again never shortens a revocation", func(t *testing.T) {
+		cutoff := now.Truncate(time.Second)
+		require.NoError(t, store.Revoke(ctx, "token-6", time.Now().Add(time.Hour)))
+		require.NoError(t, store.Revoke(ctx, "token-6", time.Now().Add(50*time.Millisecond)))
+		require.NoError(t, store.RevokeUser(ctx, "user-4", cutoff, time.Now().Add(time.Hour)))
+		require.NoError(t, store.RevokeUser(ctx, "user-4", cutoff.Add(-time.Hour), time.Now().Add(50*time.Millisecond)))
+		advance(100 * time.Millisecond)
+
+		revoked, err := store.IsRevoked(ctx, "token-6", "", now)
+		require.NoError(t, err)
+		assert.True(t, revoked, "expiry kept")
+
+		revoked, err = store.IsRevoked(ctx, "token-7", "user-4", cutoff.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.True(t, revoked, "cutoff and expiry kept")
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, revocation.NewMemoryStore(), time.Sleep)
+}
+
+func TestRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	store := revocation.NewRedisStore(client, "")
+	runStoreTests(t, store, mr.FastForward)
+
+	t.Run("Keys carry a TTL", func(t *testing.T) {
+		require.NoError(t, store.Revoke(context.Background(), "ttl-token", time.Now().Add(time.Hour)))
+		assert.Greater(t, mr.TTL(revocation.DefaultRedisPrefix+"jti:ttl-token"), time.Duration(0))
+	})
+}
+
+func TestPostgresStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	ctx := context.Background()
+	db, teardown := testutil.SetupTestDatabase(ctx)
+	defer teardown()
+
+	require.NoError(t, db.AutoMigrate(&revocation.Revocation{}))
+
+	store := revocation.NewPostgresStore(db)
+	runStoreTests(t, store, time.Sleep)
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		n, err := store.DeleteExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+}
+
+func TestRevokeToken(t *testing.T) {
+	ctx := context.Background()
+	store := revocation.NewMemoryStore()
+	secret := "test-secret"
+
+	tokenString, err := jwt.CreateToken("user-9", "member", secret, time.Hour)
+	require.NoError(t, err)
+	claims, err := jwt.ParseToken(tokenString, secret)
+	require.NoError(t, err)
+	require.NotEmpty(t, claims.ID)
+
+	revoked, err := jwt.IsTokenRevoked(ctx, store, claims)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, jwt.RevokeToken(ctx, store, claims))
+
+	revoked, err = jwt.IsTokenRevoked(ctx, store, claims)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
@@ -15,18 +15,26 @@ type Config struct {
 	Service string
 	Version string
 	Level   slog.Level
+	// SensitiveKeys are masked wherever they appear as attribute keys. Defaults to
+	// DefaultSensitiveKeys; pass the same list to the request logger.
+	SensitiveKeys []string
 }
 
 // New creates a new slog.Logger instance with global metadata and sensitive data masking.
 func New(cfg Config) *slog.Logger {
+	sensitive := NewSensitiveKeys(cfg.SensitiveKeys...)
+	mask := func(a slog.Attr) slog.Attr {
+		if a.Value.Kind() != slog.KindGroup && sensitive.Contains(a.Key) {
+			return slog.String(a.Key, Masked)
+		}
+		return a
+	}
+
 	opts := &slog.HandlerOptions{
 		Level: cfg.Level,
 		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
 			// 1. Mask sensitive keys
-			key := strings.ToLower(a.Key)
-			if key == "password" || key == "token" || key == "access_token" || key == "refresh_token" || key == "secret" {
-				return slog.String(a.Key, "[MASKED]")
-			}
+			a = mask(a)
 			
 			// 2. Consistent timestamp format
 			if a.Key == slog.TimeKey {
@@ -44,6 +52,9 @@ func New(cfg Config) *slog.Logger {
 		handler = tint.NewHandler(os.Stdout, &tint.Options{
 			Level:      cfg.Level,
 			TimeFormat: "15:04:05",
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				return mask(a)
+			},
 		})
 	}
 	
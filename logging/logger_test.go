@@ -87,4 +87,36 @@ func TestNew(t *testing.T) {
 		assert.Contains(t, string(out), "1.2.3")
 		assert.Contains(t, string(out), "version")
 	})
-}
\ No newline at end of file
+}
+
+func TestSensitiveKeys(t *testing.T) {
+	t.Run("Custom keys in New", func(t *testing.T) {
+		cfg := logging.Config{
+			Env:           "production",
+			SensitiveKeys: []string{"pin", "ssn"},
+		}
+
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		logger := logging.New(cfg)
+		logger.Info("Verify", slog.Group("user", "ssn", "123-45-6789"), "PIN", "0000", "password", "visible")
+
+		w.Close()
+		out, _ := io.ReadAll(r)
+		os.Stdout = oldStdout
+
+		assert.NotContains(t, string(out), "123-45-6789", "keys inside groups are masked")
+		assert.NotContains(t, string(out), "0000")
+		assert.Contains(t, string(out), "visible", "the list replaces the defaults")
+	})
+
+	t.Run("Scrubbing payloads", func(t *testing.T) {
+		keys := logging.NewSensitiveKeys("api_key")
+		assert.True(t, keys.Contains("API_KEY"))
+		assert.Equal(t, `{"api_key": "[MASKED]", "id": 1}`, keys.ScrubJSON([]byte(`{"api_key": "abc", "id": 1}`)))
+		assert.Equal(t, "api_key=%5BMASKED%5D&page=2", keys.ScrubForm("api_key=abc&page=2"))
+		assert.Equal(t, "page=2&q=x", keys.ScrubForm("page=2&q=x"), "untouched input keeps its order")
+	})
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Masked replaces the values of sensitive keys.
+const Masked = "[MASKED]"
+
+// DefaultSensitiveKeys are masked by New and by the request logger when no list is configured.
+var DefaultSensitiveKeys = []string{"password", "token", "access_token", "refresh_token", "secret"}
+
+// SensitiveKeys is a case-insensitive set of keys whose values must not be logged. The
+// same set masks log attributes (New) and request payloads (middleware.RequestLogger).
+type SensitiveKeys struct {
+	keys    map[string]struct{}
+	pattern *regexp.Regexp
+}
+
+// NewSensitiveKeys builds a SensitiveKeys from keys, or DefaultSensitiveKeys if none are given.
+func NewSensitiveKeys(keys ...string) *SensitiveKeys {
+	if len(keys) == 0 {
+		keys = DefaultSensitiveKeys
+	}
+	s := &SensitiveKeys{keys: make(map[string]struct{}, len(keys))}
+	quoted := make([]string, 0, len(keys))
+	for _, k := range keys {
+		k = strings.ToLower(k)
+		s.keys[k] = struct{}{}
+		quoted = append(quoted, regexp.QuoteMeta(k))
+	}
+	s.pattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)")\s*:\s*(?:"[^"]*"|[^,} \n\r]+)`)
+	return s
+}
+
+// Contains reports whether key is sensitive.
+func (s *SensitiveKeys) Contains(key string) bool {
+	_, ok := s.keys[strings.ToLower(key)]
+	return ok
+}
+
+// ScrubJSON masks the values of sensitive keys in a JSON payload. A regex is used rather
+// than decoding, so nested and truncated payloads are handled and key order is preserved.
+func (s *SensitiveKeys) ScrubJSON(payload []byte) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	return s.pattern.ReplaceAllString(string(payload), `$1: "`+Masked+`"`)
+}
+
+// ScrubForm masks the values of sensitive keys in a URL-encoded form or query string.
+// Payloads that do not parse are returned as is.
+func (s *SensitiveKeys) ScrubForm(payload string) string {
+	values, err := url.ParseQuery(payload)
+	if err != nil {
+		return payload
+	}
+	masked := false
+	for k := range values {
+		if s.Contains(k) {
+			values[k] = []string{Masked}
+			masked = true
+		}
+	}
+	if !masked {
+		return payload
+	}
+	return values.Encode()
+}
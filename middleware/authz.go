@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"time"
 
 	customErrors "github.com/shashtag-ventures/go-common/errors"
 	"github.com/shashtag-ventures/go-common/jsonResponse"
@@ -41,9 +42,67 @@ func AuthorizeRole(requiredRoles ...string) func(http.Handler) http.Handler {
 
 // AuthenticatedUser represents the authenticated user's information.
 type AuthenticatedUser struct {
-	ID    string
-	Email string
-	Role  string
+	ID       string
+	Email    string
+	Role     string
+	Scopes   []string
+	TenantID string
+
+	// TokenID and TokenExpiresAt identify the access token the request was
+	// authenticated with, so handlers can revoke it (e.g. on logout).
+	TokenID        string
+	TokenExpiresAt time.Time
+
+	// APIKeyID is set when the request was authenticated with an API key.
+	APIKeyID string
+
+	// SessionID is set when the request was authenticated with a server-side session.
+	// It is the session's public ID, as used for listing and revoking sessions.
+	SessionID string
+
+	// ImpersonatedBy is the real user when an admin acts as this user with an
+	// impersonation token. The other fields always describe the effective user, so
+	// authorization and data access behave exactly as for the user themselves.
+	ImpersonatedBy *AuthenticatedUser
+}
+
+// IsImpersonated reports whether the request is made by someone acting as the user.
+func (u *AuthenticatedUser) IsImpersonated() bool {
+	return u.ImpersonatedBy != nil
+}
+
+// RealUser returns the user actually making the request: the impersonator if any,
+// otherwise the user itself. Use it for audit trails.
+func (u *AuthenticatedUser) RealUser() *AuthenticatedUser {
+	if u.ImpersonatedBy != nil {
+		return u.ImpersonatedBy
+	}
+	return u
+}
+
+// DenyImpersonation rejects impersonated requests with 403, for sensitive routes such as
+// changing credentials, payment details or exporting personal data. Mount it after the
+// authentication middleware.
+func DenyImpersonation() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, ok := r.Context().Value(UserContextKey).(*AuthenticatedUser); ok && user != nil && user.IsImpersonated() {
+				jsonResponse.SendErrorResponse(w, customErrors.New("forbidden: not allowed while impersonating", customErrors.ErrForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasScope reports whether the user was granted the given scope.
+func (u *AuthenticatedUser) HasScope(scope string) bool {
+	for _, s := range u.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 // GetUserFromContext extracts the AuthenticatedUser from the request context.
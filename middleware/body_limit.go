@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+)
+
+// BodyLimitConfig limits the size of request bodies.
+type BodyLimitConfig struct {
+	MaxBytes int64 // Default limit; 0 means unlimited
+	// Routes override MaxBytes for route groups. The first match applies.
+	Routes []BodyLimitRoute
+}
+
+// BodyLimitRoute overrides the body limit for a route group and/or set of methods.
+type BodyLimitRoute struct {
+	PathPrefix string   // Route group, e.g. "/uploads"; empty matches every path
+	Methods    []string // Empty matches every method
+	MaxBytes   int64    // Negative means unlimited
+}
+
+func (c BodyLimitConfig) limitFor(r *http.Request) int64 {
+	for _, route := range c.Routes {
+		if matchesRoute(r, route.PathPrefix, route.Methods) {
+			return route.MaxBytes
+		}
+	}
+	return c.MaxBytes
+}
+
+// limitedBody remembers the unlimited body so a per-route limit can replace the
+// router-wide one instead of being capped by it.
+type limitedBody struct {
+	io.ReadCloser
+	original io.ReadCloser
+}
+
+// BodyLimitMiddleware rejects requests whose Content-Length exceeds the limit with a
+// 413 JSON response, and caps the body of all others with http.MaxBytesReader so that
+// reading past the limit fails (request.DecodeAndValidate returns a BodyTooLargeError).
+//
+// A BodyLimitMiddleware on a route replaces the limit set by an outer one, e.g.
+// MaxBodyBytes(50<<20) on an upload route behind a 1 MiB router-wide limit.
+func BodyLimitMiddleware(cfg BodyLimitConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := cfg.limitFor(r)
+			if limit == 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body := r.Body
+			if lb, ok := body.(*limitedBody); ok {
+				body = lb.original
+			}
+
+			if limit < 0 {
+				r.Body = body
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				jsonResponse.SendErrorResponse(w, customErrors.New(fmt.Sprintf("request body exceeds the limit of %d bytes", limit), customErrors.ErrTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, body, limit), original: body}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MaxBodyBytes limits the body of the wrapped route to n bytes, replacing any
+// router-wide limit. A negative n removes the limit.
+func MaxBodyBytes(n int64) func(http.Handler) http.Handler {
+	return BodyLimitMiddleware(BodyLimitConfig{MaxBytes: n})
+}
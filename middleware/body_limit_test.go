@@ -0,0 +1,88 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	type payload struct {
+		Data string `json:"data"`
+	}
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p payload
+		if err := request.DecodeAndValidate(r, &p); err != nil {
+			if request.IsBodyTooLarge(err) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := middleware.BodyLimitConfig{
+		MaxBytes: 32,
+		Routes: []middleware.BodyLimitRoute{
+			{PathPrefix: "/uploads", Methods: []string{http.MethodPost}, MaxBytes: 1024},
+			{PathPrefix: "/import", MaxBytes: -1},
+		},
+	}
+	handler := middleware.BodyLimitMiddleware(cfg)(nextHandler)
+
+	serve := func(path, body string, chunked bool) *httptest.ResponseRecorder {
+		var reader io.Reader = strings.NewReader(body)
+		if chunked {
+			reader = io.MultiReader(reader) // Hides the length from httptest
+		}
+		req := httptest.NewRequest(http.MethodPost, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	large := `{"data":"` + strings.Repeat("x", 100) + `"}`
+
+	t.Run("Small body passes", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("/items", `{"data":"x"}`, false).Code)
+	})
+
+	t.Run("Content-Length over the limit is rejected with JSON", func(t *testing.T) {
+		rr := serve("/items", large, false)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "32 bytes")
+	})
+
+	t.Run("Chunked body over the limit fails to decode", func(t *testing.T) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, serve("/items", large, true).Code)
+	})
+
+	t.Run("Route groups override the limit", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("/uploads/avatar", large, true).Code)
+		assert.Equal(t, http.StatusOK, serve("/import", large, true).Code)
+	})
+
+	t.Run("Per-route limit replaces the outer one", func(t *testing.T) {
+		route := middleware.MaxBodyBytes(1024)(nextHandler)
+		wrapped := middleware.BodyLimitMiddleware(middleware.BodyLimitConfig{MaxBytes: 32})(route)
+
+		req := httptest.NewRequest(http.MethodPost, "/avatar", io.MultiReader(strings.NewReader(large)))
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		wrapped.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
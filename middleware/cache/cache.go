@@ -0,0 +1,465 @@
+// Package cache implements a server-side HTTP response cache for GET endpoints that
+// are expensive to compute and tolerate short staleness.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/middleware"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// HeaderStatus reports how a response was served: HIT, MISS or BYPASS.
+	HeaderStatus = "X-Cache"
+
+	// DefaultTTL is how long responses are cached when the handler sets no max-age.
+	DefaultTTL = time.Minute
+	// DefaultMaxBodySize bounds the size of cached responses. Larger responses are
+	// streamed to the client and not cached.
+	DefaultMaxBodySize = 1 << 20
+)
+
+// Entry is a cached response.
+type Entry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Tags       []string
+	StoredAt   time.Time
+}
+
+// Store persists cached responses.
+type Store interface {
+	// Get returns the entry for key, or nil with a nil error on a miss.
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Set stores the entry for ttl and indexes it under its tags.
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+	// Delete removes entries by key.
+	Delete(ctx context.Context, keys ...string) error
+	// InvalidateTags removes every entry stored with any of the tags.
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+// Config holds the settings for Middleware.
+type Config struct {
+	Store Store
+	// TTL applies when the handler sets no max-age or s-maxage. Defaults to DefaultTTL.
+	TTL time.Duration
+	// VaryByUser keys entries by the authenticated user, for per-user responses. When
+	// false, requests with an authenticated user bypass the cache, so a shared entry
+	// can never contain one user's data.
+	VaryByUser bool
+	// VaryHeaders are request headers whose values are part of the key, e.g. Accept-Language.
+	VaryHeaders []string
+	// Tags returns tags for every entry stored for r, e.g. "project:<id>" from the
+	// route. Handlers can add more with AddTags.
+	Tags func(r *http.Request) []string
+	// MaxBodySize defaults to DefaultMaxBodySize.
+	MaxBodySize int
+}
+
+// skippedHeaders are set per response and are neither stored nor replayed.
+var skippedHeaders = map[string]bool{
+	"Date":                  true,
+	"Set-Cookie":            true,
+	"X-Request-Id":          true,
+	"X-Ratelimit-Limit":     true,
+	"X-Ratelimit-Remaining": true,
+	"X-Ratelimit-Reset":     true,
+}
+
+// cacheableStatus lists the status codes that are cacheable by default (RFC 9110 15.1).
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// Middleware caches GET responses in cfg.Store. Keys are built from the host, the
+// tenant (see middleware.GetTenantID), the path, the query (in canonical order),
+// cfg.VaryHeaders and, with VaryByUser, the user ID. HEAD requests are answered from
+// cached GET responses.
+//
+// Handlers control caching with the Cache-Control response header: no-store,
+// no-cache and private (unless VaryByUser) responses are not stored, and s-maxage or
+// max-age override cfg.TTL. Responses with Set-Cookie, a Vary header naming request
+// headers outside cfg.VaryHeaders, uncacheable status codes, bodies over MaxBodySize
+// and streamed (flushed) responses are not stored either.
+//
+// Concurrent misses for the same key are coalesced: one request runs the handler and
+// the others wait for its response. If that response turns out not to be cacheable,
+// the waiters run the handler themselves.
+//
+// Store errors are logged and the request is served uncached. It must run after
+// authentication when VaryByUser is set. It panics without a Store.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	if cfg.Store == nil {
+		panic("cache: Middleware requires a Store")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	var group singleflight.Group
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, _ := middleware.GetUserFromContext(r.Context())
+			if user != nil && !cfg.VaryByUser {
+				w.Header().Set(HeaderStatus, "BYPASS")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			logger := middleware.GetLoggerFromContext(ctx)
+			key := cfg.key(r, user)
+
+			entry, err := cfg.Store.Get(ctx, key)
+			if err != nil {
+				logger.Error("Failed to read response cache", "error", err)
+			}
+			if entry != nil {
+				replay(w, r, entry, "HIT")
+				return
+			}
+			if r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			leader := false
+			v, _, _ := group.Do(key, func() (any, error) {
+				leader = true
+				return cfg.fill(w, r, next, key), nil
+			})
+			res := v.(*result)
+
+			switch {
+			case leader && res.panicked != nil:
+				panic(res.panicked)
+			case leader && res.streamed:
+				// Already written to the client.
+			case res.entry != nil:
+				status := "HIT"
+				if leader {
+					status = "MISS"
+				}
+				replay(w, r, res.entry, status)
+			default:
+				// The response was not cacheable, so it may be specific to the request
+				// that produced it; everyone else computes their own.
+				if leader {
+					replay(w, r, res.uncached, "MISS")
+					return
+				}
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// result is the outcome of running the handler for a cache miss.
+type result struct {
+	entry    *Entry // Set if the response was stored
+	uncached *Entry // The buffered response if it was not cacheable
+	streamed bool   // The response was written to the leader's client directly
+	panicked any    // The handler panicked with this value
+}
+
+// fill runs the handler, stores its response if it is cacheable, and returns it.
+// Panics are returned rather than raised, so that only the leader re-raises them (with
+// the original stack, for the recovery middleware) and waiters retry on their own.
+func (c Config) fill(w http.ResponseWriter, r *http.Request, next http.Handler, key string) (res *result) {
+	defer func() {
+		if p := recover(); p != nil {
+			res = &result{panicked: middleware.WrapPanic(p)}
+		}
+	}()
+
+	tags := &tagSet{}
+	tags.add(c.tags(r)...)
+	ctx := context.WithValue(r.Context(), tagsKey{}, tags)
+
+	bw := &bufferingWriter{ResponseWriter: w, header: make(http.Header), statusCode: http.StatusOK, maxSize: c.MaxBodySize}
+	next.ServeHTTP(bw, r.WithContext(ctx))
+	if bw.streaming {
+		return &result{streamed: true}
+	}
+
+	entry := &Entry{
+		StatusCode: bw.statusCode,
+		Header:     bw.header,
+		Body:       bw.body.Bytes(),
+		Tags:       tags.list(),
+		StoredAt:   time.Now(),
+	}
+	ttl, ok := c.ttl(entry)
+	if !ok {
+		return &result{uncached: entry}
+	}
+
+	stored := *entry
+	stored.Header = storedHeader(entry.Header)
+	if err := c.Store.Set(context.WithoutCancel(ctx), key, &stored, ttl); err != nil {
+		middleware.GetLoggerFromContext(ctx).Error("Failed to write response cache", "error", err)
+	}
+	return &result{entry: entry}
+}
+
+// ttl decides whether the response may be stored and for how long.
+func (c Config) ttl(e *Entry) (time.Duration, bool) {
+	if !cacheableStatus[e.StatusCode] || len(e.Header.Values("Set-Cookie")) > 0 || !c.coversVary(e.Header) {
+		return 0, false
+	}
+
+	directives := parseCacheControl(e.Header.Values("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["no-cache"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["private"]; ok && !c.VaryByUser {
+		return 0, false
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if v, ok := directives[name]; ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return c.TTL, true
+}
+
+// coversVary reports whether every request header named by the response's Vary header
+// is part of the key, so that a stored response is only served to matching requests.
+func (c Config) coversVary(h http.Header) bool {
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" || !slices.ContainsFunc(c.VaryHeaders, func(vary string) bool {
+				return strings.EqualFold(vary, name)
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (c Config) tags(r *http.Request) []string {
+	if c.Tags == nil {
+		return nil
+	}
+	return c.Tags(r)
+}
+
+// key builds the cache key of a request. HEAD shares the key of GET.
+func (c Config) key(r *http.Request, user *middleware.AuthenticatedUser) string {
+	h := sha256.New()
+	write := func(s string) {
+		// Length prefixes keep ("ab","c") and ("a","bc") apart.
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	// Tenants resolved from the host or from auth must never share entries.
+	write(strings.ToLower(r.Host))
+	write(middleware.GetTenantID(r.Context()))
+	write(r.URL.Path)
+	write(r.URL.Query().Encode())
+	for _, name := range c.VaryHeaders {
+		write(strings.Join(r.Header.Values(name), ","))
+	}
+	if c.VaryByUser && user != nil {
+		write(user.ID)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseCacheControl returns the directives of Cache-Control header values, with
+// lower-cased names and unquoted arguments.
+func parseCacheControl(values []string) map[string]string {
+	directives := make(map[string]string)
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+func storedHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, values := range h {
+		if skippedHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		out[k] = append([]string(nil), values...)
+	}
+	return out
+}
+
+func replay(w http.ResponseWriter, r *http.Request, e *Entry, status string) {
+	for k, values := range e.Header {
+		// The request that produced the response gets all of its headers.
+		if status != "MISS" && skippedHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		w.Header()[k] = append([]string(nil), values...)
+	}
+	w.Header().Set(HeaderStatus, status)
+	if status == "HIT" && !e.StoredAt.IsZero() {
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(e.StoredAt).Seconds())))
+	}
+	w.WriteHeader(e.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(e.Body)
+	}
+}
+
+// bufferingWriter buffers the response so it can be stored and shared with coalesced
+// requests. It switches to writing through once the body exceeds maxSize or the
+// handler flushes.
+type bufferingWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	statusCode  int
+	body        bytes.Buffer
+	maxSize     int
+	wroteHeader bool
+	streaming   bool
+}
+
+func (bw *bufferingWriter) Header() http.Header {
+	if bw.streaming {
+		return bw.ResponseWriter.Header()
+	}
+	return bw.header
+}
+
+func (bw *bufferingWriter) WriteHeader(code int) {
+	if bw.streaming {
+		bw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if !bw.wroteHeader {
+		bw.wroteHeader = true
+		bw.statusCode = code
+	}
+}
+
+func (bw *bufferingWriter) Write(data []byte) (int, error) {
+	if !bw.streaming {
+		if !bw.wroteHeader {
+			bw.WriteHeader(http.StatusOK)
+		}
+		if bw.body.Len()+len(data) <= bw.maxSize {
+			return bw.body.Write(data)
+		}
+		bw.startStreaming()
+	}
+	return bw.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher. A flushing handler is streaming, so its response is
+// written through and not cached.
+func (bw *bufferingWriter) Flush() {
+	if !bw.streaming {
+		bw.startStreaming()
+	}
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (bw *bufferingWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// startStreaming writes the buffered header and body to the client and passes
+// everything after it through.
+func (bw *bufferingWriter) startStreaming() {
+	bw.streaming = true
+	for k, values := range bw.header {
+		bw.ResponseWriter.Header()[k] = values
+	}
+	bw.ResponseWriter.Header().Set(HeaderStatus, "MISS")
+	bw.ResponseWriter.WriteHeader(bw.statusCode)
+	if bw.body.Len() > 0 {
+		bw.ResponseWriter.Write(bw.body.Bytes())
+		bw.body.Reset()
+	}
+}
+
+type tagsKey struct{}
+
+// tagSet collects the tags of the response being computed.
+type tagSet struct {
+	mu   sync.Mutex
+	tags []string
+}
+
+func (s *tagSet) add(tags ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range tags {
+		if tag != "" {
+			s.tags = append(s.tags, tag)
+		}
+	}
+}
+
+func (s *tagSet) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tags...)
+}
+
+// AddTags tags the response being cached, so that it can be dropped with
+// Store.InvalidateTags when the data it shows changes:
+//
+//	cache.AddTags(r.Context(), "project:"+project.ID, "org:"+project.OrgID)
+//
+// It is a no-op outside the cache middleware.
+func AddTags(ctx context.Context, tags ...string) {
+	if s, ok := ctx.Value(tagsKey{}).(*tagSet); ok {
+		s.add(tags...)
+	}
+}
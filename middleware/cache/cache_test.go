@@ -0,0 +1,361 @@
+package cache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/middleware/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runStoreTests exercises the Store contract shared by all implementations.
+func runStoreTests(t *testing.T, store cache.Store) {
+	ctx := context.Background()
+	entry := func(body string, tags ...string) *cache.Entry {
+		return &cache.Entry{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       []byte(body),
+			Tags:       tags,
+			StoredAt:   time.Now(),
+		}
+	}
+
+	t.Run("Set and Get", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "k1", entry(`{"id":1}`, "project:1"), time.Minute))
+
+		got, err := store.Get(ctx, "k1")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, http.StatusOK, got.StatusCode)
+		assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+		assert.Equal(t, `{"id":1}`, string(got.Body))
+
+		missing, err := store.Get(ctx, "nope")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "k2", entry("2"), time.Minute))
+		require.NoError(t, store.Delete(ctx, "k2", "unknown"))
+
+		got, err := store.Get(ctx, "k2")
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("InvalidateTags", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "a", entry("a", "project:1", "org:1"), time.Minute))
+		require.NoError(t, store.Set(ctx, "b", entry("b", "project:2", "org:1"), time.Minute))
+		require.NoError(t, store.Set(ctx, "c", entry("c", "project:3"), time.Minute))
+
+		require.NoError(t, store.InvalidateTags(ctx, "org:1"))
+		for key, want := range map[string]bool{"a": false, "b": false, "c": true} {
+			got, err := store.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, want, got != nil, key)
+		}
+	})
+
+	t.Run("Entries expire", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "short", entry("s"), 5*time.Millisecond))
+		time.Sleep(20 * time.Millisecond)
+
+		got, err := store.Get(ctx, "short")
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, cache.NewMemoryStore(0))
+
+	t.Run("Evicts the least recently used entry", func(t *testing.T) {
+		ctx := context.Background()
+		store := cache.NewMemoryStore(2)
+		for _, key := range []string{"a", "b"} {
+			require.NoError(t, store.Set(ctx, key, &cache.Entry{StatusCode: http.StatusOK, Tags: []string{"t"}}, time.Minute))
+		}
+		_, _ = store.Get(ctx, "a")
+		require.NoError(t, store.Set(ctx, "c", &cache.Entry{StatusCode: http.StatusOK}, time.Minute))
+
+		assert.Equal(t, 2, store.Len())
+		b, _ := store.Get(ctx, "b")
+		assert.Nil(t, b)
+		a, _ := store.Get(ctx, "a")
+		assert.NotNil(t, a)
+	})
+}
+
+func TestRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	// miniredis does not expire keys on its own, so drive its clock from the real one.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				mr.FastForward(time.Millisecond)
+			}
+		}
+	}()
+
+	runStoreTests(t, cache.NewRedisStore(client, ""))
+
+	t.Run("Keys share a cluster hash slot", func(t *testing.T) {
+		ctx := context.Background()
+		for prefix, want := range map[string]string{"app:": "{app:}", "{app}:cache:": "{app}:cache:"} {
+			store := cache.NewRedisStore(client, prefix)
+			require.NoError(t, store.Set(ctx, "k", &cache.Entry{StatusCode: http.StatusOK, Tags: []string{"t"}}, time.Minute))
+			assert.True(t, mr.Exists(want+"entry:k"), prefix)
+			assert.True(t, mr.Exists(want+"tag:t"), prefix)
+		}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls atomic.Int32
+	var mu sync.Mutex
+	cacheControl := ""
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		cache.AddTags(r.Context(), "repos:"+r.URL.Query().Get("owner"))
+		mu.Lock()
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("x", int(n))))
+	})
+	setCacheControl := func(v string) {
+		mu.Lock()
+		cacheControl = v
+		mu.Unlock()
+	}
+
+	store := cache.NewMemoryStore(0)
+	serve := func(h http.Handler, method, target string, user *middleware.AuthenticatedUser) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, user))
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	reset := func() {
+		calls.Store(0)
+		setCacheControl("")
+		require.NoError(t, store.InvalidateTags(context.Background(), "repos:acme", "repos:"))
+	}
+
+	shared := cache.Middleware(cache.Config{Store: store})(handler)
+
+	t.Run("Miss then hit with canonical query", func(t *testing.T) {
+		reset()
+		rr := serve(shared, http.MethodGet, "/repos?owner=acme&page=2", nil)
+		assert.Equal(t, "MISS", rr.Header().Get(cache.HeaderStatus))
+		assert.Equal(t, "x", rr.Body.String())
+
+		rr = serve(shared, http.MethodGet, "/repos?page=2&owner=acme", nil)
+		assert.Equal(t, "HIT", rr.Header().Get(cache.HeaderStatus))
+		assert.Equal(t, "x", rr.Body.String())
+		assert.Equal(t, "text/plain", rr.Header().Get("Content-Type"))
+		assert.NotEmpty(t, rr.Header().Get("Age"))
+
+		rr = serve(shared, http.MethodHead, "/repos?owner=acme&page=2", nil)
+		assert.Equal(t, "HIT", rr.Header().Get(cache.HeaderStatus))
+		assert.Empty(t, rr.Body.String())
+
+		rr = serve(shared, http.MethodGet, "/repos?owner=acme&page=3", nil)
+		assert.Equal(t, "MISS", rr.Header().Get(cache.HeaderStatus))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Tag invalidation", func(t *testing.T) {
+		reset()
+		serve(shared, http.MethodGet, "/repos?owner=acme", nil)
+		require.NoError(t, store.InvalidateTags(context.Background(), "repos:acme"))
+
+		rr := serve(shared, http.MethodGet, "/repos?owner=acme", nil)
+		assert.Equal(t, "MISS", rr.Header().Get(cache.HeaderStatus))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Handler Cache-Control is honored", func(t *testing.T) {
+		for _, directive := range []string{"no-store", "no-cache", "private", "max-age=0"} {
+			reset()
+			setCacheControl(directive)
+			serve(shared, http.MethodGet, "/repos?owner=acme", nil)
+			rr := serve(shared, http.MethodGet, "/repos?owner=acme", nil)
+			assert.Equal(t, "MISS", rr.Header().Get(cache.HeaderStatus), directive)
+			assert.Equal(t, directive, rr.Header().Get("Cache-Control"))
+			assert.Equal(t, int32(2), calls.Load(), directive)
+		}
+
+		reset()
+		setCacheControl("public, max-age=60")
+		serve(shared, http.MethodGet, "/repos?owner=acme", nil)
+		assert.Equal(t, "HIT", serve(shared, http.MethodGet, "/repos?owner=acme", nil).Header().Get(cache.HeaderStatus))
+	})
+
+	t.Run("Authenticated requests bypass a shared cache", func(t *testing.T) {
+		reset()
+		user := &middleware.AuthenticatedUser{ID: "u1"}
+		assert.Equal(t, "BYPASS", serve(shared, http.MethodGet, "/repos?owner=acme", user).Header().Get(cache.HeaderStatus))
+		assert.Equal(t, "BYPASS", serve(shared, http.MethodGet, "/repos?owner=acme", user).Header().Get(cache.HeaderStatus))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("VaryByUser", func(t *testing.T) {
+		reset()
+		perUser := cache.Middleware(cache.Config{Store: store, VaryByUser: true})(handler)
+		alice := &middleware.AuthenticatedUser{ID: "alice"}
+		bob := &middleware.AuthenticatedUser{ID: "bob"}
+
+		assert.Equal(t, "x", serve(perUser, http.MethodGet, "/repos?owner=acme", alice).Body.String())
+		assert.Equal(t, "xx", serve(perUser, http.MethodGet, "/repos?owner=acme", bob).Body.String())
+		rr := serve(perUser, http.MethodGet, "/repos?owner=acme", alice)
+		assert.Equal(t, "HIT", rr.Header().Get(cache.HeaderStatus))
+		assert.Equal(t, "x", rr.Body.String())
+	})
+
+	t.Run("Hosts and tenants do not share entries", func(t *testing.T) {
+		reset()
+		get := func(host, tenantID string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "http://"+host+"/repos?owner=acme", nil)
+			if tenantID != "" {
+				req = req.WithContext(middleware.WithTenantID(req.Context(), tenantID))
+			}
+			rr := httptest.NewRecorder()
+			shared.ServeHTTP(rr, req)
+			return rr
+		}
+		assert.Equal(t, "x", get("acme.example.com", "").Body.String())
+		assert.Equal(t, "xx", get("globex.example.com", "").Body.String())
+		assert.Equal(t, "xxx", get("api.example.com", "acme").Body.String())
+		assert.Equal(t, "xxxx", get("api.example.com", "globex").Body.String())
+		assert.Equal(t, "HIT", get("ACME.example.com", "").Header().Get(cache.HeaderStatus))
+	})
+
+	t.Run("Vary outside VaryHeaders is not stored", func(t *testing.T) {
+		varying := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte(r.Header.Get("Accept-Language")))
+		})
+		for name, cfg := range map[string]cache.Config{
+			"MISS": {Store: store},
+			"HIT":  {Store: store, VaryHeaders: []string{"accept-language"}},
+		} {
+			reset()
+			h := cache.Middleware(cfg)(varying)
+			serve(h, http.MethodGet, "/greeting", nil)
+			assert.Equal(t, name, serve(h, http.MethodGet, "/greeting", nil).Header().Get(cache.HeaderStatus))
+		}
+	})
+
+	t.Run("Large and non-GET responses are not cached", func(t *testing.T) {
+		reset()
+		calls.Store(1) // Bodies of two bytes and more
+		small := cache.Middleware(cache.Config{Store: store, MaxBodySize: 1})(handler)
+		serve(small, http.MethodGet, "/repos?owner=acme", nil)
+		rr := serve(small, http.MethodGet, "/repos?owner=acme", nil)
+		assert.Equal(t, "MISS", rr.Header().Get(cache.HeaderStatus))
+		assert.Equal(t, "xxx", rr.Body.String())
+
+		serve(shared, http.MethodPost, "/repos?owner=acme", nil)
+		assert.Empty(t, serve(shared, http.MethodPost, "/repos?owner=acme", nil).Header().Get(cache.HeaderStatus))
+	})
+
+	t.Run("Panics propagate", func(t *testing.T) {
+		panicking := cache.Middleware(cache.Config{Store: store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			serve(panicking, http.MethodGet, "/boom", nil)
+		})
+
+		var origin string
+		recovered := middleware.RecoveryMiddleware(middleware.RecoveryConfig{Reporters: []middleware.PanicReporter{
+			middleware.PanicReporterFunc(func(ctx context.Context, report middleware.PanicReport) error {
+				origin = report.Origin
+				return nil
+			}),
+		}})(cache.Middleware(cache.Config{Store: store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})))
+		assert.Equal(t, http.StatusInternalServerError, serve(recovered, http.MethodGet, "/boom", nil).Code)
+		assert.Contains(t, origin, "cache_test.go:")
+	})
+}
+
+func TestMiddlewareCoalescing(t *testing.T) {
+	const requests = 10
+	var calls atomic.Int32
+	release := make(chan struct{})
+	cacheable := true
+
+	h := cache.Middleware(cache.Config{Store: cache.NewMemoryStore(0)})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-release
+		}
+		if !cacheable {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Write([]byte("done"))
+	}))
+
+	run := func(path string) []*httptest.ResponseRecorder {
+		calls.Store(0)
+		results := make([]*httptest.ResponseRecorder, requests)
+		var wg sync.WaitGroup
+		for i := range results {
+			results[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(rr *httptest.ResponseRecorder) {
+				defer wg.Done()
+				h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			}(results[i])
+		}
+		// Let the requests pile up on the first one before it completes.
+		require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		release <- struct{}{}
+		wg.Wait()
+		return results
+	}
+
+	t.Run("Cold key computes once", func(t *testing.T) {
+		for _, rr := range run("/cold") {
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "done", rr.Body.String())
+		}
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("Uncacheable responses are not shared", func(t *testing.T) {
+		cacheable = false
+		for _, rr := range run("/private") {
+			assert.Equal(t, "done", rr.Body.String())
+		}
+		assert.Equal(t, int32(requests), calls.Load())
+	})
+}
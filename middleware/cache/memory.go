@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries is the capacity of a MemoryStore created with maxEntries <= 0.
+const DefaultMaxEntries = 1000
+
+type memoryItem struct {
+	key       string
+	entry     *Entry
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-process LRU Store. When full, the least recently used entry is
+// evicted. It is suitable for single-instance deployments; with several instances,
+// invalidation only reaches the instance it runs on, so prefer RedisStore.
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	lru        *list.List // Front is most recently used
+	items      map[string]*list.Element
+	tags       map[string]map[string]struct{}
+	now        func() time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty store holding up to maxEntries responses.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		items:      make(map[string]*list.Element),
+		tags:       make(map[string]map[string]struct{}),
+		now:        time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := el.Value.(*memoryItem)
+	if !s.now().Before(item.expiresAt) {
+		s.removeLocked(el)
+		return nil, nil
+	}
+	s.lru.MoveToFront(el)
+	return item.entry, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, entry *Entry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.removeLocked(el)
+	}
+
+	s.items[key] = s.lru.PushFront(&memoryItem{key: key, entry: entry, expiresAt: s.now().Add(ttl)})
+	for _, tag := range entry.Tags {
+		keys, ok := s.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			s.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	for s.lru.Len() > s.maxEntries {
+		s.removeLocked(s.lru.Back())
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := s.items[key]; ok {
+			s.removeLocked(el)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) InvalidateTags(_ context.Context, tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			if el, ok := s.items[key]; ok {
+				s.removeLocked(el)
+			}
+		}
+		delete(s.tags, tag)
+	}
+	return nil
+}
+
+// Len returns the number of stored entries, including expired ones not yet evicted.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// removeLocked drops an entry and its tag index entries. The caller must hold the lock.
+func (s *MemoryStore) removeLocked(el *list.Element) {
+	item := s.lru.Remove(el).(*memoryItem)
+	delete(s.items, item.key)
+	for _, tag := range item.entry.Tags {
+		if keys, ok := s.tags[tag]; ok {
+			delete(keys, item.key)
+			if len(keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+}
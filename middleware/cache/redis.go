@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix is the key prefix used when none is configured.
+const DefaultRedisPrefix = "{httpcache}:"
+
+// RedisStore is a Store backed by Redis, shared by all instances of a service. Entries
+// expire with Redis TTLs; each tag is a set of the keys stored with it.
+//
+// Storing and invalidating touch an entry and its tag sets in one script, so with
+// Redis Cluster all keys must share a hash slot. The prefix therefore always contains
+// a hash tag, which puts the whole cache on a single node.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a Store using the given Redis client.
+// An empty prefix falls back to DefaultRedisPrefix. A prefix without a hash tag is
+// wrapped in one, e.g. "app:" becomes "{app:}".
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	if !hasHashTag(prefix) {
+		prefix = "{" + prefix + "}"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// hasHashTag reports whether s contains a non-empty {...} section, which Redis Cluster
+// hashes instead of the whole key.
+func hasHashTag(s string) bool {
+	start := strings.IndexByte(s, '{')
+	if start < 0 {
+		return false
+	}
+	end := strings.IndexByte(s[start+1:], '}')
+	return end > 0
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (*Entry, error) {
+	raw, err := s.client.Get(ctx, s.entryKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// setScript stores the entry and adds its key to each tag set. A tag set lives as long
+// as its longest-lived entry, so it is only ever extended.
+var setScript = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+for i = 2, #KEYS do
+	redis.call("SADD", KEYS[i], KEYS[1])
+	if redis.call("PTTL", KEYS[i]) < ttl then
+		redis.call("PEXPIRE", KEYS[i], ttl)
+	end
+end
+return 1
+`)
+
+func (s *RedisStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(entry.Tags)+1)
+	keys = append(keys, s.entryKey(key))
+	for _, tag := range entry.Tags {
+		keys = append(keys, s.tagKey(tag))
+	}
+	return setScript.Run(ctx, s.client, keys, data, ttl.Milliseconds()).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = s.entryKey(key)
+	}
+	return s.client.Del(ctx, redisKeys...).Err()
+}
+
+// invalidateScript deletes every entry in the tag sets, then the sets themselves.
+var invalidateScript = redis.NewScript(`
+for _, tag in ipairs(KEYS) do
+	for _, key in ipairs(redis.call("SMEMBERS", tag)) do
+		redis.call("DEL", key)
+	end
+	redis.call("DEL", tag)
+end
+return 1
+`)
+
+func (s *RedisStore) InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = s.tagKey(tag)
+	}
+	return invalidateScript.Run(ctx, s.client, keys).Err()
+}
+
+func (s *RedisStore) entryKey(key string) string {
+	return s.prefix + "entry:" + key
+}
+
+func (s *RedisStore) tagKey(tag string) string {
+	return s.prefix + "tag:" + tag
+}
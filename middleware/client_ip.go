@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPKey is the context key under which ClientIPMiddleware stores the resolved client IP.
+const ClientIPKey CtxKey = "clientIP"
+
+// Headers understood by the client IP resolver.
+const (
+	HeaderCloudflareIP = "CF-Connecting-IP"
+	HeaderForwardedFor = "X-Forwarded-For"
+	HeaderRealIP       = "X-Real-IP"
+	HeaderTrueClientIP = "True-Client-IP"
+)
+
+// CloudflareRanges are the published Cloudflare edge ranges (https://www.cloudflare.com/ips/).
+var CloudflareRanges = []string{
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+	"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+	"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+	"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+}
+
+// GCPLoadBalancerRanges are the source ranges of Google Cloud external HTTP(S) load balancers.
+var GCPLoadBalancerRanges = []string{"130.211.0.0/22", "35.191.0.0/16"}
+
+// PrivateRanges covers loopback and private networks, for proxies on the same host or VPC.
+var PrivateRanges = []string{
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+	"::1/128", "fc00::/7",
+}
+
+// ClientIPConfig configures how the client IP is resolved.
+// With no trusted proxies, forwarding headers are ignored and the peer address is used,
+// so clients cannot spoof their IP.
+type ClientIPConfig struct {
+	// TrustedProxies lists the CIDRs or IPs of proxies allowed to set forwarding headers.
+	TrustedProxies []string
+	// Headers lists the headers to consult, in order of preference, when the peer is trusted.
+	// Single-value headers such as CF-Connecting-IP are taken as is; X-Forwarded-For is
+	// walked from the right, skipping trusted proxies. Defaults to X-Forwarded-For.
+	Headers []string
+	// SkipForwardedHops drops this many entries from the right of X-Forwarded-For before
+	// the walk, for proxies that append an address of their own that is not a peer
+	// address and so cannot be listed in TrustedProxies.
+	SkipForwardedHops int
+}
+
+// CloudflareClientIPConfig trusts Cloudflare edges and reads CF-Connecting-IP.
+func CloudflareClientIPConfig() ClientIPConfig {
+	return ClientIPConfig{TrustedProxies: CloudflareRanges, Headers: []string{HeaderCloudflareIP}}
+}
+
+// GCPLoadBalancerClientIPConfig trusts Google Cloud load balancers, which append
+// "<client IP>, <forwarding rule IP>" to X-Forwarded-For. The forwarding rule IP is the
+// load balancer's external address, not one of GCPLoadBalancerRanges, so the last hop
+// is skipped.
+func GCPLoadBalancerClientIPConfig() ClientIPConfig {
+	return ClientIPConfig{
+		TrustedProxies:    GCPLoadBalancerRanges,
+		Headers:           []string{HeaderForwardedFor},
+		SkipForwardedHops: 1,
+	}
+}
+
+// ClientIPResolver resolves the client IP of a request according to a ClientIPConfig.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+	headers []string
+	skip    int
+}
+
+// NewClientIPResolver validates the config and returns a resolver.
+func NewClientIPResolver(cfg ClientIPConfig) (*ClientIPResolver, error) {
+	if cfg.SkipForwardedHops < 0 {
+		return nil, fmt.Errorf("invalid SkipForwardedHops %d", cfg.SkipForwardedHops)
+	}
+	res := &ClientIPResolver{headers: cfg.Headers, skip: cfg.SkipForwardedHops}
+	if len(res.headers) == 0 {
+		res.headers = []string{HeaderForwardedFor}
+	}
+
+	for _, entry := range cfg.TrustedProxies {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy CIDR %q: %w", entry, err)
+			}
+			res.trusted = append(res.trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy IP %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		res.trusted = append(res.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return res, nil
+}
+
+// Resolve returns the client IP of r. Forwarding headers are only honoured when the
+// direct peer is a trusted proxy.
+func (c *ClientIPResolver) Resolve(r *http.Request) string {
+	peer, ok := parseIP(remoteHost(r.RemoteAddr))
+	if !ok {
+		return remoteHost(r.RemoteAddr)
+	}
+	if !c.isTrusted(peer) {
+		return peer.String()
+	}
+
+	for _, header := range c.headers {
+		if strings.EqualFold(header, HeaderForwardedFor) {
+			if ip, ok := c.fromForwardedFor(r.Header.Values(HeaderForwardedFor)); ok {
+				return ip.String()
+			}
+			continue
+		}
+		if ip, ok := parseIP(r.Header.Get(header)); ok {
+			return ip.String()
+		}
+	}
+	return peer.String()
+}
+
+// fromForwardedFor returns the rightmost address that is not a trusted proxy, after
+// dropping the hops to skip. Entries to its left were supplied by the client and cannot
+// be trusted. If every entry is trusted, the leftmost one is the best guess.
+func (c *ClientIPResolver) fromForwardedFor(values []string) (netip.Addr, bool) {
+	var hops []string
+	for _, v := range values {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	hops = hops[:max(len(hops)-c.skip, 0)]
+
+	var leftmost netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseIP(hops[i])
+		if !ok {
+			// A malformed hop means everything further left is unverifiable.
+			break
+		}
+		if !c.isTrusted(ip) {
+			return ip, true
+		}
+		leftmost = ip
+	}
+	return leftmost, leftmost.IsValid()
+}
+
+func (c *ClientIPResolver) isTrusted(ip netip.Addr) bool {
+	for _, prefix := range c.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIP(s string) (netip.Addr, bool) {
+	ip, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+func remoteHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// ClientIPMiddleware resolves the client IP once per request and stores it in the
+// context for logging, rate limiting and auditing. It panics on an invalid config.
+func ClientIPMiddleware(cfg ClientIPConfig) func(http.Handler) http.Handler {
+	resolver, err := NewClientIPResolver(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("ClientIPConfig: %v", err))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ClientIPKey, resolver.Resolve(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetClientIPFromContext returns the IP stored by ClientIPMiddleware.
+func GetClientIPFromContext(ctx context.Context) string {
+	if ip, ok := ctx.Value(ClientIPKey).(string); ok {
+		return ip
+	}
+	return ""
+}
+
+// ClientIP returns the client IP resolved by ClientIPMiddleware, falling back to the
+// peer address. It never trusts forwarding headers on its own.
+func ClientIP(r *http.Request) string {
+	if ip := GetClientIPFromContext(r.Context()); ip != "" {
+		return ip
+	}
+	return remoteHost(r.RemoteAddr)
+}
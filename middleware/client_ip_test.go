@@ -0,0 +1,139 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	newRequest := func(remoteAddr string, headers map[string]string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+
+	t.Run("Untrusted peers cannot spoof headers", func(t *testing.T) {
+		res, err := middleware.NewClientIPResolver(middleware.ClientIPConfig{})
+		require.NoError(t, err)
+
+		req := newRequest("203.0.113.7:5555", map[string]string{
+			"X-Forwarded-For":  "1.1.1.1",
+			"CF-Connecting-IP": "2.2.2.2",
+		})
+		assert.Equal(t, "203.0.113.7", res.Resolve(req))
+	})
+
+	t.Run("X-Forwarded-For takes the rightmost untrusted hop", func(t *testing.T) {
+		res, err := middleware.NewClientIPResolver(middleware.ClientIPConfig{
+			TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"},
+		})
+		require.NoError(t, err)
+
+		req := newRequest("10.0.0.5:443", map[string]string{
+			"X-Forwarded-For": "6.6.6.6, 198.51.100.9, 192.0.2.1, 10.1.2.3",
+		})
+		assert.Equal(t, "198.51.100.9", res.Resolve(req))
+	})
+
+	t.Run("All hops trusted falls back to the leftmost", func(t *testing.T) {
+		res, err := middleware.NewClientIPResolver(middleware.ClientIPConfig{TrustedProxies: middleware.PrivateRanges})
+		require.NoError(t, err)
+
+		req := newRequest("127.0.0.1:443", map[string]string{"X-Forwarded-For": "10.0.0.9, 10.0.0.1"})
+		assert.Equal(t, "10.0.0.9", res.Resolve(req))
+	})
+
+	t.Run("Malformed hops stop the walk", func(t *testing.T) {
+		res, err := middleware.NewClientIPResolver(middleware.ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+		require.NoError(t, err)
+
+		req := newRequest("10.0.0.5:443", map[string]string{"X-Forwarded-For": "garbage"})
+		assert.Equal(t, "10.0.0.5", res.Resolve(req))
+	})
+
+	t.Run("Cloudflare", func(t *testing.T) {
+		res, err := middleware.NewClientIPResolver(middleware.CloudflareClientIPConfig())
+		require.NoError(t, err)
+
+		req := newRequest("173.245.48.10:443", map[string]string{"CF-Connecting-IP": "2001:db8::1"})
+		assert.Equal(t, "2001:db8::1", res.Resolve(req))
+	})
+
+	t.Run("GCP load balancer", func(t *testing.T) {
+		res, err := middleware.NewClientIPResolver(middleware.GCPLoadBalancerClientIPConfig())
+		require.NoError(t, err)
+
+		// The client spoofed 9.9.9.9; the load balancer appended the client and its VIP.
+		req := newRequest("35.191.1.1:443", map[string]string{"X-Forwarded-For": "9.9.9.9, 198.51.100.20, 203.0.113.80"})
+		assert.Equal(t, "198.51.100.20", res.Resolve(req))
+
+		req = newRequest("35.191.1.1:443", map[string]string{"X-Forwarded-For": "203.0.113.80"})
+		assert.Equal(t, "35.191.1.1", res.Resolve(req), "no client hop left")
+	})
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		_, err := middleware.NewClientIPResolver(middleware.ClientIPConfig{TrustedProxies: []string{"10.0.0.0/99"}})
+		assert.Error(t, err)
+		_, err = middleware.NewClientIPResolver(middleware.ClientIPConfig{TrustedProxies: []string{"not-an-ip"}})
+		assert.Error(t, err)
+		_, err = middleware.NewClientIPResolver(middleware.ClientIPConfig{SkipForwardedHops: -1})
+		assert.Error(t, err)
+		assert.Panics(t, func() {
+			middleware.ClientIPMiddleware(middleware.ClientIPConfig{TrustedProxies: []string{"nope"}})
+		})
+	})
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	var seen string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.ClientIP(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("Stores the resolved IP in context", func(t *testing.T) {
+		handler := middleware.ClientIPMiddleware(middleware.ClientIPConfig{TrustedProxies: []string{"10.0.0.1"}})(nextHandler)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, "198.51.100.1", seen)
+	})
+
+	t.Run("Without the middleware ClientIP is the peer", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.1:1234"
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		nextHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, "203.0.113.1", seen)
+	})
+
+	t.Run("Rate limiting keys on the resolved IP", func(t *testing.T) {
+		limited := middleware.RateLimitMiddleware(middleware.RateLimitConfig{Enabled: true, Limit: 1, Window: 60})(nextHandler)
+		handler := middleware.ClientIPMiddleware(middleware.ClientIPConfig{})(limited)
+
+		for i, spoofed := range []string{"1.1.1.1", "2.2.2.2"} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "203.0.113.50:1234"
+			req.Header.Set("X-Forwarded-For", spoofed)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if i == 0 {
+				assert.Equal(t, http.StatusOK, rr.Code)
+			} else {
+				assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,391 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content encodings supported by CompressionMiddleware.
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// DefaultCompressionMinSize is the smallest response compressed by default. Below it
+// the framing overhead outweighs the savings.
+const DefaultCompressionMinSize = 1024
+
+// DefaultCompressibleTypes is the default content-type allowlist. Entries ending in "/"
+// match every subtype.
+var DefaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/x-ndjson",
+	"image/svg+xml",
+}
+
+// CompressionConfig configures response compression.
+type CompressionConfig struct {
+	Enabled bool
+	// Encodings in order of server preference, used to break ties between equally
+	// weighted Accept-Encoding entries. Defaults to brotli, then gzip.
+	Encodings []string
+	// GzipLevel defaults to gzip.DefaultCompression.
+	GzipLevel int
+	// BrotliLevel defaults to 4, which compresses about as fast as gzip's default.
+	BrotliLevel int
+	// MinSize defaults to DefaultCompressionMinSize. Streamed responses are compressed
+	// from the first Flush regardless of size.
+	MinSize int
+	// ContentTypes defaults to DefaultCompressibleTypes.
+	ContentTypes []string
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// compressor holds the negotiated settings and the encoder pools of a middleware instance.
+type compressor struct {
+	encodings    []string
+	minSize      int
+	contentTypes []string
+	pools        map[string]*sync.Pool
+}
+
+// CompressionMiddleware compresses responses with brotli or gzip, negotiated from the
+// Accept-Encoding header. Only allowlisted content types at or above the minimum size
+// are compressed; Vary: Accept-Encoding is added whenever the response could have been.
+// Flush compresses what has been written so far and flushes it to the client, so
+// server-sent events keep streaming.
+//
+// Strong ETags of compressed responses get the encoding appended ("abc" becomes
+// "abc-gzip"), since the bytes differ from the identity representation. This departs
+// deliberately from weakening them (W/"abc"): a weak ETag can never satisfy If-Match,
+// so clients could no longer make conditional writes. ETagMiddleware and CheckIfMatch
+// accept the suffixed ETags for the original.
+func CompressionMiddleware(cfg CompressionConfig) func(http.Handler) http.Handler {
+	if !cfg.Enabled {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	c := newCompressor(cfg)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := ""
+			// HEAD responses must carry the same headers as GET but have no body to
+			// compress, and ranges refer to the identity representation.
+			if r.Method != http.MethodHead && r.Header.Get("Range") == "" {
+				encoding = c.negotiate(r.Header.Get("Accept-Encoding"))
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				c:              c,
+				encoding:       encoding,
+				status:         http.StatusOK,
+				ifNoneMatch:    strings.Join(r.Header.Values("If-None-Match"), ","),
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+func newCompressor(cfg CompressionConfig) *compressor {
+	c := &compressor{
+		encodings:    cfg.Encodings,
+		minSize:      cfg.MinSize,
+		contentTypes: cfg.ContentTypes,
+		pools:        make(map[string]*sync.Pool),
+	}
+	if len(c.encodings) == 0 {
+		c.encodings = []string{EncodingBrotli, EncodingGzip}
+	}
+	if c.minSize <= 0 {
+		c.minSize = DefaultCompressionMinSize
+	}
+	if len(c.contentTypes) == 0 {
+		c.contentTypes = DefaultCompressibleTypes
+	}
+
+	gzipLevel := cfg.GzipLevel
+	if gzipLevel == 0 {
+		gzipLevel = gzip.DefaultCompression
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, gzipLevel); err != nil {
+		gzipLevel = gzip.DefaultCompression
+	}
+	brotliLevel := cfg.BrotliLevel
+	if brotliLevel <= 0 {
+		brotliLevel = 4
+	}
+
+	for _, enc := range c.encodings {
+		switch enc {
+		case EncodingGzip:
+			c.pools[enc] = &sync.Pool{New: func() any {
+				w, _ := gzip.NewWriterLevel(io.Discard, gzipLevel)
+				return w
+			}}
+		case EncodingBrotli:
+			c.pools[enc] = &sync.Pool{New: func() any {
+				return brotli.NewWriterLevel(io.Discard, brotliLevel)
+			}}
+		}
+	}
+	return c
+}
+
+// negotiate picks the supported encoding with the highest q-value in Accept-Encoding,
+// breaking ties by server preference. It returns "" if none is acceptable.
+func (c *compressor) negotiate(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	type candidate struct {
+		name string
+		q    float64
+		rank int
+	}
+	var candidates []candidate
+	for rank, enc := range c.encodings {
+		if _, ok := c.pools[enc]; !ok {
+			continue
+		}
+		q, ok := weights[enc]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{enc, q, rank})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].rank < candidates[j].rank
+	})
+	return candidates[0].name
+}
+
+func (c *compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.contentTypes {
+		if strings.HasSuffix(allowed, "/") {
+			if strings.HasPrefix(mediaType, allowed) {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds back the header and the first MinSize bytes of the body until
+// it knows whether to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string // Negotiated encoding, or "" if the client accepts none
+
+	ifNoneMatch string
+
+	status      int
+	wroteHeader bool // The handler called WriteHeader or Write
+	decided     bool // The header has been sent downstream
+	buf         []byte
+	enc         encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		// Informational responses (e.g. 103 Early Hints) pass straight through.
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = code
+
+	// Decide right away when the response can never be compressed.
+	h := cw.Header()
+	if !bodyAllowed(code) || h.Get("Content-Encoding") != "" {
+		cw.decide(false)
+		return
+	}
+	if ct := h.Get("Content-Type"); ct != "" && !cw.c.compressible(ct) {
+		cw.decide(false)
+		return
+	}
+	if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cl < cw.c.minSize {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(data)
+		}
+		return cw.ResponseWriter.Write(data)
+	}
+
+	cw.buf = append(cw.buf, data...)
+	if len(cw.buf) >= cw.c.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush implements http.Flusher. A response still being held back is committed
+// (compressed if eligible) so that streams are not delayed by MinSize.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide sends the header downstream, compressing if wanted and the response is eligible.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 && bodyAllowed(cw.status) {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if etag := h.Get("ETag"); cw.status == http.StatusNotModified && etag != "" {
+		// Echo the encoded ETag the client revalidated with, so its copy stays current.
+		for _, candidate := range parseETagList(cw.ifNoneMatch) {
+			if candidate != etag && stripETagEncoding(candidate) == etag {
+				h.Set("ETag", candidate)
+				break
+			}
+		}
+	}
+	eligible := bodyAllowed(cw.status) && h.Get("Content-Encoding") == "" && cw.c.compressible(h.Get("Content-Type"))
+	if eligible {
+		addVary(h, "Accept-Encoding")
+	}
+
+	if compress && eligible && cw.encoding != "" && cw.status != http.StatusPartialContent {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", encodedETag(etag, cw.encoding))
+		}
+		cw.enc = cw.c.pools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close commits a response that stayed under MinSize and finishes the compressed stream.
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.wroteHeader {
+		cw.decide(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		cw.c.pools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified && status >= 200
+}
+
+// addVary adds value to the Vary header unless it is already listed.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, existing := range strings.Split(v, ",") {
+			existing = strings.TrimSpace(existing)
+			if existing == "*" || strings.EqualFold(existing, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
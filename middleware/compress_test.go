@@ -0,0 +1,157 @@
+package middleware_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/shashtag-ventures/go-common/httputil"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionMiddleware(t *testing.T) {
+	largeJSON := `{"items":"` + strings.Repeat("a", 4096) + `"}`
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok":true}`))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(strings.Repeat("\x89PNG", 1024)))
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(largeJSON)))
+			w.Write([]byte(largeJSON))
+		}
+	})
+	handler := middleware.CompressionMiddleware(middleware.CompressionConfig{Enabled: true})(nextHandler)
+
+	serve := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Gzip", func(t *testing.T) {
+		rr := serve("/list", "gzip")
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+		assert.Empty(t, rr.Header().Get("Content-Length"))
+		assert.Equal(t, `"abc-gzip"`, rr.Header().Get("ETag"))
+
+		zr, err := gzip.NewReader(rr.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, largeJSON, string(body))
+	})
+
+	t.Run("Brotli preferred on ties", func(t *testing.T) {
+		rr := serve("/list", "gzip, deflate, br")
+		require.Equal(t, "br", rr.Header().Get("Content-Encoding"))
+
+		body, err := io.ReadAll(brotli.NewReader(rr.Body))
+		require.NoError(t, err)
+		assert.Equal(t, largeJSON, string(body))
+	})
+
+	t.Run("Q-values are honoured", func(t *testing.T) {
+		assert.Equal(t, "gzip", serve("/list", "br;q=0.5, gzip").Header().Get("Content-Encoding"))
+		assert.Equal(t, "gzip", serve("/list", "br;q=0, *").Header().Get("Content-Encoding"))
+		assert.Empty(t, serve("/list", "identity").Header().Get("Content-Encoding"))
+	})
+
+	t.Run("Uncompressed responses still vary", func(t *testing.T) {
+		rr := serve("/list", "")
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+		assert.Equal(t, `"abc"`, rr.Header().Get("ETag"))
+		assert.Equal(t, largeJSON, rr.Body.String())
+	})
+
+	t.Run("Small responses are not compressed", func(t *testing.T) {
+		rr := serve("/small", "gzip")
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, `{"ok":true}`, rr.Body.String())
+	})
+
+	t.Run("Types outside the allowlist are not compressed", func(t *testing.T) {
+		rr := serve("/image", "gzip")
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Empty(t, rr.Header().Get("Vary"))
+	})
+
+	t.Run("Bodiless responses pass through", func(t *testing.T) {
+		rr := serve("/no-content", "gzip")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	})
+}
+
+func TestCompressionMiddleware_Streaming(t *testing.T) {
+	events := make(chan string)
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Handlers commonly wrap the writer; Flush must still reach the compressor.
+		ww := &httputil.ResponseWriterWrapper{ResponseWriter: w}
+		ww.Header().Set("Content-Type", "text/event-stream")
+		for event := range events {
+			io.WriteString(ww, "data: "+event+"\n\n")
+			ww.Flush()
+		}
+	})
+	handler := middleware.CompressionMiddleware(middleware.CompressionConfig{Enabled: true})(nextHandler)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	respCh := make(chan *http.Response)
+	go func() {
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			close(respCh)
+			return
+		}
+		respCh <- resp
+	}()
+
+	events <- "first"
+	resp := <-respCh
+	require.NotNil(t, resp)
+	defer resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	reader := bufio.NewReader(zr)
+
+	// Each event arrives before the next is produced.
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n", line)
+
+	reader.ReadString('\n')
+	events <- "second"
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: second\n", line)
+	close(events)
+}
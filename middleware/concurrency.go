@@ -0,0 +1,417 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+)
+
+// ConcurrencyAlgorithm selects how ConcurrencyLimitMiddleware adapts its limits.
+type ConcurrencyAlgorithm string
+
+const (
+	// ConcurrencyAIMD raises the limit while requests are fast and cuts it by 10% when
+	// they fail or exceed the latency threshold, like TCP congestion control.
+	ConcurrencyAIMD ConcurrencyAlgorithm = "aimd"
+	// ConcurrencyGradient compares short-term to long-term latency and shrinks the
+	// limit as soon as requests start queueing, without a fixed threshold.
+	ConcurrencyGradient ConcurrencyAlgorithm = "gradient"
+)
+
+const (
+	DefaultConcurrencyInitialLimit = 20
+	DefaultConcurrencyMinLimit     = 2
+	DefaultConcurrencyMaxLimit     = 200
+	// DefaultConcurrencyLatencyThreshold is the AIMD latency above which a request
+	// counts as a sign of overload.
+	DefaultConcurrencyLatencyThreshold = time.Second
+)
+
+// DefaultConcurrencyExemptPaths are never limited unless ConcurrencyConfig.ExemptPaths is set,
+// so that health checks keep passing while the service sheds load.
+var DefaultConcurrencyExemptPaths = []string{"/health", "/api/*/health", "/metrics"}
+
+// Priority decides which requests are shed first. Each class may only use a share
+// of the limit: low 50%, normal 90% and critical all of it, so low priority
+// requests are shed well before critical ones.
+type Priority int
+
+const (
+	PriorityLow      Priority = -1 // E.g. bulk exports and retried background work
+	PriorityNormal   Priority = 0
+	PriorityCritical Priority = 1 // E.g. login, payments
+)
+
+func (p Priority) String() string {
+	switch {
+	case p < PriorityNormal:
+		return "low"
+	case p > PriorityNormal:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+func (p Priority) share() float64 {
+	switch {
+	case p < PriorityNormal:
+		return 0.5
+	case p > PriorityNormal:
+		return 1
+	default:
+		return 0.9
+	}
+}
+
+// ConcurrencyLimits bounds an adaptive limit. Zero fields use the defaults.
+type ConcurrencyLimits struct {
+	Initial int
+	Min     int
+	Max     int
+}
+
+func (l ConcurrencyLimits) withDefaults(d ConcurrencyLimits) ConcurrencyLimits {
+	if l.Initial <= 0 {
+		l.Initial = d.Initial
+	}
+	if l.Min <= 0 {
+		l.Min = d.Min
+	}
+	if l.Max <= 0 {
+		l.Max = d.Max
+	}
+	return l
+}
+
+// ConcurrencyConfig configures adaptive concurrency limiting.
+type ConcurrencyConfig struct {
+	Enabled   bool
+	Algorithm ConcurrencyAlgorithm // Defaults to ConcurrencyAIMD
+	// Limits bound the limit shared by requests that match no route group.
+	Limits ConcurrencyLimits
+	// LatencyThreshold is used by ConcurrencyAIMD. Defaults to DefaultConcurrencyLatencyThreshold.
+	LatencyThreshold time.Duration
+	// Routes get their own limiter, so a burst on one group (e.g. deploys, which hold
+	// database connections) cannot starve the others. The first match applies.
+	Routes []ConcurrencyRoute
+	// Classify can adjust the priority of a request, e.g. to favor admins. It receives
+	// the priority of the request's route group.
+	Classify func(r *http.Request, p Priority) Priority
+	// ExemptPaths are path.Match patterns that are never limited; a trailing "/**"
+	// matches any depth. Defaults to DefaultConcurrencyExemptPaths.
+	ExemptPaths []string
+	// RetryAfter is sent to shed clients. Defaults to one second.
+	RetryAfter time.Duration
+	// Registry receives the metrics. Nil uses the global Prometheus registry.
+	Registry  *prometheus.Registry
+	Namespace string
+	// Name is the "limiter" label of the metrics. Middlewares sharing a registry, e.g.
+	// one per sub-router, need distinct names or they overwrite each other's gauges.
+	Name string
+}
+
+// ConcurrencyRoute gives a route group its own limiter.
+type ConcurrencyRoute struct {
+	Name       string   // Metrics label; defaults to PathPrefix
+	PathPrefix string   // Route group, e.g. "/deploys"; empty matches every path
+	Methods    []string // Empty matches every method
+	Limits     ConcurrencyLimits
+	Priority   Priority // Priority of the group's requests
+	Disabled   bool     // Exempts matching requests from limiting
+}
+
+// ConcurrencyLimitMiddleware sheds load before it exhausts downstream resources such as
+// the database connection pool. Each route group has a concurrency limit that adapts
+// to observed latency and failures (503 and 504 responses and timed-out requests); a
+// request that would exceed its priority's share of the limit is rejected right away
+// with a 503 JSON response and Retry-After, rather than queued.
+//
+// Limits are per instance. Metrics are exported as http_concurrency_limit,
+// http_concurrency_in_flight and http_requests_shed_total, labelled with Name and the
+// route group. It panics on an unknown algorithm or if the metrics cannot be
+// registered.
+func ConcurrencyLimitMiddleware(cfg ConcurrencyConfig) func(http.Handler) http.Handler {
+	if !cfg.Enabled {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = ConcurrencyAIMD
+	}
+	if cfg.Algorithm != ConcurrencyAIMD && cfg.Algorithm != ConcurrencyGradient {
+		panic("middleware: unknown concurrency algorithm " + strconv.Quote(string(cfg.Algorithm)))
+	}
+	if cfg.LatencyThreshold <= 0 {
+		cfg.LatencyThreshold = DefaultConcurrencyLatencyThreshold
+	}
+	if cfg.ExemptPaths == nil {
+		cfg.ExemptPaths = DefaultConcurrencyExemptPaths
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	retryAfter := strconv.Itoa(int(math.Ceil(cfg.RetryAfter.Seconds())))
+	defaults := cfg.Limits.withDefaults(ConcurrencyLimits{
+		Initial: DefaultConcurrencyInitialLimit,
+		Min:     DefaultConcurrencyMinLimit,
+		Max:     DefaultConcurrencyMaxLimit,
+	})
+
+	metrics, err := newConcurrencyMetrics(cfg)
+	if err != nil {
+		panic("middleware: failed to register concurrency metrics: " + err.Error())
+	}
+
+	limiters := make([]*concurrencyLimiter, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		if route.Disabled {
+			continue
+		}
+		name := route.Name
+		if name == "" {
+			name = route.PathPrefix
+		}
+		limiters[i] = newConcurrencyLimiter(name, cfg, route.Limits.withDefaults(defaults), metrics)
+	}
+	fallback := newConcurrencyLimiter("default", cfg, defaults, metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if matchPathPatterns(cfg.ExemptPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limiter, priority := fallback, PriorityNormal
+			for i, route := range cfg.Routes {
+				if matchesRoute(r, route.PathPrefix, route.Methods) {
+					limiter, priority = limiters[i], route.Priority
+					break
+				}
+			}
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if cfg.Classify != nil {
+				priority = cfg.Classify(r, priority)
+			}
+
+			if !limiter.tryAcquire(priority) {
+				metrics.shed.WithLabelValues(limiter.name, priority.String()).Inc()
+				w.Header().Set("Retry-After", retryAfter)
+				jsonResponse.SendErrorResponse(w, customErrors.New("server is overloaded, please retry later", nil), http.StatusServiceUnavailable)
+				return
+			}
+			start := time.Now()
+			lw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			sampled := false
+			defer func() {
+				if !sampled {
+					// Panicked: free the slot without judging the latency.
+					limiter.release(start, 0, false, false)
+				}
+			}()
+
+			next.ServeHTTP(lw, r)
+
+			ctxErr := r.Context().Err()
+			dropped := lw.statusCode == http.StatusServiceUnavailable ||
+				lw.statusCode == http.StatusGatewayTimeout ||
+				errors.Is(ctxErr, context.DeadlineExceeded)
+			// A client that went away says nothing about our latency.
+			sample := !errors.Is(ctxErr, context.Canceled)
+			sampled = true
+			limiter.release(start, time.Since(start), dropped, sample)
+		})
+	}
+}
+
+// concurrencyMetrics holds the collectors shared by all limiters of a middleware.
+type concurrencyMetrics struct {
+	limit    *prometheus.GaugeVec
+	inFlight *prometheus.GaugeVec
+	shed     *prometheus.CounterVec
+}
+
+func newConcurrencyMetrics(cfg ConcurrencyConfig) (*concurrencyMetrics, error) {
+	var registerer prometheus.Registerer = prometheus.DefaultRegisterer
+	if cfg.Registry != nil {
+		registerer = cfg.Registry
+	}
+
+	m := &concurrencyMetrics{
+		limit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: cfg.Namespace,
+			Name:      "http_concurrency_limit",
+			Help:      "Current adaptive concurrency limit per route group.",
+		}, []string{"limiter", "group"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: cfg.Namespace,
+			Name:      "http_concurrency_in_flight",
+			Help:      "Requests currently holding a concurrency slot per route group.",
+		}, []string{"limiter", "group"}),
+		shed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.Namespace,
+			Name:      "http_requests_shed_total",
+			Help:      "Requests rejected by the concurrency limiter.",
+		}, []string{"limiter", "group", "priority"}),
+	}
+
+	// Reuse collectors registered by another limiter middleware, e.g. one per sub-router,
+	// and bind them to this one's name.
+	var err error
+	if m.limit, err = registerOrExisting(registerer, m.limit); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = registerOrExisting(registerer, m.inFlight); err != nil {
+		return nil, err
+	}
+	if m.shed, err = registerOrExisting(registerer, m.shed); err != nil {
+		return nil, err
+	}
+	instance := prometheus.Labels{"limiter": cfg.Name}
+	m.limit = m.limit.MustCurryWith(instance)
+	m.inFlight = m.inFlight.MustCurryWith(instance)
+	m.shed = m.shed.MustCurryWith(instance)
+	return m, nil
+}
+
+func registerOrExisting[C prometheus.Collector](registerer prometheus.Registerer, c C) (C, error) {
+	err := registerer.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+// limitAlgorithm computes a new limit from a completed request. Calls are serialized
+// by the limiter.
+type limitAlgorithm interface {
+	update(limit float64, start time.Time, rtt time.Duration, inFlight int, dropped bool) float64
+}
+
+// aimdLimit adds one slot per limit's worth of fast requests and backs off by 10% on
+// overload, at most once per round trip so that one slow burst is not punished for
+// every request in it.
+type aimdLimit struct {
+	threshold   time.Duration
+	lastBackoff time.Time
+}
+
+func (a *aimdLimit) update(limit float64, start time.Time, rtt time.Duration, inFlight int, dropped bool) float64 {
+	if dropped || rtt > a.threshold {
+		if start.Before(a.lastBackoff) {
+			return limit
+		}
+		a.lastBackoff = time.Now()
+		return limit * 0.9
+	}
+	// Only grow when the limit is actually in use.
+	if float64(inFlight)*2 >= limit {
+		return limit + 1/limit
+	}
+	return limit
+}
+
+// gradientLimit follows the ratio of long-term to short-term latency: when requests
+// get slower than usual they are queueing somewhere, so the limit shrinks in
+// proportion. A square-root allowance on top lets the limit probe upwards.
+type gradientLimit struct {
+	shortRTT float64
+	longRTT  float64
+}
+
+const gradientTolerance = 1.5 // Latency may grow by half before the limit shrinks
+
+func (g *gradientLimit) update(limit float64, _ time.Time, rtt time.Duration, inFlight int, dropped bool) float64 {
+	sample := float64(rtt)
+	if g.longRTT == 0 {
+		g.shortRTT, g.longRTT = sample, sample
+	}
+	g.shortRTT = g.shortRTT*0.9 + sample*0.1
+	g.longRTT = g.longRTT*0.99 + sample*0.01
+	// After a slow period, let the baseline catch up with the recovered latency.
+	if g.longRTT/g.shortRTT > 2 {
+		g.longRTT *= 0.95
+	}
+
+	if dropped {
+		return limit * 0.9
+	}
+	if float64(inFlight) < limit/2 {
+		return limit
+	}
+	gradient := math.Max(0.5, math.Min(1, gradientTolerance*g.longRTT/g.shortRTT))
+	target := limit*gradient + math.Sqrt(limit)
+	// Smooth the change so that a single outlier does not swing the limit.
+	return limit*0.8 + target*0.2
+}
+
+// concurrencyLimiter tracks the limit and in-flight requests of one route group.
+type concurrencyLimiter struct {
+	name     string
+	min, max float64
+	algo     limitAlgorithm
+	metrics  *concurrencyMetrics
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+}
+
+func newConcurrencyLimiter(name string, cfg ConcurrencyConfig, limits ConcurrencyLimits, metrics *concurrencyMetrics) *concurrencyLimiter {
+	var algo limitAlgorithm = &aimdLimit{threshold: cfg.LatencyThreshold}
+	if cfg.Algorithm == ConcurrencyGradient {
+		algo = &gradientLimit{}
+	}
+	l := &concurrencyLimiter{
+		name:    name,
+		min:     float64(limits.Min),
+		max:     float64(max(limits.Max, limits.Min)),
+		algo:    algo,
+		metrics: metrics,
+	}
+	l.limit = math.Max(l.min, math.Min(l.max, float64(limits.Initial)))
+	metrics.limit.WithLabelValues(name).Set(l.limit)
+	return l
+}
+
+// tryAcquire takes a slot if the in-flight requests are below the priority's share of
+// the limit.
+func (l *concurrencyLimiter) tryAcquire(p Priority) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(math.Ceil(l.limit*p.share())) {
+		return false
+	}
+	l.inFlight++
+	l.metrics.inFlight.WithLabelValues(l.name).Set(float64(l.inFlight))
+	return true
+}
+
+// release frees a slot and, if sample is set, adapts the limit to the request's outcome.
+func (l *concurrencyLimiter) release(start time.Time, rtt time.Duration, dropped, sample bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if sample {
+		limit := l.algo.update(l.limit, start, rtt, l.inFlight, dropped)
+		l.limit = math.Max(l.min, math.Min(l.max, limit))
+		l.metrics.limit.WithLabelValues(l.name).Set(l.limit)
+	}
+	l.inFlight--
+	l.metrics.inFlight.WithLabelValues(l.name).Set(float64(l.inFlight))
+}
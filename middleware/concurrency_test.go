@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingHandler holds requests until released, so tests control how many are in flight.
+type blockingHandler struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{entered: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.entered <- struct{}{}
+	<-h.release
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	fixed := func(n int) ConcurrencyLimits { return ConcurrencyLimits{Initial: n, Min: n, Max: n} }
+	serve := func(h http.Handler, method, target string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	// hold starts n requests that stay in flight until the returned func is called.
+	hold := func(t *testing.T, h http.Handler, blocking *blockingHandler, target string, n int, header ...string) func() {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serve(h, http.MethodGet, target, header...)
+			}()
+			<-blocking.entered
+		}
+		return func() {
+			close(blocking.release)
+			wg.Wait()
+		}
+	}
+
+	t.Run("Sheds over the limit with 503 and Retry-After", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		blocking := newBlockingHandler()
+		h := ConcurrencyLimitMiddleware(ConcurrencyConfig{
+			Enabled:    true,
+			Limits:     fixed(2),
+			RetryAfter: 2 * time.Second,
+			Registry:   reg,
+		})(blocking)
+
+		done := hold(t, h, blocking, "/projects", 2)
+		defer done()
+
+		rr := serve(h, http.MethodGet, "/projects")
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Contains(t, body["message"], "overloaded")
+
+		healthy := ConcurrencyLimitMiddleware(ConcurrencyConfig{Enabled: true, Limits: fixed(2), Registry: reg})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		assert.Equal(t, http.StatusOK, serve(healthy, http.MethodGet, "/health").Code, "health checks are exempt")
+
+		assert.Equal(t, 1.0, metricValue(t, reg, "http_requests_shed_total", prometheus.Labels{"group": "default", "priority": "normal"}))
+	})
+
+	t.Run("Priorities get a share of the limit", func(t *testing.T) {
+		blocking := newBlockingHandler()
+		h := ConcurrencyLimitMiddleware(ConcurrencyConfig{
+			Enabled:  true,
+			Limits:   fixed(10),
+			Registry: prometheus.NewRegistry(),
+			Classify: func(r *http.Request, p Priority) Priority {
+				switch r.Header.Get("X-Priority") {
+				case "low":
+					return PriorityLow
+				case "critical":
+					return PriorityCritical
+				}
+				return p
+			},
+		})(blocking)
+
+		done := hold(t, h, blocking, "/", 5)
+		defer done()
+		assert.Equal(t, http.StatusServiceUnavailable, serve(h, http.MethodGet, "/", "X-Priority", "low").Code)
+
+		// Normal requests may use 9 of the 10 slots, critical ones all of them.
+		for i := 0; i < 4; i++ {
+			go serve(h, http.MethodGet, "/")
+			<-blocking.entered
+		}
+		assert.Equal(t, http.StatusServiceUnavailable, serve(h, http.MethodGet, "/").Code)
+		go serve(h, http.MethodGet, "/", "X-Priority", "critical")
+		<-blocking.entered
+		assert.Equal(t, http.StatusServiceUnavailable, serve(h, http.MethodGet, "/", "X-Priority", "critical").Code)
+	})
+
+	t.Run("Route groups have their own limits", func(t *testing.T) {
+		blocking := newBlockingHandler()
+		h := ConcurrencyLimitMiddleware(ConcurrencyConfig{
+			Enabled:  true,
+			Limits:   fixed(10),
+			Registry: prometheus.NewRegistry(),
+			Routes: []ConcurrencyRoute{
+				{PathPrefix: "/deploys", Methods: []string{http.MethodGet}, Limits: fixed(1), Priority: PriorityCritical},
+				{PathPrefix: "/internal", Disabled: true},
+			},
+		})(blocking)
+
+		done := hold(t, h, blocking, "/deploys/1", 1)
+		defer done()
+		assert.Equal(t, http.StatusServiceUnavailable, serve(h, http.MethodGet, "/deploys/2").Code)
+
+		go serve(h, http.MethodGet, "/projects")
+		<-blocking.entered
+		go serve(h, http.MethodGet, "/internal/jobs")
+		<-blocking.entered
+	})
+
+	t.Run("Named middlewares share a registry", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		ConcurrencyLimitMiddleware(ConcurrencyConfig{Enabled: true, Limits: fixed(2), Registry: reg, Name: "api"})(next)
+		ConcurrencyLimitMiddleware(ConcurrencyConfig{Enabled: true, Limits: fixed(5), Registry: reg, Name: "admin"})(next)
+
+		assert.Equal(t, 2.0, metricValue(t, reg, "http_concurrency_limit", prometheus.Labels{"limiter": "api", "group": "default"}))
+		assert.Equal(t, 5.0, metricValue(t, reg, "http_concurrency_limit", prometheus.Labels{"limiter": "admin", "group": "default"}))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		assert.NotNil(t, ConcurrencyLimitMiddleware(ConcurrencyConfig{})(next))
+		assert.Panics(t, func() {
+			ConcurrencyLimitMiddleware(ConcurrencyConfig{Enabled: true, Algorithm: "random"})
+		})
+	})
+}
+
+func TestConcurrencyLimitAdapts(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h := ConcurrencyLimitMiddleware(ConcurrencyConfig{
+		Enabled:  true,
+		Limits:   ConcurrencyLimits{Initial: 10, Min: 5, Max: 100},
+		Registry: reg,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	limit := func() float64 { return metricValue(t, reg, "http_concurrency_limit", prometheus.Labels{"group": "default"}) }
+	require.Equal(t, 10.0, limit())
+
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.InDelta(t, 7.29, limit(), 0.001, "backs off on overload responses")
+
+	for i := 0; i < 10; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.Equal(t, 5.0, limit(), "never below Min")
+}
+
+func TestAIMDLimit(t *testing.T) {
+	a := &aimdLimit{threshold: 100 * time.Millisecond}
+	start := time.Now()
+
+	assert.Equal(t, 10.0, a.update(10, start, time.Millisecond, 2, false), "no growth while under-used")
+	assert.InDelta(t, 10.1, a.update(10, start, time.Millisecond, 5, false), 0.001)
+
+	assert.Equal(t, 9.0, a.update(10, start, time.Second, 5, false), "slow requests count as overload")
+	assert.Equal(t, 9.0, a.update(9, start, time.Second, 5, true), "one back-off per round trip")
+	assert.InDelta(t, 8.1, a.update(9, time.Now(), time.Second, 5, true), 0.001)
+}
+
+func TestGradientLimit(t *testing.T) {
+	g := &gradientLimit{}
+	limit := 20.0
+	for i := 0; i < 200; i++ {
+		limit = g.update(limit, time.Time{}, 10*time.Millisecond, int(limit), false)
+	}
+	assert.Greater(t, limit, 20.0, "grows while latency is stable")
+
+	steady := limit
+	for i := 0; i < 20; i++ {
+		limit = g.update(limit, time.Time{}, 100*time.Millisecond, int(limit), false)
+	}
+	assert.Less(t, limit, steady, "shrinks when latency rises")
+	assert.Equal(t, limit, g.update(limit, time.Time{}, time.Millisecond, 1, false), "ignores under-used samples")
+}
+
+// metricValue returns the value of the gauge or counter with the given labels. Labels
+// that are not given must be empty.
+func metricValue(t *testing.T, reg *prometheus.Registry, name string, labels prometheus.Labels) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if pair.GetValue() != labels[pair.GetName()] {
+					continue metrics
+				}
+			}
+			return m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("metric %s%v not found", name, labels)
+	return 0
+}
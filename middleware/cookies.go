@@ -8,13 +8,20 @@ import (
 const (
 	JWTCookieName           = "jwt_token"
 	IsAuthenticatedCookie   = "is_authenticated"
+	RefreshCookieName       = "refresh_token"
 	defaultCookieDuration   = 24 * time.Hour
 )
 
 // SetAuthCookies sets the JWT and authentication status cookies.
 // It sets "jwt_token" as HttpOnly and "is_authenticated" as accessible by JS.
 func SetAuthCookies(w http.ResponseWriter, token string, isSecure bool, domain string) {
-	expiration := time.Now().Add(defaultCookieDuration)
+	SetAuthCookiesWithTTL(w, token, isSecure, domain, defaultCookieDuration)
+}
+
+// SetAuthCookiesWithTTL is like SetAuthCookies but lets the caller match the cookie
+// lifetime to a short-lived access token.
+func SetAuthCookiesWithTTL(w http.ResponseWriter, token string, isSecure bool, domain string, ttl time.Duration) {
+	expiration := time.Now().Add(ttl)
 	
 	http.SetCookie(w, &http.Cookie{
 		Name:     JWTCookieName,
@@ -63,3 +70,31 @@ func ClearAuthCookies(w http.ResponseWriter, isSecure bool, domain string) {
 		SameSite: http.SameSiteLaxMode,
 	})
 }
+
+// SetRefreshCookie sets the HttpOnly refresh token cookie.
+func SetRefreshCookie(w http.ResponseWriter, token string, expiresAt time.Time, isSecure bool, domain string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshCookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   domain,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   isSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearRefreshCookie clears the refresh token cookie.
+func ClearRefreshCookie(w http.ResponseWriter, isSecure bool, domain string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshCookieName,
+		Value:    "",
+		Path:     "/",
+		Domain:   domain,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   isSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -3,69 +3,368 @@ package middleware
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jsonResponse"
 )
 
-// responseBuffer is a custom ResponseWriter that captures the response body.
-type responseBuffer struct {
-	http.ResponseWriter
-	body   *bytes.Buffer
-	status int
+// DefaultETagMaxSize is the largest response ETag buffers to hash. Larger responses are
+// streamed through without a generated ETag.
+const DefaultETagMaxSize = 1 << 20
+
+// ETagConfig configures ETagMiddleware.
+type ETagConfig struct {
+	// Weak makes generated ETags weak (W/"..."), for responses that are semantically but
+	// not byte-for-byte stable.
+	Weak bool
+	// MaxSize defaults to DefaultETagMaxSize.
+	MaxSize int
+	// CacheControl is set on responses that have no Cache-Control of their own.
+	// Defaults to "public, no-cache", which forces revalidation with the ETag.
+	CacheControl string
 }
 
-func (w *responseBuffer) Write(b []byte) (int, error) {
-	return w.body.Write(b)
+// ETag generates ETags and handles conditional GET requests with the default config.
+// See ETagMiddleware.
+func ETag(next http.Handler) http.Handler {
+	return ETagMiddleware(ETagConfig{})(next)
 }
 
-func (w *responseBuffer) WriteHeader(statusCode int) {
-	w.status = statusCode
+// ETagMiddleware handles conditional GET and HEAD requests.
+//
+// If the handler sets an ETag or Last-Modified header itself (see SetETag, VersionETag
+// and SetLastModified), the preconditions are checked as soon as it writes the header and
+// the body is never buffered. Otherwise the 200 response is buffered up to MaxSize and
+// hashed; larger and flushed responses are passed through without an ETag.
+//
+// If-None-Match supports lists, "*" and weak comparison, and ETags that
+// CompressionMiddleware suffixed with the encoding match the original.
+// If-Modified-Since is used only when If-None-Match is absent. A 304 keeps the headers
+// set by the handler, such as Cache-Control and Vary.
+func ETagMiddleware(cfg ETagConfig) func(http.Handler) http.Handler {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultETagMaxSize
+	}
+	if cfg.CacheControl == "" {
+		cfg.CacheControl = "public, no-cache"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Only calculate ETag for GET and HEAD requests
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w, r: r, cfg: &cfg, status: http.StatusOK}
+			next.ServeHTTP(ew, r)
+			ew.finish()
+		})
+	}
 }
 
-// ETag is a middleware that generates an ETag for the response and handles conditional requests.
-// It buffers the response to calculate the hash, so use with caution for large responses.
-func ETag(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Only calculate ETag for GET and HEAD requests
-		if r.Method != http.MethodGet && r.Method != http.MethodHead {
-			next.ServeHTTP(w, r)
+const (
+	etagBuffering = iota
+	etagPassThrough
+	etagDiscard // A 304 was sent; the body is dropped
+)
+
+// etagWriter buffers a 200 response until it can be hashed, or passes it through.
+type etagWriter struct {
+	http.ResponseWriter
+	r   *http.Request
+	cfg *ETagConfig
+
+	status      int
+	wroteHeader bool
+	mode        int
+	buf         bytes.Buffer
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+	ew.wroteHeader = true
+	ew.status = code
+
+	h := ew.Header()
+	switch {
+	case code != http.StatusOK:
+		ew.passThrough()
+	case h.Get("ETag") != "" || h.Get("Last-Modified") != "":
+		// Handler-supplied validators: decide now, nothing to hash.
+		if h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", ew.cfg.CacheControl)
+		}
+		if notModified(ew.r, h) {
+			ew.writeNotModified()
 			return
 		}
+		ew.passThrough()
+	default:
+		if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cl > ew.cfg.MaxSize {
+			ew.passThrough()
+		}
+	}
+}
 
-		buf := &bytes.Buffer{}
-		rb := &responseBuffer{
-			ResponseWriter: w,
-			body:           buf,
-			status:         http.StatusOK, // Default status
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	switch ew.mode {
+	case etagDiscard:
+		return len(b), nil
+	case etagPassThrough:
+		return ew.ResponseWriter.Write(b)
+	}
+
+	ew.buf.Write(b)
+	if ew.buf.Len() > ew.cfg.MaxSize {
+		if err := ew.passThrough(); err != nil {
+			return 0, err
 		}
+	}
+	return len(b), nil
+}
 
-		next.ServeHTTP(rb, r)
+// Flush implements http.Flusher. A flushed response is streamed without a generated ETag.
+func (ew *etagWriter) Flush() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.mode == etagBuffering {
+		ew.passThrough()
+	}
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
 
-		// If the handler returned a non-success code (or 304/204), pass through
-		// We only ETag 200 OK responses usually
-		if rb.status != http.StatusOK {
-			w.WriteHeader(rb.status)
-			w.Write(buf.Bytes())
-			return
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// passThrough sends the header and anything buffered, and stops buffering.
+func (ew *etagWriter) passThrough() error {
+	ew.mode = etagPassThrough
+	ew.ResponseWriter.WriteHeader(ew.status)
+	if ew.buf.Len() == 0 {
+		return nil
+	}
+	_, err := ew.ResponseWriter.Write(ew.buf.Bytes())
+	ew.buf.Reset()
+	return err
+}
+
+func (ew *etagWriter) writeNotModified() {
+	ew.mode = etagDiscard
+	h := ew.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+}
+
+// finish hashes a fully buffered response and answers the conditional request.
+func (ew *etagWriter) finish() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.mode != etagBuffering {
+		return
+	}
+
+	h := ew.Header()
+	if h.Get("ETag") == "" {
+		sum := sha256.Sum256(ew.buf.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		if ew.cfg.Weak {
+			etag = "W/" + etag
 		}
+		h.Set("ETag", etag)
+	}
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", ew.cfg.CacheControl)
+	}
 
-		// Calculate ETag
-		bodyBytes := buf.Bytes()
-		etag := fmt.Sprintf("\"%x\"", sha256.Sum256(bodyBytes))
+	if notModified(ew.r, h) {
+		ew.writeNotModified()
+		return
+	}
+	ew.passThrough()
+}
 
-		// Check If-None-Match
-		if r.Header.Get("If-None-Match") == etag {
-			w.WriteHeader(http.StatusNotModified)
-			return
+// notModified evaluates If-None-Match, or If-Modified-Since when it is absent
+// (RFC 9110 13.2.2).
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := strings.Join(r.Header.Values("If-None-Match"), ","); inm != "" {
+		etag := h.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range parseETagList(inm) {
+			if candidate == "*" || weakETagMatch(candidate, etag) || weakETagMatch(stripETagEncoding(candidate), etag) {
+				return true
+			}
 		}
+		return false
+	}
 
-		// Set ETag header
-		w.Header().Set("ETag", etag)
-		// We add "no-cache" to force revalidation with the server using the ETag
-		w.Header().Set("Cache-Control", "public, no-cache")
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// CheckIfMatch evaluates the If-Match header of a PUT, PATCH or DELETE against the
+// current ETag of the resource, using strong comparison. ETags that
+// CompressionMiddleware suffixed with the encoding (e.g. "doc-1-7-gzip") match the
+// original. On a mismatch it responds 412 Precondition Failed and returns false; the
+// handler must then stop. Requests without If-Match pass. Pass "" as currentETag if
+// the resource does not exist.
+//
+//	if !middleware.CheckIfMatch(w, r, middleware.VersionETag(doc.ID, doc.Version)) {
+//		return
+//	}
+func CheckIfMatch(w http.ResponseWriter, r *http.Request, currentETag string) bool {
+	im := strings.Join(r.Header.Values("If-Match"), ",")
+	if im == "" {
+		return true
+	}
+	for _, candidate := range parseETagList(im) {
+		if candidate == "*" && currentETag != "" {
+			return true
+		}
+		if strongETagMatch(candidate, currentETag) || strongETagMatch(stripETagEncoding(candidate), currentETag) {
+			return true
+		}
+	}
+	jsonResponse.SendErrorResponse(w, fmt.Errorf("the resource has been modified; fetch it again and retry"), http.StatusPreconditionFailed)
+	return false
+}
 
-		// Write the buffered response
-		w.WriteHeader(rb.status)
-		w.Write(bodyBytes)
+// RequireIfMatch rejects PUT, PATCH and DELETE requests without an If-Match header with
+// 428 Precondition Required, so clients cannot skip the optimistic concurrency check.
+func RequireIfMatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if r.Header.Get("If-Match") == "" {
+				jsonResponse.SendErrorResponse(w, fmt.Errorf("If-Match header is required"), http.StatusPreconditionRequired)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
 	})
 }
+
+// VersionETag builds a strong ETag from values that change whenever the resource does,
+// such as an ID and an updated-at timestamp or version counter, without hashing the body.
+func VersionETag(parts ...any) string {
+	strs := make([]string, len(parts))
+	for i, p := range parts {
+		if t, ok := p.(time.Time); ok {
+			p = t.UnixNano()
+		}
+		strs[i] = fmt.Sprint(p)
+	}
+	value := strings.Join(strs, "-")
+	for _, c := range value {
+		// Only etagc characters may appear unquoted inside an entity tag.
+		if c < 0x21 || c == '"' || c > 0x7e {
+			sum := sha256.Sum256([]byte(value))
+			value = hex.EncodeToString(sum[:16])
+			break
+		}
+	}
+	return `"` + value + `"`
+}
+
+// SetETag sets the ETag response header. An unquoted value is quoted.
+func SetETag(w http.ResponseWriter, etag string) {
+	if !strings.HasPrefix(etag, `"`) && !strings.HasPrefix(etag, `W/"`) {
+		etag = `"` + etag + `"`
+	}
+	w.Header().Set("ETag", etag)
+}
+
+// SetLastModified sets the Last-Modified response header.
+func SetLastModified(w http.ResponseWriter, t time.Time) {
+	if !t.IsZero() {
+		w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseETagList splits an If-Match / If-None-Match value into entity tags.
+func parseETagList(s string) []string {
+	var tags []string
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return tags
+		}
+		if s[0] == '*' {
+			tags = append(tags, "*")
+			s = s[1:]
+			continue
+		}
+		start := 0
+		if strings.HasPrefix(s, "W/") {
+			start = 2
+		}
+		if len(s) <= start || s[start] != '"' {
+			return tags // Malformed
+		}
+		end := strings.IndexByte(s[start+1:], '"')
+		if end < 0 {
+			return tags
+		}
+		end += start + 2
+		tags = append(tags, s[:end])
+		s = s[end:]
+	}
+}
+
+// encodedETag appends a content encoding to a strong ETag, so that each encoding of a
+// representation has its own strong validator. Weak ETags are returned unchanged.
+func encodedETag(etag, encoding string) string {
+	if strings.HasPrefix(etag, "W/") || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// stripETagEncoding reverses encodedETag.
+func stripETagEncoding(etag string) string {
+	for _, encoding := range []string{EncodingBrotli, EncodingGzip} {
+		if base, ok := strings.CutSuffix(etag, "-"+encoding+`"`); ok && !strings.HasPrefix(etag, "W/") {
+			return base + `"`
+		}
+	}
+	return etag
+}
+
+func weakETagMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+func strongETagMatch(a, b string) bool {
+	return a == b && a != "" && !strings.HasPrefix(a, "W/")
+}
@@ -0,0 +1,216 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETagMiddleware_Conditional(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var bodyWrites int
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Language")
+		switch r.URL.Path {
+		case "/versioned":
+			middleware.SetETag(w, middleware.VersionETag("doc-1", 7))
+			middleware.SetLastModified(w, modified)
+		case "/dated":
+			middleware.SetLastModified(w, modified)
+		case "/large":
+			w.Write([]byte(strings.Repeat("x", 2048)))
+			return
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		bodyWrites++
+		w.Write([]byte(`{"id":"doc-1"}`))
+	})
+	handler := middleware.ETagMiddleware(middleware.ETagConfig{Weak: true, MaxSize: 1024})(nextHandler)
+
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Weak generated ETag", func(t *testing.T) {
+		rr := serve("/generated", nil)
+		etag := rr.Header().Get("ETag")
+		assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+		assert.Equal(t, "public, no-cache", rr.Header().Get("Cache-Control"))
+
+		rr = serve("/generated", map[string]string{"If-None-Match": `"other", ` + strings.TrimPrefix(etag, "W/")})
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.String())
+		assert.Equal(t, "Accept-Language", rr.Header().Get("Vary"), "handler headers are kept on 304")
+		assert.Empty(t, rr.Header().Get("Content-Type"))
+	})
+
+	t.Run("If-None-Match star", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotModified, serve("/generated", map[string]string{"If-None-Match": "*"}).Code)
+	})
+
+	t.Run("Handler-supplied ETag is not rehashed", func(t *testing.T) {
+		rr := serve("/versioned", nil)
+		assert.Equal(t, `"doc-1-7"`, rr.Header().Get("ETag"))
+		assert.Equal(t, `{"id":"doc-1"}`, rr.Body.String())
+
+		rr = serve("/versioned", map[string]string{"If-None-Match": `W/"doc-1-7"`})
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("If-Modified-Since", func(t *testing.T) {
+		rr := serve("/dated", map[string]string{"If-Modified-Since": modified.Add(time.Minute).Format(http.TimeFormat)})
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Equal(t, modified.Format(http.TimeFormat), rr.Header().Get("Last-Modified"))
+
+		rr = serve("/dated", map[string]string{"If-Modified-Since": modified.Add(-time.Minute).Format(http.TimeFormat)})
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("If-None-Match takes precedence over If-Modified-Since", func(t *testing.T) {
+		rr := serve("/versioned", map[string]string{
+			"If-None-Match":     `"stale"`,
+			"If-Modified-Since": modified.Format(http.TimeFormat),
+		})
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Large responses pass through", func(t *testing.T) {
+		rr := serve("/large", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("ETag"))
+		assert.Len(t, rr.Body.String(), 2048)
+	})
+
+	t.Run("Errors pass through", func(t *testing.T) {
+		rr := serve("/missing", map[string]string{"If-None-Match": "*"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Empty(t, rr.Header().Get("ETag"))
+	})
+
+	t.Run("Flushed responses stream", func(t *testing.T) {
+		streaming := middleware.ETag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+		}))
+		rr := httptest.NewRecorder()
+		streaming.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.True(t, rr.Flushed)
+		assert.Empty(t, rr.Header().Get("ETag"))
+		assert.Equal(t, "chunk", rr.Body.String())
+	})
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	current := middleware.VersionETag("doc-1", 7)
+
+	check := func(ifMatch, etag string) (*httptest.ResponseRecorder, bool) {
+		req := httptest.NewRequest(http.MethodPut, "/", nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		return rr, middleware.CheckIfMatch(rr, req, etag)
+	}
+
+	_, ok := check(`"doc-1-7"`, current)
+	assert.True(t, ok)
+	_, ok = check(`"doc-1-6", "doc-1-7"`, current)
+	assert.True(t, ok)
+	_, ok = check("*", current)
+	assert.True(t, ok)
+	_, ok = check("", current)
+	assert.True(t, ok, "no precondition")
+
+	rr, ok := check(`"doc-1-6"`, current)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	_, ok = check(`"doc-1-7-br"`, current)
+	assert.True(t, ok, "encoding suffixes added by compression are ignored")
+	_, ok = check(`W/"doc-1-7"`, current)
+	assert.False(t, ok, "weak tags never match strongly")
+	_, ok = check("*", "")
+	assert.False(t, ok, "star requires an existing resource")
+}
+
+func TestETagBehindCompression(t *testing.T) {
+	current := middleware.VersionETag("doc-1", 7)
+	body := `{"items":"` + strings.Repeat("x", 4096) + `"}`
+	handler := middleware.CompressionMiddleware(middleware.CompressionConfig{Enabled: true})(
+		middleware.ETag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				if middleware.CheckIfMatch(w, r, current) {
+					w.WriteHeader(http.StatusNoContent)
+				}
+				return
+			}
+			middleware.SetETag(w, current)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		})))
+	serve := func(method string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/docs/1", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodGet)
+	require.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	etag := rr.Header().Get("ETag")
+	assert.Equal(t, `"doc-1-7-gzip"`, etag, "compressed responses keep a strong ETag")
+
+	rr = serve(http.MethodGet, "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodPut, "If-Match", etag).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(http.MethodPut, "If-Match", `"doc-1-6-gzip"`).Code)
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	handler := middleware.RequireIfMatch(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/", nil))
+	assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+
+	req := httptest.NewRequest(http.MethodPatch, "/", nil)
+	req.Header.Set("If-Match", `"v1"`)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestVersionETag(t *testing.T) {
+	ts := time.Unix(0, 1700000000000000000)
+	assert.Equal(t, `"42-1700000000000000000"`, middleware.VersionETag(42, ts))
+
+	quoted := middleware.VersionETag(`has "quotes" and spaces`)
+	require.True(t, strings.HasPrefix(quoted, `"`))
+	assert.Len(t, quoted, 34, "unsafe values are hashed")
+}
@@ -0,0 +1,326 @@
+// Package idempotency implements the Idempotency-Key header for unsafe HTTP methods:
+// the first response for a key is stored and replayed to retries of the same request.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/middleware"
+)
+
+const (
+	// HeaderKey is the request header carrying the client-chosen idempotency key.
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed is set to "true" on responses replayed from the store.
+	HeaderReplayed = "Idempotent-Replayed"
+
+	// DefaultTTL is how long completed responses are kept.
+	DefaultTTL = 24 * time.Hour
+	// DefaultLockTimeout is how long an in-flight request holds its key. A request
+	// still running after this may be executed again by a retry.
+	DefaultLockTimeout = time.Minute
+	// DefaultMaxKeyLength bounds the length of accepted keys.
+	DefaultMaxKeyLength = 255
+	// DefaultMaxBodySize bounds the request bodies read for the fingerprint.
+	DefaultMaxBodySize = 1 << 20
+	// DefaultMaxResponseSize bounds the responses kept in the store.
+	DefaultMaxResponseSize = 1 << 20
+)
+
+// Response is a stored response.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Record is the state of a key in the store.
+type Record struct {
+	// Fingerprint identifies the request body the key was first used with.
+	Fingerprint string
+	// Response is nil while the first request is still in flight.
+	Response *Response
+}
+
+// Store persists idempotency records. Implementations must make Begin atomic, since
+// concurrent duplicates race on it.
+//
+// Each claim gets a token, and Complete and Release only act on the claim holding it.
+// A request that outlives its claim therefore cannot release or overwrite the claim a
+// retry took over after lockTimeout.
+type Store interface {
+	// Begin claims key for a new request and returns the claim token. If the key is
+	// already taken (in flight or completed), the existing record is returned and the
+	// token is empty. A claim lasts lockTimeout unless completed or released.
+	Begin(ctx context.Context, key, fingerprint string, lockTimeout time.Duration) (rec *Record, token string, err error)
+	// Complete stores the response of the claim for ttl. It does nothing if the claim
+	// has expired or the key no longer holds it.
+	Complete(ctx context.Context, key, token string, resp *Response, ttl time.Duration) error
+	// Release drops an in-flight claim so that a retry runs the request again. It does
+	// nothing if the key no longer holds that claim.
+	Release(ctx context.Context, key, token string) error
+}
+
+// Config holds the settings for Middleware.
+type Config struct {
+	Store Store
+	// Methods the middleware applies to. Defaults to POST and PATCH.
+	Methods []string
+	// Required rejects requests without an Idempotency-Key with 400.
+	Required bool
+	// TTL defaults to DefaultTTL.
+	TTL time.Duration
+	// LockTimeout defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+	// MaxKeyLength defaults to DefaultMaxKeyLength.
+	MaxKeyLength int
+	// MaxBodySize defaults to DefaultMaxBodySize. Keyed requests with larger bodies
+	// are rejected with 413.
+	MaxBodySize int64
+	// MaxResponseSize defaults to DefaultMaxResponseSize. Larger responses are sent
+	// but not stored; their key is released, so a retry runs the request again.
+	MaxResponseSize int
+}
+
+// skippedReplayHeaders are set per response and are not replayed.
+var skippedReplayHeaders = map[string]bool{
+	"Date":                  true,
+	"X-Request-Id":          true,
+	"X-Ratelimit-Limit":     true,
+	"X-Ratelimit-Remaining": true,
+	"X-Ratelimit-Reset":     true,
+}
+
+// Middleware honours the Idempotency-Key header. The first response for a key, scoped to
+// the authenticated user (or anonymous) and the method and path, is stored and replayed
+// to retries. A duplicate arriving while the first request is still running gets 409,
+// and reusing a key with a different request body gets 422.
+//
+// Server errors (5xx), panics and responses over MaxResponseSize release the key
+// instead of storing the response, so clients can retry them. It must run after
+// authentication. It panics without a Store.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	if cfg.Store == nil {
+		panic("idempotency: Middleware requires a Store")
+	}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = DefaultLockTimeout
+	}
+	if cfg.MaxKeyLength <= 0 {
+		cfg.MaxKeyLength = DefaultMaxKeyLength
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	if cfg.MaxResponseSize <= 0 {
+		cfg.MaxResponseSize = DefaultMaxResponseSize
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cfg.appliesTo(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			idemKey := r.Header.Get(HeaderKey)
+			if idemKey == "" {
+				if cfg.Required {
+					jsonResponse.SendErrorResponse(w, fmt.Errorf("%s header is required", HeaderKey), http.StatusBadRequest)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(idemKey) > cfg.MaxKeyLength {
+				jsonResponse.SendErrorResponse(w, fmt.Errorf("%s header is too long", HeaderKey), http.StatusBadRequest)
+				return
+			}
+
+			ctx := r.Context()
+			logger := middleware.GetLoggerFromContext(ctx)
+
+			tooLarge := fmt.Errorf("request body exceeds the limit of %d bytes", cfg.MaxBodySize)
+			if r.ContentLength > cfg.MaxBodySize {
+				jsonResponse.SendErrorResponse(w, tooLarge, http.StatusRequestEntityTooLarge)
+				return
+			}
+			body, err := io.ReadAll(io.LimitReader(r.Body, cfg.MaxBodySize+1))
+			if err != nil {
+				jsonResponse.SendErrorResponse(w, fmt.Errorf("failed to read request body"), http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > cfg.MaxBodySize {
+				jsonResponse.SendErrorResponse(w, tooLarge, http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := storeKey(r, idemKey)
+			fingerprint := hashParts(r.Method, r.URL.Path, string(body))
+
+			rec, token, err := cfg.Store.Begin(ctx, key, fingerprint, cfg.LockTimeout)
+			if err != nil {
+				// Running the request without the guard could duplicate it, so refuse instead.
+				logger.Error("Idempotency store failed", "error", err)
+				jsonResponse.SendErrorResponse(w, fmt.Errorf("idempotency check failed, please retry"), http.StatusServiceUnavailable)
+				return
+			}
+
+			if token == "" {
+				switch {
+				case rec.Fingerprint != fingerprint:
+					jsonResponse.SendErrorResponse(w, fmt.Errorf("%s was already used with a different request", HeaderKey), http.StatusUnprocessableEntity)
+				case rec.Response == nil:
+					w.Header().Set("Retry-After", "1")
+					jsonResponse.SendErrorResponse(w, fmt.Errorf("a request with this %s is already in progress", HeaderKey), http.StatusConflict)
+				default:
+					replay(w, rec.Response)
+				}
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w, statusCode: http.StatusOK, maxSize: cfg.MaxResponseSize}
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				// Panicked or failed: let the next retry run the request again.
+				if err := cfg.Store.Release(context.WithoutCancel(ctx), key, token); err != nil {
+					logger.Error("Failed to release idempotency key", "error", err)
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+
+			if rw.statusCode >= http.StatusInternalServerError {
+				return
+			}
+			if rw.overflow {
+				logger.Warn("Idempotent response too large to store", "limit", cfg.MaxResponseSize)
+				return
+			}
+			resp := &Response{StatusCode: rw.statusCode, Header: rw.header, Body: rw.body.Bytes()}
+			if resp.Header == nil {
+				resp.Header = rw.Header().Clone()
+			}
+			if err := cfg.Store.Complete(context.WithoutCancel(ctx), key, token, resp, cfg.TTL); err != nil {
+				logger.Error("Failed to store idempotent response", "error", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+func (c Config) appliesTo(method string) bool {
+	for _, m := range c.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeKey scopes the client key to the user and route, so keys from different
+// users or endpoints never collide.
+func storeKey(r *http.Request, idemKey string) string {
+	user := "anonymous"
+	if u, ok := middleware.GetUserFromContext(r.Context()); ok && u != nil {
+		user = u.ID
+		if u.APIKeyID != "" {
+			user = "key:" + u.APIKeyID
+		}
+	}
+	return hashParts(user, r.Method, r.URL.Path, idemKey)
+}
+
+// newClaimToken returns a random token identifying a single claim of a key.
+func newClaimToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate claim token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashParts(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		// Length prefixes keep ("ab","c") and ("a","bc") apart.
+		fmt.Fprintf(h, "%d:%s", len(p), p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, resp *Response) {
+	for k, values := range resp.Header {
+		if skippedReplayHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		w.Header()[k] = append([]string(nil), values...)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// recordingWriter passes the response through while keeping a copy of it. The copy
+// is dropped once the body exceeds maxSize.
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	header      http.Header
+	body        bytes.Buffer
+	maxSize     int
+	overflow    bool
+	wroteHeader bool
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		rw.statusCode = code
+		rw.header = rw.ResponseWriter.Header().Clone()
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(data []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !rw.overflow {
+		if rw.body.Len()+len(data) <= rw.maxSize {
+			rw.body.Write(data)
+		} else {
+			rw.overflow = true
+			rw.body = bytes.Buffer{}
+		}
+	}
+	return rw.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher so streaming handlers keep working.
+func (rw *recordingWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,324 @@
+package idempotency_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/middleware/idempotency"
+	"github.com/shashtag-ventures/go-common/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runStoreTests exercises the Store contract shared by all implementations.
+func runStoreTests(t *testing.T, store idempotency.Store) {
+	ctx := context.Background()
+	var token1 string
+
+	t.Run("First Begin claims the key", func(t *testing.T) {
+		rec, token, err := store.Begin(ctx, "k1", "fp1", time.Minute)
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.Nil(t, rec)
+		token1 = token
+
+		rec, token, err = store.Begin(ctx, "k1", "fp1", time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, token)
+		require.NotNil(t, rec)
+		assert.Equal(t, "fp1", rec.Fingerprint)
+		assert.Nil(t, rec.Response, "still in flight")
+	})
+
+	t.Run("Complete stores the response", func(t *testing.T) {
+		resp := &idempotency.Response{
+			StatusCode: http.StatusCreated,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       []byte(`{"id":1}`),
+		}
+		require.NoError(t, store.Complete(ctx, "k1", "other", resp, time.Hour))
+		rec, _, err := store.Begin(ctx, "k1", "fp1", time.Minute)
+		require.NoError(t, err)
+		assert.Nil(t, rec.Response, "another claim's token is ignored")
+
+		require.NoError(t, store.Complete(ctx, "k1", token1, resp, time.Hour))
+		rec, token, err := store.Begin(ctx, "k1", "fp1", time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, token)
+		require.NotNil(t, rec.Response)
+		assert.Equal(t, http.StatusCreated, rec.Response.StatusCode)
+		assert.Equal(t, "application/json", rec.Response.Header.Get("Content-Type"))
+		assert.Equal(t, `{"id":1}`, string(rec.Response.Body))
+	})
+
+	t.Run("Release frees an in-flight key only", func(t *testing.T) {
+		_, token, err := store.Begin(ctx, "k2", "fp2", time.Minute)
+		require.NoError(t, err)
+		require.NotEmpty(t, token)
+
+		require.NoError(t, store.Release(ctx, "k2", "other"))
+		_, retry, err := store.Begin(ctx, "k2", "fp2", time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, retry, "another claim's token is ignored")
+
+		require.NoError(t, store.Release(ctx, "k2", token))
+		_, token, err = store.Begin(ctx, "k2", "fp2", time.Minute)
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		require.NoError(t, store.Release(ctx, "k1", token1))
+		_, token, err = store.Begin(ctx, "k1", "fp1", time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, token, "completed keys survive Release")
+	})
+
+	t.Run("Expired claims cannot touch the new claim", func(t *testing.T) {
+		_, stale, err := store.Begin(ctx, "k3", "fp3", time.Millisecond)
+		require.NoError(t, err)
+		require.NotEmpty(t, stale)
+
+		time.Sleep(5 * time.Millisecond)
+		_, token, err := store.Begin(ctx, "k3", "fp3", time.Minute)
+		require.NoError(t, err)
+		require.NotEmpty(t, token)
+
+		require.NoError(t, store.Release(ctx, "k3", stale))
+		require.NoError(t, store.Complete(ctx, "k3", stale, &idempotency.Response{StatusCode: http.StatusOK}, time.Hour))
+		rec, retry, err := store.Begin(ctx, "k3", "fp3", time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, retry, "the new claim is still held")
+		assert.Nil(t, rec.Response)
+	})
+
+	t.Run("Complete after expiry stores nothing", func(t *testing.T) {
+		_, token, err := store.Begin(ctx, "k4", "fp4", time.Millisecond)
+		require.NoError(t, err)
+		require.NotEmpty(t, token)
+
+		time.Sleep(5 * time.Millisecond)
+		require.NoError(t, store.Complete(ctx, "k4", token, &idempotency.Response{StatusCode: http.StatusOK}, time.Hour))
+
+		// A correct retry is not rejected for a missing fingerprint.
+		_, token, err = store.Begin(ctx, "k4", "fp4", time.Minute)
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, idempotency.NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	// miniredis does not expire keys on its own, so drive its clock from the real one.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				mr.FastForward(time.Millisecond)
+			}
+		}
+	}()
+
+	runStoreTests(t, idempotency.NewRedisStore(client, ""))
+}
+
+func TestPostgresStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	ctx := context.Background()
+	db, teardown := testutil.SetupTestDatabase(ctx)
+	defer teardown()
+
+	require.NoError(t, db.AutoMigrate(&idempotency.Key{}))
+
+	store := idempotency.NewPostgresStore(db)
+	runStoreTests(t, store)
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		_, token, err := store.Begin(ctx, "old", "fp", -time.Minute)
+		require.NoError(t, err)
+		require.NotEmpty(t, token)
+
+		n, err := store.DeleteExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := idempotency.Middleware(idempotency.Config{Store: idempotency.NewMemoryStore()})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			switch r.URL.Path {
+			case "/slow":
+				<-release
+			case "/fail":
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Location", "/builds/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"build":1}`))
+		}))
+
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(idempotency.HeaderKey, key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Replays the first response", func(t *testing.T) {
+		first := send("/deploy", "abc", `{"ref":"main"}`)
+		assert.Equal(t, http.StatusCreated, first.Code)
+
+		retry := send("/deploy", "abc", `{"ref":"main"}`)
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, `{"build":1}`, retry.Body.String())
+		assert.Equal(t, "/builds/1", retry.Header().Get("Location"))
+		assert.Equal(t, "true", retry.Header().Get(idempotency.HeaderReplayed))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("Rejects a reused key with a different body", func(t *testing.T) {
+		rr := send("/deploy", "abc", `{"ref":"dev"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("Keys are scoped to the route", func(t *testing.T) {
+		before := calls.Load()
+		rr := send("/other", "abc", `{"ref":"main"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, before+1, calls.Load())
+	})
+
+	t.Run("Rejects concurrent duplicates", func(t *testing.T) {
+		before := calls.Load()
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- send("/slow", "slow-key", "") }()
+
+		require.Eventually(t, func() bool { return calls.Load() == before+1 }, time.Second, time.Millisecond)
+		rr := send("/slow", "slow-key", "")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+		close(release)
+		assert.Equal(t, http.StatusCreated, (<-done).Code)
+	})
+
+	t.Run("Server errors release the key", func(t *testing.T) {
+		before := calls.Load()
+		assert.Equal(t, http.StatusInternalServerError, send("/fail", "fail-key", "").Code)
+		assert.Equal(t, http.StatusInternalServerError, send("/fail", "fail-key", "").Code)
+		assert.Equal(t, before+2, calls.Load())
+	})
+
+	t.Run("Requests without a key pass through", func(t *testing.T) {
+		before := calls.Load()
+		send("/deploy", "", "")
+		send("/deploy", "", "")
+		assert.Equal(t, before+2, calls.Load())
+	})
+}
+
+func TestMiddleware_Options(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("Required key", func(t *testing.T) {
+		handler := idempotency.Middleware(idempotency.Config{Store: idempotency.NewMemoryStore(), Required: true})(next)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, rr.Code, "safe methods are not checked")
+	})
+
+	t.Run("Keys are scoped to the user", func(t *testing.T) {
+		var calls int
+		handler := idempotency.Middleware(idempotency.Config{Store: idempotency.NewMemoryStore()})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+
+		for _, userID := range []string{"u1", "u2", "u1"} {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set(idempotency.HeaderKey, "same")
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, &middleware.AuthenticatedUser{ID: userID}))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Size limits", func(t *testing.T) {
+		var calls int
+		handler := idempotency.Middleware(idempotency.Config{Store: idempotency.NewMemoryStore(), MaxBodySize: 8, MaxResponseSize: 8})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				io.Copy(w, r.Body)
+			}))
+		send := func(key, body string, contentLength int64) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set(idempotency.HeaderKey, key)
+			req.ContentLength = contentLength
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, send("big", "123456789", 9).Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, send("big", "123456789", -1).Code, "unknown length")
+		assert.Equal(t, 0, calls)
+
+		assert.Equal(t, "12345678", send("fits", "12345678", -1).Body.String())
+		assert.Equal(t, "true", send("fits", "12345678", -1).Header().Get(idempotency.HeaderReplayed))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Large responses are not stored", func(t *testing.T) {
+		var calls int
+		handler := idempotency.Middleware(idempotency.Config{Store: idempotency.NewMemoryStore(), MaxResponseSize: 4})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Write([]byte("abc"))
+				w.Write([]byte("def"))
+			}))
+		for range 2 {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set(idempotency.HeaderKey, "same")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, "abcdef", rr.Body.String())
+			assert.Empty(t, rr.Header().Get(idempotency.HeaderReplayed))
+		}
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Panics without a store", func(t *testing.T) {
+		assert.Panics(t, func() { idempotency.Middleware(idempotency.Config{}) })
+	})
+}
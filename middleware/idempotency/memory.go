@@ -0,0 +1,87 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval controls how often the memory store drops expired entries.
+const sweepInterval = time.Minute
+
+type memoryEntry struct {
+	record    Record
+	token     string
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-process Store. It is suitable for tests and single-instance
+// deployments; keys are lost on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+func (s *MemoryStore) Begin(_ context.Context, key, fingerprint string, lockTimeout time.Duration) (*Record, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked()
+
+	now := s.now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expiresAt) {
+		rec := e.record
+		return &rec, "", nil
+	}
+	token, err := newClaimToken()
+	if err != nil {
+		return nil, "", err
+	}
+	s.entries[key] = memoryEntry{record: Record{Fingerprint: fingerprint}, token: token, expiresAt: now.Add(lockTimeout)}
+	return nil, token, nil
+}
+
+func (s *MemoryStore) Complete(_ context.Context, key, token string, resp *Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.token != token || e.record.Response != nil || !s.now().Before(e.expiresAt) {
+		return nil
+	}
+	e.record.Response = resp
+	e.expiresAt = s.now().Add(ttl)
+	s.entries[key] = e
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.token == token && e.record.Response == nil {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// sweepLocked removes expired entries at most once per sweepInterval.
+// The caller must hold the lock.
+func (s *MemoryStore) sweepLocked() {
+	now := s.now()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Key is a single idempotency row. ExpiresAt is the lock timeout while the request is
+// in flight and the retention time once Completed is set.
+type Key struct {
+	Key         string `gorm:"primaryKey"`
+	Fingerprint string
+	Token       string
+	Completed   bool
+	StatusCode  int
+	Header      http.Header `gorm:"type:jsonb;serializer:json"`
+	Body        []byte
+	ExpiresAt   time.Time `gorm:"index"`
+	CreatedAt   time.Time
+}
+
+// TableName overrides the default table name.
+func (Key) TableName() string {
+	return "idempotency_keys"
+}
+
+// PostgresStore is a Store backed by a single GORM table.
+// Run db.AutoMigrate(&idempotency.Key{}) before use.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore creates a Store that persists keys via GORM.
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Begin(ctx context.Context, key, fingerprint string, lockTimeout time.Duration) (*Record, string, error) {
+	token, err := newClaimToken()
+	if err != nil {
+		return nil, "", err
+	}
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+	row := &Key{Key: key, Fingerprint: fingerprint, Token: token, ExpiresAt: now.Add(lockTimeout)}
+
+	// Insert, or take over a row whose lock or retention has run out.
+	res := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"fingerprint": row.Fingerprint,
+			"token":       row.Token,
+			"completed":   false,
+			"status_code": 0,
+			"header":      nil,
+			"body":        nil,
+			"expires_at":  row.ExpiresAt,
+			"created_at":  now,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Lte{Column: clause.Column{Table: "idempotency_keys", Name: "expires_at"}, Value: now},
+		}},
+	}).Create(row)
+	if res.Error != nil {
+		return nil, "", res.Error
+	}
+	if res.RowsAffected == 1 {
+		return nil, token, nil
+	}
+
+	var existing Key
+	if err := db.Where("key = ?", key).Take(&existing).Error; err != nil {
+		return nil, "", err
+	}
+	rec := &Record{Fingerprint: existing.Fingerprint}
+	if existing.Completed {
+		rec.Response = &Response{StatusCode: existing.StatusCode, Header: existing.Header, Body: existing.Body}
+	}
+	return rec, "", nil
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, key, token string, resp *Response, ttl time.Duration) error {
+	row := &Key{
+		Completed:  true,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       resp.Body,
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	return s.db.WithContext(ctx).Model(&Key{}).
+		Where("key = ? AND token = ? AND completed = ? AND expires_at > ?", key, token, false, time.Now()).
+		Select("completed", "status_code", "header", "body", "expires_at").
+		Updates(row).Error
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key, token string) error {
+	return s.db.WithContext(ctx).Where("key = ? AND token = ? AND completed = ?", key, token, false).Delete(&Key{}).Error
+}
+
+// DeleteExpired removes keys past their retention. Call it periodically, e.g. from a worker task.
+func (s *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	res := s.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&Key{})
+	return res.RowsAffected, res.Error
+}
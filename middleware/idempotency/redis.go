@@ -0,0 +1,118 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix is the key prefix used when none is configured.
+const DefaultRedisPrefix = "idempotency:"
+
+// RedisStore is a Store backed by Redis keys with TTLs, so expired entries
+// disappear without a cleanup job.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a Store using the given Redis client.
+// An empty prefix falls back to DefaultRedisPrefix.
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// redisEntry is the value stored under a key.
+type redisEntry struct {
+	Record
+	Token string
+}
+
+func (s *RedisStore) Begin(ctx context.Context, key, fingerprint string, lockTimeout time.Duration) (*Record, string, error) {
+	token, err := newClaimToken()
+	if err != nil {
+		return nil, "", err
+	}
+	claim, err := json.Marshal(redisEntry{Record: Record{Fingerprint: fingerprint}, Token: token})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The key can expire between SETNX and GET; one more attempt then claims it.
+	for attempt := 0; attempt < 2; attempt++ {
+		ok, err := s.client.SetNX(ctx, s.prefix+key, claim, lockTimeout).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		if ok {
+			return nil, token, nil
+		}
+
+		_, entry, err := s.get(ctx, key)
+		if err != nil {
+			return nil, "", err
+		}
+		if entry == nil {
+			continue
+		}
+		return &entry.Record, "", nil
+	}
+	return nil, "", errors.New("idempotency key changed concurrently")
+}
+
+func (s *RedisStore) Complete(ctx context.Context, key, token string, resp *Response, ttl time.Duration) error {
+	raw, entry, err := s.get(ctx, key)
+	if err != nil || entry == nil || entry.Token != token || entry.Response != nil {
+		return err
+	}
+	entry.Response = resp
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return swapScript.Run(ctx, s.client, []string{s.prefix + key}, raw, data, ttl.Milliseconds()).Err()
+}
+
+func (s *RedisStore) Release(ctx context.Context, key, token string) error {
+	raw, entry, err := s.get(ctx, key)
+	if err != nil || entry == nil || entry.Token != token || entry.Response != nil {
+		return err
+	}
+	return swapScript.Run(ctx, s.client, []string{s.prefix + key}, raw).Err()
+}
+
+// get returns the raw and decoded entry of key, or a nil entry if there is none.
+func (s *RedisStore) get(ctx context.Context, key string) ([]byte, *redisEntry, error) {
+	raw, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var entry redisEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, nil, err
+	}
+	return raw, &entry, nil
+}
+
+// swapScript replaces the key with ARGV[2] for ARGV[3] milliseconds, or deletes it if
+// no replacement is given, but only while it still holds ARGV[1].
+var swapScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] then
+	return redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+end
+return redis.call("DEL", KEYS[1])
+`)
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 
 	customErrors "github.com/shashtag-ventures/go-common/errors"
@@ -10,28 +11,101 @@ import (
 	"github.com/shashtag-ventures/go-common/jwt"
 )
 
+// UserMapper builds the AuthenticatedUser from verified claims. The raw token is
+// passed along so mappers can re-parse it into an application-specific claims type.
+type UserMapper func(ctx context.Context, claims *jwt.Claims, rawToken string) (*AuthenticatedUser, error)
+
+// JWTAuthConfig holds the configuration for JWTAuthMiddlewareWithConfig.
+type JWTAuthConfig struct {
+	Secret string
+	// Extractors are tried in order until one yields a token.
+	// Defaults to the jwt_token cookie only.
+	Extractors []TokenExtractor
+	// Optional lets requests without any token through without a user in context.
+	// Requests carrying an invalid token are still rejected.
+	Optional bool
+	// MapUser overrides how claims become an AuthenticatedUser.
+	MapUser UserMapper
+	// Validation restricts accepted tokens to an issuer and audience. Set both so
+	// a token minted for another service is rejected.
+	Validation jwt.ParseOptions
+	// Revocations is consulted after the token signature and expiry are verified.
+	// Leave nil to skip revocation checks.
+	Revocations jwt.RevocationStore
+	// RevocationFailOpen lets requests through when the revocation store is unreachable.
+	// By default such requests are rejected with 503.
+	RevocationFailOpen bool
+}
+
 // JWTAuthMiddleware creates a middleware that authenticates requests using a JWT from a cookie.
 func JWTAuthMiddleware(jwtSecret string) func(next http.Handler) http.Handler {
+	return JWTAuthMiddlewareWithConfig(JWTAuthConfig{Secret: jwtSecret})
+}
+
+// JWTAuthMiddlewareWithConfig is like JWTAuthMiddleware but supports other token sources,
+// optional authentication and additional checks such as a revocation denylist.
+func JWTAuthMiddlewareWithConfig(cfg JWTAuthConfig) func(next http.Handler) http.Handler {
+	missingMsg := "missing authentication token"
+	if len(cfg.Extractors) == 0 {
+		cfg.Extractors = []TokenExtractor{CookieTokenExtractor(JWTCookieName)}
+		missingMsg = "missing jwt cookie"
+	}
+	if cfg.MapUser == nil {
+		cfg.MapUser = defaultUserMapper
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cookie, err := r.Cookie("jwt_token")
+			tokenString := extractToken(r, cfg.Extractors)
+			if tokenString == "" {
+				if cfg.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				jsonResponse.SendErrorResponse(w, customErrors.New(missingMsg, nil), http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := jwt.ParseTokenWithClaims[jwt.Claims](tokenString, cfg.Secret, cfg.Validation)
 			if err != nil {
-				jsonResponse.SendErrorResponse(w, customErrors.New("missing jwt cookie", err), http.StatusUnauthorized)
+				jsonResponse.SendErrorResponse(w, fmt.Errorf("invalid or expired token: %w", err), http.StatusUnauthorized)
 				return
 			}
 
-			tokenString := cookie.Value
+			// Only tokens that passed signature and expiry checks reach the store,
+			// so garbage tokens never cost a round-trip.
+			if cfg.Revocations != nil {
+				revoked, err := jwt.IsTokenRevoked(r.Context(), cfg.Revocations, claims)
+				if err != nil {
+					GetLoggerFromContext(r.Context()).Error("Failed to check token revocation", "error", err)
+					if !cfg.RevocationFailOpen {
+						jsonResponse.SendErrorResponse(w, customErrors.New("unable to verify token", nil), http.StatusServiceUnavailable)
+						return
+					}
+				} else if revoked {
+					jsonResponse.SendErrorResponse(w, customErrors.New("token has been revoked", customErrors.ErrUnauthorized), http.StatusUnauthorized)
+					return
+				}
+			}
 
-			claims, err := jwt.ParseToken(tokenString, jwtSecret)
+			authenticatedUser, err := cfg.MapUser(r.Context(), claims, tokenString)
 			if err != nil {
-				jsonResponse.SendErrorResponse(w, fmt.Errorf("invalid or expired token: %w", err), http.StatusUnauthorized)
+				jsonResponse.SendErrorResponse(w, fmt.Errorf("invalid token claims: %w", err), http.StatusUnauthorized)
+				return
+			}
+			if authenticatedUser == nil {
+				jsonResponse.SendErrorResponse(w, customErrors.New("invalid token claims", nil), http.StatusUnauthorized)
 				return
 			}
 
-			authenticatedUser := &AuthenticatedUser{
-				ID:    claims.UserID,
-				Email: "", // Email is not in claims
-				Role:  claims.Role,
+			// Set the actor even for custom mappers, so an impersonation token can never
+			// pass for the user's own.
+			if claims.IsImpersonation() && authenticatedUser.ImpersonatedBy == nil {
+				authenticatedUser.ImpersonatedBy = &AuthenticatedUser{
+					ID:    claims.Actor.UserID,
+					Email: claims.Actor.Email,
+					Role:  claims.Actor.Role,
+				}
 			}
 
 			// NEW: Capture UserID in the mutable log state for the outer logger
@@ -40,7 +114,27 @@ func JWTAuthMiddleware(jwtSecret string) func(next http.Handler) http.Handler {
 			}
 
 			ctx := context.WithValue(r.Context(), UserContextKey, authenticatedUser)
+			if authenticatedUser.IsImpersonated() {
+				// Every log line of the request names the real actor next to the effective user.
+				ctx = EnrichLogger(ctx, slog.String("impersonator_id", authenticatedUser.ImpersonatedBy.ID))
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// defaultUserMapper copies the standard claims onto an AuthenticatedUser.
+func defaultUserMapper(_ context.Context, claims *jwt.Claims, _ string) (*AuthenticatedUser, error) {
+	user := &AuthenticatedUser{
+		ID:       claims.UserID,
+		Email:    claims.Email,
+		Role:     claims.Role,
+		Scopes:   claims.Scopes,
+		TenantID: claims.TenantID,
+		TokenID:  claims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		user.TokenExpiresAt = claims.ExpiresAt.Time
+	}
+	return user, nil
+}
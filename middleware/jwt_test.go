@@ -1,12 +1,15 @@
 package middleware_test
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/shashtag-ventures/go-common/jwt"
+	"github.com/shashtag-ventures/go-common/jwt/revocation"
 	"github.com/shashtag-ventures/go-common/middleware"
 	"github.com/stretchr/testify/assert"
 )
@@ -77,3 +80,246 @@ func TestJWTAuthMiddleware(t *testing.T) {
 		assert.Contains(t, rr.Body.String(), "invalid or expired token")
 	})
 }
+
+func TestJWTAuthMiddlewareWithRevocation(t *testing.T) {
+	secret := "test-secret"
+	store := revocation.NewMemoryStore()
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.GetUserFromContext(r.Context())
+		w.Header().Set("X-Token-ID", user.TokenID)
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := middleware.JWTAuthMiddlewareWithConfig(middleware.JWTAuthConfig{
+		Secret:      secret,
+		Revocations: store,
+	})(nextHandler)
+
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "jwt_token", Value: token})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Token not revoked", func(t *testing.T) {
+		token, _ := jwt.CreateToken("1", "user", secret, time.Hour)
+		claims, _ := jwt.ParseToken(token, secret)
+
+		rr := serve(token)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, claims.ID, rr.Header().Get("X-Token-ID"))
+	})
+
+	t.Run("Revoked token ID", func(t *testing.T) {
+		token, _ := jwt.CreateToken("2", "user", secret, time.Hour)
+		claims, _ := jwt.ParseToken(token, secret)
+		assert.NoError(t, jwt.RevokeToken(context.Background(), store, claims))
+
+		rr := serve(token)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), "token has been revoked")
+	})
+
+	t.Run("User-wide revocation", func(t *testing.T) {
+		token, _ := jwt.CreateToken("3", "user", secret, time.Hour)
+		assert.NoError(t, store.RevokeUser(context.Background(), "3", time.Now(), time.Now().Add(time.Hour)))
+
+		rr := serve(token)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Store failure fails closed", func(t *testing.T) {
+		failing := middleware.JWTAuthMiddlewareWithConfig(middleware.JWTAuthConfig{
+			Secret:      secret,
+			Revocations: failingRevocationStore{},
+		})(nextHandler)
+		token, _ := jwt.CreateToken("4", "user", secret, time.Hour)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "jwt_token", Value: token})
+		rr := httptest.NewRecorder()
+
+		failing.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
+
+type failingRevocationStore struct{}
+
+func (failingRevocationStore) Revoke(context.Context, string, time.Time) error {
+	return errors.New("store down")
+}
+
+func (failingRevocationStore) RevokeUser(context.Context, string, time.Time, time.Time) error {
+	return errors.New("store down")
+}
+
+func (failingRevocationStore) IsRevoked(context.Context, string, string, time.Time) (bool, error) {
+	return false, errors.New("store down")
+}
+
+func TestJWTAuthMiddlewareWithValidation(t *testing.T) {
+	secret := "test-secret"
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.GetUserFromContext(r.Context())
+		w.Header().Set("X-User-Email", user.Email)
+		w.Header().Set("X-User-Tenant", user.TenantID)
+		if user.HasScope("project:write") {
+			w.Header().Set("X-Can-Write", "true")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := middleware.JWTAuthMiddlewareWithConfig(middleware.JWTAuthConfig{
+		Secret:     secret,
+		Validation: jwt.ParseOptions{Issuer: "auth", Audience: "deploy-api"},
+	})(nextHandler)
+
+	mint := func(audience string) string {
+		token, err := jwt.CreateTokenWithClaims(&jwt.Claims{
+			UserID:   "1",
+			Email:    "jane@example.com",
+			Scopes:   []string{"project:write"},
+			TenantID: "acme",
+		}, secret, jwt.TokenOptions{TTL: time.Hour, Issuer: "auth", Audience: []string{audience}})
+		assert.NoError(t, err)
+		return token
+	}
+
+	t.Run("Matching issuer and audience populates user", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "jwt_token", Value: mint("deploy-api")})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "jane@example.com", rr.Header().Get("X-User-Email"))
+		assert.Equal(t, "acme", rr.Header().Get("X-User-Tenant"))
+		assert.Equal(t, "true", rr.Header().Get("X-Can-Write"))
+	})
+
+	t.Run("Token for another service is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "jwt_token", Value: mint("billing-api")})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestJWTAuthMiddlewareExtractors(t *testing.T) {
+	secret := "test-secret"
+	token, _ := jwt.CreateToken("7", "member", secret, time.Hour)
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := middleware.GetUserFromContext(r.Context()); ok {
+			w.Header().Set("X-User-ID", user.ID)
+			w.Header().Set("X-User-Role", user.Role)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	cfg := middleware.JWTAuthConfig{
+		Secret: secret,
+		Extractors: []middleware.TokenExtractor{
+			middleware.BearerTokenExtractor(),
+			middleware.CookieTokenExtractor(middleware.JWTCookieName),
+			middleware.QueryTokenExtractor("access_token"),
+		},
+	}
+	handler := middleware.JWTAuthMiddlewareWithConfig(cfg)(nextHandler)
+
+	t.Run("Bearer header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "7", rr.Header().Get("X-User-ID"))
+	})
+
+	t.Run("Header takes precedence over cookie", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "bearer "+token)
+		req.AddCookie(&http.Cookie{Name: middleware.JWTCookieName, Value: "garbage"})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Query param only for websocket upgrades", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/ws?access_token="+token, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), "missing authentication token")
+
+		req = httptest.NewRequest(http.MethodGet, "/ws?access_token="+token, nil)
+		req.Header.Set("Upgrade", "websocket")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Optional auth lets anonymous requests through", func(t *testing.T) {
+		optional := cfg
+		optional.Optional = true
+		h := middleware.JWTAuthMiddlewareWithConfig(optional)(nextHandler)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("X-User-ID"))
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer invalid")
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Custom user mapper", func(t *testing.T) {
+		mapped := cfg
+		mapped.MapUser = func(_ context.Context, claims *jwt.Claims, _ string) (*middleware.AuthenticatedUser, error) {
+			if claims.Role == "banned" {
+				return nil, errors.New("user is banned")
+			}
+			return &middleware.AuthenticatedUser{ID: "mapped-" + claims.UserID, Role: claims.Role}, nil
+		}
+		h := middleware.JWTAuthMiddlewareWithConfig(mapped)(nextHandler)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, "mapped-7", rr.Header().Get("X-User-ID"))
+
+		banned, _ := jwt.CreateToken("8", "banned", secret, time.Hour)
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+banned)
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), "user is banned")
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Empty(t, middleware.BearerToken(req))
+
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	assert.Empty(t, middleware.BearerToken(req))
+
+	req.Header.Set("Authorization", "Bearer abc")
+	assert.Equal(t, "abc", middleware.BearerToken(req))
+}
@@ -4,112 +4,260 @@ import (
 	"bytes"
 	"io"
 	"log/slog"
+	"math/rand/v2"
+	"mime"
 	"net/http"
-	"regexp"
+	"path"
 	"strings"
 	"time"
+
+	"github.com/shashtag-ventures/go-common/logging"
 )
 
+// DefaultSlowRequestThreshold is the duration above which requests are logged as warnings.
+const DefaultSlowRequestThreshold = 500 * time.Millisecond
+
+// DefaultLogSkipPaths are not logged unless RequestLoggerConfig.SkipPaths is set.
+var DefaultLogSkipPaths = []string{"/health", "/api/*/health"}
+
+// DefaultRedactedHeaders are masked when captured, unless RequestLoggerConfig.RedactHeaders is set.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-CSRF-Token"}
+
+// DefaultBodyCaptureLimits capture textual bodies only. Entries ending in "/" match
+// every subtype.
+var DefaultBodyCaptureLimits = []BodyCaptureLimit{
+	{ContentType: "application/json", MaxBytes: 4096},
+	{ContentType: "application/problem+json", MaxBytes: 4096},
+	{ContentType: "application/x-www-form-urlencoded", MaxBytes: 4096},
+	{ContentType: "text/", MaxBytes: 4096},
+}
+
+// BodyCaptureLimit sets how much of a request or response body of a content type is logged.
+type BodyCaptureLimit struct {
+	ContentType string // Media type, or a type prefix ending in "/", e.g. "text/"
+	MaxBytes    int
+}
+
+// RequestLoggerConfig configures RequestLoggerMiddleware. The zero value logs every
+// request except health checks, as RequestLogger always has.
+type RequestLoggerConfig struct {
+	// SkipPaths are path.Match patterns for requests that are never logged. A trailing
+	// "/**" matches any depth, e.g. "/static/**". Defaults to DefaultLogSkipPaths.
+	SkipPaths []string
+	// SuccessSampleRate is the fraction (0-1) of fast, successful requests that are
+	// logged. Errors and slow requests are always logged. 0 means 1 (log all).
+	SuccessSampleRate float64
+	// SlowThreshold defaults to DefaultSlowRequestThreshold.
+	SlowThreshold time.Duration
+
+	// RequestHeaders and ResponseHeaders are logged under http.request_headers and
+	// http.response_headers. Headers in RedactHeaders are masked.
+	RequestHeaders  []string
+	ResponseHeaders []string
+	// RedactHeaders defaults to DefaultRedactedHeaders.
+	RedactHeaders []string
+
+	// BodyCaptureLimits select which request bodies, and which error response bodies,
+	// are logged and how much of them. Bodies of other types are not captured.
+	// Defaults to DefaultBodyCaptureLimits.
+	BodyCaptureLimits []BodyCaptureLimit
+	// SensitiveKeys are masked in captured JSON and form bodies. Defaults to
+	// logging.DefaultSensitiveKeys; use the same list as logging.Config.
+	SensitiveKeys []string
+}
+
+// requestLogger holds a RequestLoggerConfig with defaults applied.
+type requestLogger struct {
+	cfg       RequestLoggerConfig
+	redact    map[string]bool
+	sensitive *logging.SensitiveKeys
+}
+
+func newRequestLogger(cfg RequestLoggerConfig) *requestLogger {
+	if cfg.SkipPaths == nil {
+		cfg.SkipPaths = DefaultLogSkipPaths
+	}
+	if cfg.SuccessSampleRate <= 0 || cfg.SuccessSampleRate > 1 {
+		cfg.SuccessSampleRate = 1
+	}
+	if cfg.SlowThreshold <= 0 {
+		cfg.SlowThreshold = DefaultSlowRequestThreshold
+	}
+	if cfg.RedactHeaders == nil {
+		cfg.RedactHeaders = DefaultRedactedHeaders
+	}
+	if cfg.BodyCaptureLimits == nil {
+		cfg.BodyCaptureLimits = DefaultBodyCaptureLimits
+	}
+
+	l := &requestLogger{
+		cfg:       cfg,
+		redact:    make(map[string]bool, len(cfg.RedactHeaders)),
+		sensitive: logging.NewSensitiveKeys(cfg.SensitiveKeys...),
+	}
+	for _, h := range cfg.RedactHeaders {
+		l.redact[http.CanonicalHeaderKey(h)] = true
+	}
+	return l
+}
+
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
-	body       *bytes.Buffer
-	size       int
+	statusCode  int
+	wroteHeader bool
+	size        int
+	// Error bodies are captured up to captureLimit, which is decided on the first write
+	// from the content type.
+	body         *bytes.Buffer
+	captureLimit int
+	limitDecided bool
+	limitFor     func(contentType string) int
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
+	if !rw.wroteHeader && code >= 200 {
+		rw.wroteHeader = true
+		rw.statusCode = code
+	}
 	rw.ResponseWriter.WriteHeader(code)
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
 	if rw.statusCode >= 400 {
-		rw.body.Write(b)
+		if !rw.limitDecided {
+			rw.limitDecided = true
+			contentType := rw.Header().Get("Content-Type")
+			if contentType == "" {
+				contentType = http.DetectContentType(b) // What net/http will send
+			}
+			rw.captureLimit = rw.limitFor(contentType)
+		}
+		if room := rw.captureLimit - rw.body.Len(); room > 0 {
+			rw.body.Write(b[:min(room, len(b))])
+		}
 	}
 	n, err := rw.ResponseWriter.Write(b)
 	rw.size += n
 	return n, err
 }
 
-func getRealIP(r *http.Request) string {
-	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
-		return ip
-	}
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		return strings.Split(ip, ",")[0]
+// Flush implements http.Flusher so streaming responses (e.g. SSE) are not held back by the logger.
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
 	}
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
-	return r.RemoteAddr
 }
 
-var sensitivePattern = regexp.MustCompile(`(?i)("(?:password|token|secret|access_token|refresh_token)")\s*:\s*(?:"[^"]*"|[^,} \n\r]+)`)
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+var defaultSensitiveKeys = logging.NewSensitiveKeys()
 
 func scrubPayload(payload []byte) string {
-	if len(payload) == 0 {
-		return ""
-	}
 	// Regex replacement is faster and handles nested structures automatically
 	// It also preserves the original JSON formatting and works on malformed JSON
-	return sensitivePattern.ReplaceAllString(string(payload), `$1: "[MASKED]"`)
+	return defaultSensitiveKeys.ScrubJSON(payload)
 }
 
+// RequestLogger logs every request except health checks. See RequestLoggerMiddleware.
 func RequestLogger() func(http.Handler) http.Handler {
+	return RequestLoggerMiddleware(RequestLoggerConfig{})
+}
+
+// RequestLoggerMiddleware logs one line per request through the request's logger (see
+// RequestIDMiddleware), so the request ID and any attributes added with EnrichLogger
+// are included. Server errors are logged at error level, client errors and slow
+// requests at warn level, and the rest at info level, subject to SuccessSampleRate.
+func RequestLoggerMiddleware(cfg RequestLoggerConfig) func(http.Handler) http.Handler {
+	l := newRequestLogger(cfg)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/api/v1/health" || r.URL.Path == "/health" {
+			if l.skip(r.URL.Path) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			start := time.Now()
-			
-			// 1. Captured Request Body with 1MB RAM Protection
+
+			// 1. Capture the start of the request body without buffering the rest
 			var reqBody []byte
-			if r.Body != nil && r.Method != http.MethodGet {
-				limitedReader := io.LimitReader(r.Body, 1024*1024) // 1MB Cap
-				reqBody, _ = io.ReadAll(limitedReader)
-				r.Body = io.NopCloser(bytes.NewBuffer(reqBody))
+			var reqTruncated bool
+			reqType := r.Header.Get("Content-Type")
+			if limit := l.captureLimit(reqType); limit > 0 && r.Body != nil && r.Body != http.NoBody {
+				read, _ := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(read), r.Body), r.Body}
+				reqBody, reqTruncated = read, len(read) > limit
+				if reqTruncated {
+					reqBody = read[:limit]
+				}
 			}
 
-			rw := &responseWriter{w, http.StatusOK, bytes.NewBuffer(nil), 0}
+			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK, body: bytes.NewBuffer(nil), limitFor: l.captureLimit}
 			next.ServeHTTP(rw, r)
 
 			ctx := r.Context()
 			duration := time.Since(start)
 			ms := duration.Milliseconds()
+			slow := duration >= l.cfg.SlowThreshold
+
+			level := slog.LevelInfo
+			if rw.statusCode >= 500 {
+				level = slog.LevelError
+			} else if rw.statusCode >= 400 || slow {
+				level = slog.LevelWarn
+			}
+			if level == slog.LevelInfo && l.cfg.SuccessSampleRate < 1 && rand.Float64() >= l.cfg.SuccessSampleRate {
+				return
+			}
+			logger := GetLoggerFromContext(ctx)
+			if !logger.Enabled(ctx, level) {
+				return
+			}
 
 			var userID string
 			var extraFields map[string]any
 			var breadcrumbs []string
 			if state, ok := ctx.Value(LogStateKey).(*LogState); ok {
+				state.mu.RLock()
 				userID = state.UserID
-				extraFields = state.Fields
-				breadcrumbs = state.Breadcrumbs
-			}
-
-			level := slog.LevelInfo
-			if rw.statusCode >= 500 {
-				level = slog.LevelError
-			} else if rw.statusCode >= 400 || ms > 500 {
-				level = slog.LevelWarn
+				extraFields = make(map[string]any, len(state.Fields))
+				for k, v := range state.Fields {
+					extraFields[k] = v
+				}
+				breadcrumbs = append([]string(nil), state.Breadcrumbs...)
+				state.mu.RUnlock()
 			}
 
 			requestID, _ := ctx.Value(RequestIDKey).(string)
 			traceID := GetTraceID(ctx)
 
+			httpAttrs := []any{
+				slog.String("method", r.Method),
+				slog.String("url", l.scrubURL(r)),
+				slog.Int("status", rw.statusCode),
+				slog.Int64("duration_ms", ms),
+				slog.Int("size_bytes", rw.size),
+			}
+			if len(l.cfg.RequestHeaders) > 0 {
+				httpAttrs = append(httpAttrs, l.headerGroup("request_headers", r.Header, l.cfg.RequestHeaders))
+			}
+			if len(l.cfg.ResponseHeaders) > 0 {
+				httpAttrs = append(httpAttrs, l.headerGroup("response_headers", rw.Header(), l.cfg.ResponseHeaders))
+			}
+
 			attrs := []any{
-				slog.Group("http",
-					slog.String("method", r.Method),
-					slog.String("url", r.URL.String()),
-					slog.Int("status", rw.statusCode),
-					slog.Int64("duration_ms", ms),
-					slog.Int("size_bytes", rw.size),
-				),
+				slog.Group("http", httpAttrs...),
 				slog.Group("user",
 					slog.String("id", userID),
-					slog.String("ip", getRealIP(r)),
+					slog.String("ip", ClientIP(r)),
 					slog.String("ua", r.UserAgent()),
 					slog.String("referer", r.Referer()),
 				),
@@ -128,19 +276,105 @@ func RequestLogger() func(http.Handler) http.Handler {
 			}
 
 			// 2. Conditional Breadcrumb Injection (Only on failure or slowness)
-			if (rw.statusCode >= 400 || ms > 500) && len(breadcrumbs) > 0 {
+			if (rw.statusCode >= 400 || slow) && len(breadcrumbs) > 0 {
 				attrs = append(attrs, slog.Any("breadcrumbs", breadcrumbs))
 			}
 
-			if len(reqBody) > 0 && len(reqBody) < 4096 {
-				attrs = append(attrs, slog.String("payload", scrubPayload(reqBody)))
+			if len(reqBody) > 0 {
+				attrs = append(attrs, slog.String("payload", l.scrub(reqType, reqBody)))
+				if reqTruncated {
+					attrs = append(attrs, slog.Bool("payload_truncated", true))
+				}
 			}
 
 			if rw.statusCode >= 400 && rw.body.Len() > 0 {
-				attrs = append(attrs, slog.String("error", rw.body.String()))
+				attrs = append(attrs, slog.String("error", l.scrub(rw.Header().Get("Content-Type"), rw.body.Bytes())))
 			}
 
-			slog.Log(ctx, level, "HTTP Request", attrs...)
+			logger.Log(ctx, level, "HTTP Request", attrs...)
 		})
 	}
 }
+
+// readCloser pairs a reader with the Close of the original body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// skip reports whether the path matches one of the skip patterns.
+func (l *requestLogger) skip(p string) bool {
+	return matchPathPatterns(l.cfg.SkipPaths, p)
+}
+
+// matchPathPatterns reports whether p matches one of the path.Match patterns, where a
+// trailing "/**" matches any depth.
+func matchPathPatterns(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if p == prefix || strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// captureLimit returns how many body bytes of the content type are logged.
+func (l *requestLogger) captureLimit(contentType string) int {
+	if contentType == "" {
+		return 0
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return 0
+	}
+	for _, rule := range l.cfg.BodyCaptureLimits {
+		if strings.HasSuffix(rule.ContentType, "/") {
+			if strings.HasPrefix(mediaType, rule.ContentType) {
+				return rule.MaxBytes
+			}
+		} else if mediaType == rule.ContentType {
+			return rule.MaxBytes
+		}
+	}
+	return 0
+}
+
+// scrub masks sensitive keys in a captured body.
+func (l *requestLogger) scrub(contentType string, body []byte) string {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		return l.sensitive.ScrubForm(string(body))
+	}
+	return l.sensitive.ScrubJSON(body)
+}
+
+// scrubURL masks sensitive query parameters.
+func (l *requestLogger) scrubURL(r *http.Request) string {
+	if r.URL.RawQuery == "" {
+		return r.URL.String()
+	}
+	u := *r.URL
+	u.RawQuery = l.sensitive.ScrubForm(u.RawQuery)
+	return u.String()
+}
+
+func (l *requestLogger) headerGroup(name string, h http.Header, names []string) slog.Attr {
+	var attrs []any
+	for _, n := range names {
+		values := h.Values(n)
+		if len(values) == 0 {
+			continue
+		}
+		value := strings.Join(values, ", ")
+		if l.redact[http.CanonicalHeaderKey(n)] {
+			value = logging.Masked
+		}
+		attrs = append(attrs, slog.String(strings.ToLower(n), value))
+	}
+	return slog.Group(name, attrs...)
+}
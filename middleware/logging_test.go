@@ -1,9 +1,18 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestScrubPayload(t *testing.T) {
@@ -61,3 +70,97 @@ func TestScrubPayload(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestLoggerMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, nil))
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(bytes.Buffer)
+		body.ReadFrom(r.Body)
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(20 * time.Millisecond)
+		case "/fail":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Error-Code", "E42")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"bad","token":"leaked"}`))
+			return
+		case "/echo-size":
+			w.Write([]byte(strings.Repeat("x", body.Len())))
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	handler := RequestLoggerMiddleware(RequestLoggerConfig{
+		SkipPaths:         []string{"/health", "/static/**", "/metrics/*"},
+		SuccessSampleRate: 0.0001,
+		SlowThreshold:     10 * time.Millisecond,
+		RequestHeaders:    []string{"Authorization", "X-Client"},
+		ResponseHeaders:   []string{"X-Error-Code"},
+		BodyCaptureLimits: []BodyCaptureLimit{{ContentType: "application/json", MaxBytes: 16}},
+		SensitiveKeys:     []string{"pin", "token"},
+	})(nextHandler)
+
+	serve := func(method, target, contentType, body string) map[string]any {
+		out.Reset()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Client", "ios")
+		req = req.WithContext(context.WithValue(req.Context(), LoggerContextKey, logger.With("request_id", "req-1")))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if out.Len() == 0 {
+			return nil
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+		return entry
+	}
+
+	t.Run("Skip patterns", func(t *testing.T) {
+		assert.Nil(t, serve(http.MethodGet, "/health", "", ""))
+		assert.Nil(t, serve(http.MethodGet, "/static/css/app.css", "", ""))
+		assert.Nil(t, serve(http.MethodGet, "/metrics/x", "", ""))
+	})
+
+	t.Run("Successful requests are sampled", func(t *testing.T) {
+		assert.Nil(t, serve(http.MethodGet, "/ok", "", ""))
+	})
+
+	t.Run("Slow requests are always logged", func(t *testing.T) {
+		entry := serve(http.MethodGet, "/slow", "", "")
+		require.NotNil(t, entry)
+		assert.Equal(t, "WARN", entry["level"])
+	})
+
+	t.Run("Errors with headers and scrubbed bodies", func(t *testing.T) {
+		entry := serve(http.MethodPost, "/fail?pin=1234&page=2", "application/json", `{"pin":"1234","name":"a long name"}`)
+		require.NotNil(t, entry)
+		assert.Equal(t, "req-1", entry["request_id"], "logged through the request logger")
+
+		httpGroup := entry["http"].(map[string]any)
+		assert.NotContains(t, httpGroup["url"], "1234")
+		reqHeaders := httpGroup["request_headers"].(map[string]any)
+		assert.Equal(t, "[MASKED]", reqHeaders["authorization"])
+		assert.Equal(t, "ios", reqHeaders["x-client"])
+		assert.Equal(t, "E42", httpGroup["response_headers"].(map[string]any)["x-error-code"])
+
+		assert.Equal(t, `{"pin": "[MASKED]","n`, entry["payload"], "captured up to the limit")
+		assert.Equal(t, true, entry["payload_truncated"])
+		assert.NotContains(t, entry["error"], "leaked")
+	})
+
+	t.Run("Handler still reads the whole body", func(t *testing.T) {
+		body := `{"data":"` + strings.Repeat("a", 100) + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/echo-size", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, len(body), rr.Body.Len())
+	})
+}
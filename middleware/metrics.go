@@ -1,63 +1,219 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var (
-	// httpRequestsTotal is a Prometheus counter that tracks the total number of HTTP requests.
-	httpRequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests.",
-		},
-		[]string{"method", "path", "status"},
-	)
-	// httpRequestDuration is a Prometheus histogram that tracks the duration of HTTP requests.
-	httpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Duration of HTTP requests.",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "path", "status"},
-	)
-	// httpResponseSize is a Prometheus histogram that tracks the size of HTTP responses.
-	httpResponseSize = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_response_size_bytes",
-			Help:    "Size of HTTP responses.",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "path", "status"},
-	)
-)
+// DefaultUnmatchedRouteLabel labels requests that did not match any ServeMux pattern,
+// such as 404s, CORS preflights and requests rejected by middleware.
+const DefaultUnmatchedRouteLabel = "unmatched"
 
-// MetricsMiddleware collects HTTP request metrics (total requests, duration, response size).
-// It wraps the next http.Handler in the chain.
-func MetricsMiddleware(next http.Handler) http.Handler {
+// routePatternKey is the context key for the route holder filled in by RecordRoutePattern.
+const routePatternKey CtxKey = "routePattern"
+
+// MetricsConfig configures the HTTP metrics.
+type MetricsConfig struct {
+	// Registry receives the collectors. Nil uses the global Prometheus registry.
+	Registry *prometheus.Registry
+	// Namespace and Subsystem prefix the metric names.
+	Namespace string
+	Subsystem string
+	// DurationBuckets defaults to prometheus.DefBuckets.
+	DurationBuckets []float64
+	// SizeBuckets defaults to exponential buckets from 100B to 100MB.
+	SizeBuckets []float64
+	// UnmatchedLabel defaults to DefaultUnmatchedRouteLabel.
+	UnmatchedLabel string
+}
+
+// IsZero reports whether no option is set.
+func (c MetricsConfig) IsZero() bool {
+	return c.Registry == nil && c.Namespace == "" && c.Subsystem == "" &&
+		len(c.DurationBuckets) == 0 && len(c.SizeBuckets) == 0 && c.UnmatchedLabel == ""
+}
+
+// HTTPMetrics holds the Prometheus collectors for HTTP requests. Requests are labelled
+// by method, matched route pattern and status, so path parameters such as UUIDs do not
+// create new time series.
+type HTTPMetrics struct {
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	responseSize    *prometheus.HistogramVec
+	inFlight        prometheus.Gauge
+	unmatched       string
+}
+
+// NewHTTPMetrics creates the collectors and registers them with cfg.Registry.
+func NewHTTPMetrics(cfg MetricsConfig) (*HTTPMetrics, error) {
+	if len(cfg.DurationBuckets) == 0 {
+		cfg.DurationBuckets = prometheus.DefBuckets
+	}
+	if len(cfg.SizeBuckets) == 0 {
+		cfg.SizeBuckets = prometheus.ExponentialBuckets(100, 10, 7)
+	}
+	if cfg.UnmatchedLabel == "" {
+		cfg.UnmatchedLabel = DefaultUnmatchedRouteLabel
+	}
+	var registerer prometheus.Registerer = prometheus.DefaultRegisterer
+	if cfg.Registry != nil {
+		registerer = cfg.Registry
+	}
+
+	labels := []string{"method", "path", "status"}
+	m := &HTTPMetrics{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests.",
+		}, labels),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests.",
+			Buckets:   cfg.DurationBuckets,
+		}, labels),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "http_response_size_bytes",
+			Help:      "Size of HTTP responses.",
+			Buckets:   cfg.SizeBuckets,
+		}, labels),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests currently being served.",
+		}),
+		unmatched: cfg.UnmatchedLabel,
+	}
+
+	for _, c := range []prometheus.Collector{m.requestsTotal, m.requestDuration, m.responseSize, m.inFlight} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Middleware collects HTTP request metrics (total requests, duration, response size, in-flight).
+// The route label comes from RecordRoutePattern, which must wrap the ServeMux inside this middleware.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now() // Record the start time of the request.
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		r, holder := withRouteHolder(r)
 
 		// Wrap the ResponseWriter to capture status code and response size.
-		lw := &loggingResponseWriter{ResponseWriter: w}
+		lw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(lw, r) // Serve the actual request.
 
 		duration := time.Since(start).Seconds() // Calculate request duration.
 		status := strconv.Itoa(lw.statusCode)   // Get the HTTP status code as a string.
+		route := holder.get()
+		if route == "" {
+			route = m.unmatched
+		}
+
+		m.requestsTotal.WithLabelValues(r.Method, route, status).Inc()
+		m.requestDuration.WithLabelValues(r.Method, route, status).Observe(duration)
+		m.responseSize.WithLabelValues(r.Method, route, status).Observe(float64(lw.size))
+	})
+}
+
+var (
+	defaultMetricsOnce sync.Once
+	defaultMetrics     *HTTPMetrics
+)
 
-		// Increment the total request counter.
-		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, status).Inc()
-		// Observe the request duration.
-		httpRequestDuration.WithLabelValues(r.Method, r.URL.Path, status).Observe(duration)
-		// Observe the response size.
-		httpResponseSize.WithLabelValues(r.Method, r.URL.Path, status).Observe(float64(lw.size))
+// DefaultHTTPMetrics returns the metrics registered with the global Prometheus registry.
+func DefaultHTTPMetrics() *HTTPMetrics {
+	defaultMetricsOnce.Do(func() {
+		m, err := NewHTTPMetrics(MetricsConfig{})
+		if err != nil {
+			panic("metrics: failed to register default HTTP metrics: " + err.Error())
+		}
+		defaultMetrics = m
 	})
+	return defaultMetrics
+}
+
+// MetricsMiddleware collects HTTP request metrics with DefaultHTTPMetrics.
+// It wraps the next http.Handler in the chain.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return DefaultHTTPMetrics().Middleware(next)
+}
+
+// routeHolder carries the matched pattern from the ServeMux back out to outer middleware,
+// which only see their own copy of the request.
+type routeHolder struct {
+	mu      sync.Mutex
+	pattern string
+}
+
+func (h *routeHolder) get() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pattern
+}
+
+// withRouteHolder makes the route pattern recorded further in visible to the caller.
+func withRouteHolder(r *http.Request) (*http.Request, *routeHolder) {
+	if holder, ok := r.Context().Value(routePatternKey).(*routeHolder); ok {
+		return r, holder
+	}
+	holder := &routeHolder{}
+	return r.WithContext(context.WithValue(r.Context(), routePatternKey, holder)), holder
+}
+
+// RecordRoutePattern wraps a ServeMux so that middleware further out can read the pattern
+// it matched, e.g. "/teams/{teamID}". The method and host parts of the pattern are dropped.
+func RecordRoutePattern(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		holder, ok := r.Context().Value(routePatternKey).(*routeHolder)
+		if !ok {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		// ServeMux sets r.Pattern on the request it is given before calling the handler.
+		defer func() {
+			holder.mu.Lock()
+			holder.pattern = routeFromPattern(r.Pattern)
+			holder.mu.Unlock()
+		}()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// GetRoutePattern returns the route pattern recorded by RecordRoutePattern, once the
+// request has been dispatched. It is empty if no route matched.
+func GetRoutePattern(ctx context.Context) string {
+	if holder, ok := ctx.Value(routePatternKey).(*routeHolder); ok {
+		return holder.get()
+	}
+	return ""
+}
+
+// routeFromPattern strips the method and host from a ServeMux pattern.
+func routeFromPattern(pattern string) string {
+	if _, rest, found := strings.Cut(pattern, " "); found {
+		pattern = strings.TrimSpace(rest)
+	}
+	if i := strings.Index(pattern, "/"); i > 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
 }
 
 // loggingResponseWriter is a wrapper around http.ResponseWriter to capture the status code and response size.
@@ -79,3 +235,10 @@ func (lw *loggingResponseWriter) Write(data []byte) (int, error) {
 	lw.size += size
 	return size, err
 }
+
+// Flush implements http.Flusher so streaming handlers keep working behind the metrics.
+func (lw *loggingResponseWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,103 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := middleware.NewHTTPMetrics(middleware.MetricsConfig{
+		Registry:        reg,
+		Namespace:       "app",
+		DurationBuckets: []float64{0.1, 1},
+	})
+	require.NoError(t, err)
+
+	var inFlight float64
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		inFlight = gaugeValue(t, reg, "app_http_requests_in_flight")
+		w.Write([]byte("ok"))
+	})
+	handler := metrics.Middleware(middleware.RecordRoutePattern(mux))
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	t.Run("Labels by route pattern", func(t *testing.T) {
+		expected := `
+# HELP app_http_requests_total Total number of HTTP requests.
+# TYPE app_http_requests_total counter
+app_http_requests_total{method="GET",path="/users/{id}",status="200"} 2
+app_http_requests_total{method="GET",path="unmatched",status="404"} 1
+`
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "app_http_requests_total"))
+	})
+
+	t.Run("Tracks in-flight requests", func(t *testing.T) {
+		assert.Equal(t, float64(1), inFlight)
+		assert.Equal(t, float64(0), gaugeValue(t, reg, "app_http_requests_in_flight"))
+	})
+
+	t.Run("Rejects duplicate registration", func(t *testing.T) {
+		_, err := middleware.NewHTTPMetrics(middleware.MetricsConfig{Registry: reg, Namespace: "app"})
+		assert.Error(t, err)
+	})
+}
+
+func TestHTTPMetrics_UnmatchedLabel(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := middleware.NewHTTPMetrics(middleware.MetricsConfig{Registry: reg, UnmatchedLabel: "other"})
+	require.NoError(t, err)
+
+	// Without RecordRoutePattern no pattern is known.
+	handler := metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/anything", nil))
+
+	expected := `
+# HELP http_requests_total Total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="POST",path="other",status="200"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "http_requests_total"))
+}
+
+func TestGetRoutePattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE example.com/teams/{teamID}", func(w http.ResponseWriter, r *http.Request) {})
+
+	var route string
+	reg := prometheus.NewRegistry()
+	metrics, err := middleware.NewHTTPMetrics(middleware.MetricsConfig{Registry: reg})
+	require.NoError(t, err)
+	handler := metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.RecordRoutePattern(mux).ServeHTTP(w, r)
+		route = middleware.GetRoutePattern(r.Context())
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "http://example.com/teams/42", nil))
+	assert.Equal(t, "/teams/{teamID}", route)
+}
+
+func gaugeValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() == name {
+			return f.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
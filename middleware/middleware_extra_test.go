@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -67,4 +68,17 @@ func TestCookieHelpers(t *testing.T) {
 			t.Errorf("expected 2 cookies, got %d", len(cookies))
 		}
 	})
+	t.Run("SetRefreshCookie and ClearRefreshCookie", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		SetRefreshCookie(w, "refresh-token", time.Now().Add(time.Hour), true, "")
+		ClearRefreshCookie(w, true, "")
+		cookies := w.Result().Cookies()
+
+		if len(cookies) != 2 {
+			t.Fatalf("expected 2 cookies, got %d", len(cookies))
+		}
+		assert.Equal(t, RefreshCookieName, cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, "", cookies[1].Value)
+	})
 }
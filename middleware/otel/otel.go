@@ -2,10 +2,13 @@ package otel
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/shashtag-ventures/go-common/middleware"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -26,3 +29,23 @@ func Middleware(serviceName string) func(http.Handler) http.Handler {
 		return otelhttp.NewHandler(next, serviceName)
 	}
 }
+
+// PanicReporter records recovered panics on the request span as an "exception" event and
+// marks the span as failed. Add it to middleware.RecoveryConfig.Reporters; the span must
+// be started outside Recovery, e.g. by wrapping the main mux with Middleware.
+func PanicReporter() middleware.PanicReporter {
+	return middleware.PanicReporterFunc(func(ctx context.Context, report middleware.PanicReport) error {
+		span := trace.SpanFromContext(ctx)
+		if !span.IsRecording() {
+			return nil
+		}
+		span.AddEvent("exception", trace.WithAttributes(
+			attribute.String("exception.type", fmt.Sprintf("%T", report.Value)),
+			attribute.String("exception.message", report.Message()),
+			attribute.String("exception.stacktrace", string(report.Stack)),
+			attribute.Bool("exception.escaped", false),
+		))
+		span.SetStatus(codes.Error, "panic: "+report.Message())
+		return nil
+	})
+}
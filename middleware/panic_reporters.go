@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/notify"
+)
+
+// Discord embed limits.
+const (
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+	discordFieldLimit       = 1024
+)
+
+// DiscordPanicReporter posts recovered panics to a Discord channel as an embed with the
+// panic message, route, request ID, user and stack trace. It sends in the background, so
+// the request is not held up; combine it with ThrottlePanicReporter:
+//
+//	reporter := middleware.ThrottlePanicReporter(&middleware.DiscordPanicReporter{
+//		Webhook: &notify.DiscordWebhook{URL: os.Getenv("DISCORD_PANIC_WEBHOOK")},
+//		Service: "billing-api",
+//	}, middleware.PanicThrottleConfig{})
+type DiscordPanicReporter struct {
+	Webhook *notify.DiscordWebhook
+	Service string // Shown in the embed title, to tell services apart in a shared channel
+}
+
+func (d *DiscordPanicReporter) ReportPanic(ctx context.Context, report PanicReport) error {
+	embed := d.embed(report)
+	logger := GetLoggerFromContext(ctx)
+	go func() {
+		if err := d.Webhook.SendEmbed(embed); err != nil {
+			logger.Error("Failed to send panic report to Discord", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (d *DiscordPanicReporter) embed(report PanicReport) notify.DiscordEmbed {
+	title := "Panic: " + report.Message()
+	if d.Service != "" {
+		title = "[" + d.Service + "] " + title
+	}
+
+	route := report.Route
+	if route == "" {
+		route = report.Path
+	}
+	fields := []notify.DiscordEmbedField{
+		{Name: "Route", Value: report.Method + " " + route, Inline: true},
+		{Name: "Request ID", Value: orNone(report.RequestID), Inline: true},
+		{Name: "User", Value: orNone(report.UserID), Inline: true},
+	}
+	if report.Origin != "" {
+		fields = append(fields, notify.DiscordEmbedField{Name: "Origin", Value: truncate(report.Origin, discordFieldLimit)})
+	}
+	if report.TraceID != "" {
+		fields = append(fields, notify.DiscordEmbedField{Name: "Trace ID", Value: report.TraceID, Inline: true})
+	}
+	if report.Suppressed > 0 {
+		fields = append(fields, notify.DiscordEmbedField{
+			Name:   "Suppressed",
+			Value:  strconv.Itoa(report.Suppressed) + " more since the last report",
+			Inline: true,
+		})
+	}
+
+	const fence = "```"
+	stack := truncate(string(report.Stack), discordDescriptionLimit-2*len(fence)-2)
+
+	timestamp := report.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return notify.DiscordEmbed{
+		Title:       truncate(title, discordTitleLimit),
+		Description: fence + "\n" + stack + "\n" + fence,
+		Color:       0xE74C3C,
+		Fields:      fields,
+		Timestamp:   timestamp.UTC().Format(time.RFC3339),
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// truncate shortens s to at most n bytes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	const ellipsis = "…"
+	cut := n - len(ellipsis)
+	// Do not split a multi-byte character.
+	for cut > 0 && s[cut]&0xC0 == 0x80 {
+		cut--
+	}
+	return s[:cut] + ellipsis
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/shashtag-ventures/go-common/jsonResponse"
 	"github.com/ulule/limiter/v3"
-	"github.com/ulule/limiter/v3/drivers/middleware/stdlib"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
 	limiterredis "github.com/ulule/limiter/v3/drivers/store/redis"
 )
@@ -21,18 +23,90 @@ const (
 	RateLimitStoreRedis  RateLimitStore = "redis"
 )
 
+// redisRetryInterval is how long the Redis store is bypassed after a failure.
+const redisRetryInterval = 10 * time.Second
+
 // RateLimitConfig defines settings for API rate limiting.
 type RateLimitConfig struct {
 	Enabled     bool
-	Limit       int
-	Window      int             // Window in seconds
-	StoreType   RateLimitStore  // "memory" or "redis"
+	Limit       int                 // Default limit for requests matching no policy
+	Window      int                 // Window in seconds
+	StoreType   RateLimitStore      // "memory" or "redis"
 	RedisClient limiterredis.Client // Required for "redis" store
-	KeyPrefix   string          // Optional prefix for rate limit keys
+	KeyPrefix   string              // Optional prefix for rate limit keys
+	// Policies are checked in order; the first one matching the request applies.
+	// Requests matching none use Limit and Window.
+	Policies []RateLimitPolicy
+	// AuthenticatedOnly lets requests without a user or API key through uncounted, for
+	// a per-user limiter behind authentication that complements a per-IP one in front.
+	AuthenticatedOnly bool
+}
+
+// RateLimitRate is a number of requests allowed per window.
+type RateLimitRate struct {
+	Limit  int
+	Window time.Duration
+}
+
+func (r RateLimitRate) isSet() bool {
+	return r.Limit > 0 && r.Window > 0
+}
+
+// RateLimitPolicy sets the limits for a route group and/or set of methods.
+// Authenticated requests are counted per user (or per API key), anonymous ones per client IP.
+type RateLimitPolicy struct {
+	Name       string   // Identifies the counters; defaults to the policy's position
+	PathPrefix string   // Route group, e.g. "/admin"; empty matches every path
+	Methods    []string // Empty matches every method
+	Anonymous  RateLimitRate
+	User       RateLimitRate // Defaults to Anonymous
+	APIKey     RateLimitRate // Quota per API key; defaults to User
+	Disabled   bool          // Exempts matching requests from rate limiting
+}
+
+func (p RateLimitPolicy) matches(r *http.Request) bool {
+	return matchesRoute(r, p.PathPrefix, p.Methods)
+}
+
+// matchesRoute reports whether r is under the path prefix (a route group such as
+// "/admin") and uses one of the methods. Empty values match everything.
+func matchesRoute(r *http.Request, pathPrefix string, methods []string) bool {
+	if pathPrefix != "" {
+		prefix := strings.TrimSuffix(pathPrefix, "/")
+		if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			return false
+		}
+	}
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, r.Method) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateFor picks the rate for the identity kind, falling back from API key to user to anonymous.
+func (p RateLimitPolicy) rateFor(kind string) RateLimitRate {
+	switch {
+	case kind == "key" && p.APIKey.isSet():
+		return p.APIKey
+	case (kind == "key" || kind == "user") && p.User.isSet():
+		return p.User
+	default:
+		return p.Anonymous
+	}
 }
 
-// RateLimitMiddleware provides a basic IP-based rate limiting using ulule/limiter.
-// It supports both in-memory (for simple cases) and Redis (for distributed systems).
+// RateLimitMiddleware limits requests per user, API key or client IP using ulule/limiter.
+// The user is read from the context, so authentication installed before it (for example
+// optional JWT auth via Router.Use) switches the counter from IP to user. The IP is taken
+// from ClientIP, so install ClientIPMiddleware in front of it when behind a proxy.
+//
+// It supports both in-memory (for simple cases) and Redis (for distributed systems) storage.
+// If Redis is unreachable, counters fall back to per-instance memory until it recovers.
 func RateLimitMiddleware(cfg RateLimitConfig) func(next http.Handler) http.Handler {
 	if !cfg.Enabled {
 		return func(next http.Handler) http.Handler {
@@ -40,51 +114,178 @@ func RateLimitMiddleware(cfg RateLimitConfig) func(next http.Handler) http.Handl
 		}
 	}
 
-	// Define the rate
-	rate := limiter.Rate{
-		Period: time.Duration(cfg.Window) * time.Second,
-		Limit:  int64(cfg.Limit),
+	store := newRateLimitStore(cfg)
+
+	policies := make([]RateLimitPolicy, 0, len(cfg.Policies)+1)
+	for i, p := range cfg.Policies {
+		if p.Name == "" {
+			p.Name = "policy" + strconv.Itoa(i)
+		}
+		policies = append(policies, p)
 	}
+	// The global limit applies to requests no policy matched.
+	global := RateLimitRate{Limit: cfg.Limit, Window: time.Duration(cfg.Window) * time.Second}
+	policies = append(policies, RateLimitPolicy{Name: "global", Anonymous: global})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var policy RateLimitPolicy
+			for _, p := range policies {
+				if p.matches(r) {
+					policy = p
+					break
+				}
+			}
 
-	// Initialize the store
-	var store limiter.Store
-	var err error
+			kind, id := rateLimitIdentity(r)
+			rate := policy.rateFor(kind)
+			if policy.Disabled || !rate.isSet() || (cfg.AuthenticatedOnly && kind == "ip") {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-	switch cfg.StoreType {
-	case RateLimitStoreRedis:
-		if cfg.RedisClient == nil {
-			panic("RateLimitConfig: RedisClient is required when StoreType is 'redis'")
-		}
-		store, err = limiterredis.NewStoreWithOptions(cfg.RedisClient, limiter.StoreOptions{
-			Prefix: cfg.KeyPrefix,
+			key := policy.Name + ":" + kind + ":" + id
+			limitContext, err := store.Get(r.Context(), key, limiter.Rate{Period: rate.Window, Limit: int64(rate.Limit)})
+			if err != nil {
+				// Fail open: an unavailable store must not take the API down.
+				GetLoggerFromContext(r.Context()).Warn("Rate limit check failed", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !writeRateLimitHeaders(w, limitContext) {
+				jsonResponse.SendErrorResponse(w, fmt.Errorf("rate limit reached"), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
 		})
-	default:
-		// Default to memory
-		store = memory.NewStore()
 	}
+}
 
-	if err != nil {
-		// If store initialization fails, we panic in production to avoid unprotected endpoints,
-		// or we could fall back to memory. For now, panic for visibility.
-		panic(fmt.Sprintf("RateLimitConfig: failed to initialize store: %v", err))
+// rateLimitIdentity returns the counter identity for the request: the API key,
+// the authenticated user, or the client IP, in that order.
+func rateLimitIdentity(r *http.Request) (kind, id string) {
+	if user, ok := GetUserFromContext(r.Context()); ok && user != nil {
+		if user.APIKeyID != "" {
+			return "key", user.APIKeyID
+		}
+		if user.ID != "" {
+			return "user", user.ID
+		}
 	}
+	return "ip", ClientIP(r)
+}
 
-	// Create the limiter instance
-	instance := limiter.New(store, rate)
+// writeRateLimitHeaders sets the X-RateLimit-* headers, plus Retry-After when the limit
+// is reached. It reports whether the request may proceed.
+func writeRateLimitHeaders(w http.ResponseWriter, limitContext limiter.Context) bool {
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(limitContext.Limit, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(limitContext.Remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(limitContext.Reset, 10))
 
-	// Create the stdlib middleware
-	// By default, it uses the IP address as the key.
-	mw := stdlib.NewMiddleware(instance)
+	if !limitContext.Reached {
+		return true
+	}
+	retryAfter := limitContext.Reset - time.Now().Unix()
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	return false
+}
 
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// We wrap the stdlib middleware handler
-			mw.Handler(next).ServeHTTP(w, r)
-		})
+// newRateLimitStore builds the counter store. Redis problems are logged rather than
+// fatal; the store degrades to memory until Redis can be reached.
+func newRateLimitStore(cfg RateLimitConfig) limiter.Store {
+	opts := limiter.StoreOptions{Prefix: cfg.KeyPrefix, CleanUpInterval: limiter.DefaultCleanUpInterval}
+	if opts.Prefix == "" {
+		opts.Prefix = limiter.DefaultPrefix
+	}
+	fallback := memory.NewStoreWithOptions(opts)
+
+	if cfg.StoreType != RateLimitStoreRedis {
+		return fallback
 	}
+	if cfg.RedisClient == nil {
+		GetLoggerFromContext(context.Background()).Error("RateLimitConfig: RedisClient is required when StoreType is 'redis'; using memory store")
+		return fallback
+	}
+	return &degradingStore{client: cfg.RedisClient, opts: opts, fallback: fallback, now: time.Now}
+}
+
+// degradingStore uses Redis while it is reachable and a local memory store otherwise,
+// so an outage weakens limits to per-instance instead of failing requests. After a
+// failure Redis is bypassed for redisRetryInterval to avoid adding latency to every request.
+type degradingStore struct {
+	client   limiterredis.Client
+	opts     limiter.StoreOptions
+	fallback limiter.Store
+	now      func() time.Time
+
+	mu      sync.Mutex
+	primary limiter.Store
+	retryAt time.Time
 }
 
-// RateLimitMiddlewareWithContext is kept for backward compatibility but context is ignored 
+// current returns the Redis store if it is usable, connecting lazily.
+func (s *degradingStore) current(ctx context.Context) limiter.Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.now().Before(s.retryAt) {
+		return nil
+	}
+	if s.primary == nil {
+		store, err := limiterredis.NewStoreWithOptions(s.client, s.opts)
+		if err != nil {
+			GetLoggerFromContext(ctx).Warn("Rate limit Redis store unavailable; using memory store", "error", err)
+			s.retryAt = s.now().Add(redisRetryInterval)
+			return nil
+		}
+		s.primary = store
+	}
+	return s.primary
+}
+
+func (s *degradingStore) markDown(ctx context.Context, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.now().Before(s.retryAt) {
+		return
+	}
+	GetLoggerFromContext(ctx).Warn("Rate limit Redis store failed; using memory store", "error", err)
+	s.retryAt = s.now().Add(redisRetryInterval)
+}
+
+func (s *degradingStore) do(ctx context.Context, fn func(limiter.Store) (limiter.Context, error)) (limiter.Context, error) {
+	if primary := s.current(ctx); primary != nil {
+		lc, err := fn(primary)
+		if err == nil {
+			return lc, nil
+		}
+		s.markDown(ctx, err)
+	}
+	return fn(s.fallback)
+}
+
+func (s *degradingStore) Get(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return s.do(ctx, func(st limiter.Store) (limiter.Context, error) { return st.Get(ctx, key, rate) })
+}
+
+func (s *degradingStore) Peek(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return s.do(ctx, func(st limiter.Store) (limiter.Context, error) { return st.Peek(ctx, key, rate) })
+}
+
+func (s *degradingStore) Reset(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return s.do(ctx, func(st limiter.Store) (limiter.Context, error) { return st.Reset(ctx, key, rate) })
+}
+
+func (s *degradingStore) Increment(ctx context.Context, key string, count int64, rate limiter.Rate) (limiter.Context, error) {
+	return s.do(ctx, func(st limiter.Store) (limiter.Context, error) { return st.Increment(ctx, key, count, rate) })
+}
+
+// RateLimitMiddlewareWithContext is kept for backward compatibility but context is ignored
 // as ulule/limiter handles cleanup internally (memory store) or via TTL (redis).
 func RateLimitMiddlewareWithContext(ctx context.Context, cfg RateLimitConfig) func(next http.Handler) http.Handler {
 	return RateLimitMiddleware(cfg)
@@ -101,16 +302,12 @@ func CustomRateLimitMiddleware(instance *limiter.Limiter, keyExtractor func(r *h
 			if err != nil {
 				// On error, we allow the request but log the failure
 				// In a stricter system, you might want to block
+				GetLoggerFromContext(ctx).Warn("Rate limit check failed", "error", err)
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Set standard rate limit headers
-			w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", limitContext.Limit))
-			w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", limitContext.Remaining))
-			w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", limitContext.Reset))
-
-			if limitContext.Reached {
+			if !writeRateLimitHeaders(w, limitContext) {
 				jsonResponse.SendErrorResponse(w, fmt.Errorf("rate limit reached"), http.StatusTooManyRequests)
 				return
 			}
@@ -0,0 +1,152 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitPolicies(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := middleware.RateLimitConfig{
+		Enabled: true,
+		Limit:   100,
+		Window:  60,
+		Policies: []middleware.RateLimitPolicy{
+			{PathPrefix: "/health", Disabled: true},
+			{
+				Name:       "uploads",
+				PathPrefix: "/uploads",
+				Methods:    []string{http.MethodPost},
+				Anonymous:  middleware.RateLimitRate{Limit: 1, Window: time.Minute},
+				User:       middleware.RateLimitRate{Limit: 2, Window: time.Minute},
+				APIKey:     middleware.RateLimitRate{Limit: 3, Window: time.Minute},
+			},
+		},
+	}
+	handler := middleware.RateLimitMiddleware(cfg)(nextHandler)
+
+	serve := func(method, path, ip string, user *middleware.AuthenticatedUser) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, user))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// allowed sends n+1 requests and checks that exactly the first n succeed.
+	allowed := func(t *testing.T, n int, send func() *httptest.ResponseRecorder) {
+		for i := 0; i < n; i++ {
+			require.Equal(t, http.StatusOK, send().Code, "request %d", i+1)
+		}
+		rr := send()
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+		assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+	}
+
+	t.Run("Anonymous requests are limited per IP", func(t *testing.T) {
+		allowed(t, 1, func() *httptest.ResponseRecorder {
+			return serve(http.MethodPost, "/uploads/file", "10.0.0.1", nil)
+		})
+		assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/uploads", "10.0.0.2", nil).Code)
+	})
+
+	t.Run("Users are limited per user regardless of IP", func(t *testing.T) {
+		user := &middleware.AuthenticatedUser{ID: "user-1"}
+		ips := []string{"10.1.0.1", "10.1.0.2", "10.1.0.3"}
+		i := 0
+		allowed(t, 2, func() *httptest.ResponseRecorder {
+			i++
+			return serve(http.MethodPost, "/uploads", ips[i-1], user)
+		})
+	})
+
+	t.Run("API keys have their own quota", func(t *testing.T) {
+		key := &middleware.AuthenticatedUser{ID: "user-2", APIKeyID: "key-1"}
+		allowed(t, 3, func() *httptest.ResponseRecorder {
+			return serve(http.MethodPost, "/uploads", "10.2.0.1", key)
+		})
+		// The same user without the key still has the user quota.
+		assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/uploads", "10.2.0.1", &middleware.AuthenticatedUser{ID: "user-2"}).Code)
+	})
+
+	t.Run("Unmatched requests use the global limit", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/uploads", "10.3.0.1", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "100", rr.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "99", rr.Header().Get("X-RateLimit-Remaining"))
+		assert.NotEmpty(t, rr.Header().Get("X-RateLimit-Reset"))
+	})
+
+	t.Run("Disabled policies are exempt", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/health", "10.4.0.1", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("X-RateLimit-Limit"))
+	})
+}
+
+func TestRateLimitRedisDegradation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(handler http.Handler) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.9.0.1:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	t.Run("Missing client does not panic", func(t *testing.T) {
+		var handler http.Handler
+		assert.NotPanics(t, func() {
+			handler = middleware.RateLimitMiddleware(middleware.RateLimitConfig{
+				Enabled: true, Limit: 1, Window: 60, StoreType: middleware.RateLimitStoreRedis,
+			})(nextHandler)
+		})
+		assert.Equal(t, http.StatusOK, serve(handler))
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler))
+	})
+
+	t.Run("Unreachable Redis falls back to memory", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+		defer client.Close()
+		mr.Close()
+
+		handler := middleware.RateLimitMiddleware(middleware.RateLimitConfig{
+			Enabled: true, Limit: 1, Window: 60, StoreType: middleware.RateLimitStoreRedis, RedisClient: client,
+		})(nextHandler)
+		assert.Equal(t, http.StatusOK, serve(handler))
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler))
+	})
+
+	t.Run("Redis is used when reachable", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer client.Close()
+
+		handler := middleware.RateLimitMiddleware(middleware.RateLimitConfig{
+			Enabled: true, Limit: 1, Window: 60, StoreType: middleware.RateLimitStoreRedis, RedisClient: client, KeyPrefix: "rl",
+		})(nextHandler)
+		assert.Equal(t, http.StatusOK, serve(handler))
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler))
+		assert.NotEmpty(t, mr.Keys())
+	})
+}
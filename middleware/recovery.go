@@ -1,31 +1,337 @@
 package middleware
 
 import (
-	"log/slog"
+	"context"
+	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jsonResponse"
 )
 
-// Recovery is a middleware that recovers from panics, logs the panic (and a stack trace), 
-// and returns a HTTP 500 (Internal Server Error) status.
+// PanicReport describes a recovered panic for PanicReporters.
+type PanicReport struct {
+	Value     any    // The value passed to panic
+	Stack     []byte // Stack trace of the panicking goroutine
+	Origin    string // file:line where the panic was raised, if it could be determined
+	Method    string
+	Path      string
+	Route     string // Matched route pattern, e.g. "/users/{id}"
+	RequestID string
+	TraceID   string
+	UserID    string
+	Time      time.Time
+	// Suppressed is the number of identical panics dropped by ThrottlePanicReporter since
+	// this panic was last reported.
+	Suppressed int
+}
+
+// Message returns the panic value as a string.
+func (p PanicReport) Message() string {
+	return fmt.Sprint(p.Value)
+}
+
+// Fingerprint identifies panics that share a cause: the same route and origin. Panic
+// messages often contain request data, so they are only used when the origin is unknown.
+func (p PanicReport) Fingerprint() string {
+	route := p.Route
+	if route == "" {
+		route = p.Path
+	}
+	if p.Origin != "" {
+		return route + "|" + p.Origin
+	}
+	return route + "|" + p.Message()
+}
+
+// PanicError carries a panic recovered on another goroutine together with that
+// goroutine's stack, so that it can be re-raised on the request goroutine without
+// losing its origin. Recovery unwraps it and reports Value and Stack.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprint(e.Value)
+}
+
+// Unwrap returns Value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// WrapPanic wraps a value just recovered in a deferred function in a PanicError with
+// the current stack. http.ErrAbortHandler and values that are already wrapped are
+// returned as they are.
+func WrapPanic(p any) any {
+	switch p.(type) {
+	case *PanicError:
+		return p
+	}
+	if p == http.ErrAbortHandler {
+		return p
+	}
+	return &PanicError{Value: p, Stack: debug.Stack()}
+}
+
+// PanicReporter is notified of every panic Recovery handles. Reporters run on the
+// request goroutine after the 500 response has been written, so slow ones (e.g. network
+// calls) should do their work in the background.
+type PanicReporter interface {
+	ReportPanic(ctx context.Context, report PanicReport) error
+}
+
+// PanicReporterFunc adapts a function to PanicReporter.
+type PanicReporterFunc func(ctx context.Context, report PanicReport) error
+
+func (f PanicReporterFunc) ReportPanic(ctx context.Context, report PanicReport) error {
+	return f(ctx, report)
+}
+
+// RecoveryConfig configures RecoveryMiddleware.
+type RecoveryConfig struct {
+	// Reporters are called for every recovered panic. Wrap noisy ones, such as chat
+	// notifications, in ThrottlePanicReporter.
+	Reporters []PanicReporter
+}
+
+// Recovery recovers from panics with no reporters. See RecoveryMiddleware.
 func Recovery() func(http.Handler) http.Handler {
+	return RecoveryMiddleware(RecoveryConfig{})
+}
+
+// RecoveryMiddleware recovers from panics, logs the panic and its stack trace with the
+// request logger, and responds with a 500 JSON error carrying the request ID. If the
+// handler had already started the response, it is left as is. The configured reporters
+// are then notified. http.ErrAbortHandler is re-raised so the server aborts the response.
+func RecoveryMiddleware(cfg RecoveryConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, _ = withRouteHolder(r)
+			rw := &recoveryWriter{ResponseWriter: w}
 			defer func() {
-				if err := recover(); err != nil {
-					// Extract request ID for context
-					requestID, _ := r.Context().Value(RequestIDKey).(string)
-					
-					slog.Error("PANIC RECOVERED",
-						"error", err,
-						"request_id", requestID,
-						"stack", string(debug.Stack()),
-					)
-					
-					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				ctx := r.Context()
+				stack := debug.Stack()
+				if pe, ok := p.(*PanicError); ok {
+					p, stack = pe.Value, pe.Stack
+				}
+				report := PanicReport{
+					Value:     p,
+					Stack:     stack,
+					Origin:    panicOrigin(stack),
+					Method:    r.Method,
+					Path:      r.URL.Path,
+					Route:     GetRoutePattern(ctx),
+					RequestID: GetRequestIDFromContext(ctx),
+					TraceID:   GetTraceID(ctx),
+					Time:      time.Now(),
+				}
+				if state, ok := ctx.Value(LogStateKey).(*LogState); ok {
+					state.mu.RLock()
+					report.UserID = state.UserID
+					state.mu.RUnlock()
+				}
+
+				logger := GetLoggerFromContext(ctx)
+				logger.Error("PANIC RECOVERED",
+					"error", p,
+					"origin", report.Origin,
+					"route", report.Route,
+					"stack", string(stack),
+				)
+
+				if !rw.wroteHeader {
+					jsonResponse.JsonResponse(w, http.StatusInternalServerError, jsonResponse.ErrorResponse{
+						Status:    http.StatusInternalServerError,
+						Error:     http.StatusText(http.StatusInternalServerError),
+						Message:   "An unexpected internal server error occurred.",
+						RequestID: report.RequestID,
+					})
+				}
+
+				for _, reporter := range cfg.Reporters {
+					if err := reporter.ReportPanic(ctx, report); err != nil {
+						logger.Error("Failed to report panic", "error", err)
+					}
 				}
 			}()
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(rw, r)
 		})
 	}
 }
+
+// recoveryWriter records whether the response has started.
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoveryWriter) WriteHeader(code int) {
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoveryWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher so streaming responses keep working.
+func (rw *recoveryWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *recoveryWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// panicOrigin returns the file:line of the first non-runtime frame after the innermost
+// panic call in a debug.Stack trace.
+func panicOrigin(stack []byte) string {
+	lines := strings.Split(string(stack), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") {
+			start = i
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+	// Frames are pairs of lines: the function, then a tab and file:line +offset.
+	for i := start + 2; i+1 < len(lines); i += 2 {
+		if strings.HasPrefix(lines[i], "runtime.") {
+			continue
+		}
+		location := strings.TrimSpace(lines[i+1])
+		if j := strings.LastIndex(location, " +0x"); j >= 0 {
+			location = location[:j]
+		}
+		return location
+	}
+	return ""
+}
+
+// PanicThrottleConfig configures ThrottlePanicReporter.
+type PanicThrottleConfig struct {
+	// DedupWindow is how long a panic with the same fingerprint is suppressed after it
+	// has been reported. Defaults to 10 minutes.
+	DedupWindow time.Duration
+	// MaxReports caps the reports passed on per Interval, across all fingerprints.
+	// Defaults to 10 per minute.
+	MaxReports int
+	Interval   time.Duration
+}
+
+// ThrottlePanicReporter wraps next with deduplication and rate limiting, so a panic hit
+// on every request produces one notification instead of one per request. The next report
+// of a fingerprint carries the number of panics suppressed in between.
+func ThrottlePanicReporter(next PanicReporter, cfg PanicThrottleConfig) PanicReporter {
+	if cfg.DedupWindow <= 0 {
+		cfg.DedupWindow = 10 * time.Minute
+	}
+	if cfg.MaxReports <= 0 {
+		cfg.MaxReports = 10
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	return &panicThrottle{next: next, cfg: cfg, seen: make(map[string]*panicSeen)}
+}
+
+// maxPanicFingerprints bounds the dedup state when many distinct panics occur.
+const maxPanicFingerprints = 1000
+
+type panicSeen struct {
+	reported   time.Time
+	suppressed int
+}
+
+type panicThrottle struct {
+	next PanicReporter
+	cfg  PanicThrottleConfig
+
+	mu          sync.Mutex
+	seen        map[string]*panicSeen
+	windowStart time.Time
+	sent        int
+}
+
+func (t *panicThrottle) ReportPanic(ctx context.Context, report PanicReport) error {
+	if !t.allow(&report) {
+		return nil
+	}
+	return t.next.ReportPanic(ctx, report)
+}
+
+// allow decides whether report is passed on, and sets its Suppressed count if so.
+func (t *panicThrottle) allow(report *PanicReport) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := report.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key := report.Fingerprint()
+	seen, ok := t.seen[key]
+	if ok && now.Sub(seen.reported) < t.cfg.DedupWindow {
+		seen.suppressed++
+		return false
+	}
+
+	if now.Sub(t.windowStart) >= t.cfg.Interval {
+		t.windowStart = now
+		t.sent = 0
+	}
+	if t.sent >= t.cfg.MaxReports {
+		if ok {
+			seen.suppressed++
+		}
+		return false
+	}
+	t.sent++
+
+	if !ok {
+		if len(t.seen) >= maxPanicFingerprints {
+			t.evict(now)
+		}
+		seen = &panicSeen{}
+		t.seen[key] = seen
+	}
+	report.Suppressed = seen.suppressed
+	seen.reported = now
+	seen.suppressed = 0
+	return true
+}
+
+// evict drops fingerprints outside the dedup window, or all of them if none are.
+func (t *panicThrottle) evict(now time.Time) {
+	for key, seen := range t.seen {
+		if now.Sub(seen.reported) >= t.cfg.DedupWindow {
+			delete(t.seen, key)
+		}
+	}
+	if len(t.seen) >= maxPanicFingerprints {
+		clear(t.seen)
+	}
+}
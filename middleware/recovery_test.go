@@ -0,0 +1,187 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/shashtag-ventures/go-common/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// panicReports collects reports for assertions.
+type panicReports struct {
+	mu      sync.Mutex
+	reports []middleware.PanicReport
+}
+
+func (p *panicReports) ReportPanic(ctx context.Context, report middleware.PanicReport) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reports = append(p.reports, report)
+	return nil
+}
+
+func (p *panicReports) all() []middleware.PanicReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]middleware.PanicReport(nil), p.reports...)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	reports := &panicReports{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if state, ok := r.Context().Value(middleware.LogStateKey).(*middleware.LogState); ok {
+			state.SetUser("user-1")
+		}
+		var m map[string]int
+		m["boom"]++ // nil map write
+	})
+	mux.HandleFunc("GET /streaming", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("mid-stream")
+	})
+	mux.HandleFunc("GET /abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	handler := middleware.RequestIDMiddleware(
+		middleware.RecoveryMiddleware(middleware.RecoveryConfig{Reporters: []middleware.PanicReporter{reports}})(
+			middleware.MetricsMiddleware(middleware.RecordRoutePattern(mux)),
+		),
+	)
+
+	t.Run("JSON error with request ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		req.Header.Set("X-Request-ID", "req-123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		var body jsonResponse.ErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, "req-123", body.RequestID)
+		assert.NotContains(t, rr.Body.String(), "nil map", "panic details are not leaked")
+
+		all := reports.all()
+		require.Len(t, all, 1)
+		report := all[0]
+		assert.Equal(t, "/users/{id}", report.Route)
+		assert.Equal(t, "/users/42", report.Path)
+		assert.Equal(t, "req-123", report.RequestID)
+		assert.Equal(t, "user-1", report.UserID)
+		assert.Contains(t, report.Message(), "nil map")
+		assert.Contains(t, report.Origin, "recovery_test.go:")
+		assert.NotEmpty(t, report.Stack)
+	})
+
+	t.Run("Started responses are left alone", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/streaming", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "partial", rr.Body.String())
+		assert.Len(t, reports.all(), 2)
+	})
+
+	t.Run("ErrAbortHandler is re-raised", func(t *testing.T) {
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+		})
+		assert.Len(t, reports.all(), 2)
+	})
+}
+
+func TestThrottlePanicReporter(t *testing.T) {
+	reports := &panicReports{}
+	throttled := middleware.ThrottlePanicReporter(reports, middleware.PanicThrottleConfig{
+		DedupWindow: time.Minute,
+		MaxReports:  2,
+		Interval:    time.Hour,
+	})
+
+	start := time.Now()
+	report := func(route string, at time.Duration) {
+		throttled.ReportPanic(context.Background(), middleware.PanicReport{
+			Value:  "boom",
+			Route:  route,
+			Origin: "handler.go:10",
+			Time:   start.Add(at),
+		})
+	}
+
+	// The same panic is deduplicated within the window.
+	report("/a", 0)
+	report("/a", time.Second)
+	report("/a", 2*time.Second)
+	require.Len(t, reports.all(), 1)
+
+	// Once the window passes it is reported again with the suppressed count.
+	report("/a", 2*time.Minute)
+	all := reports.all()
+	require.Len(t, all, 2)
+	assert.Equal(t, 2, all[1].Suppressed)
+
+	// The rate limit caps reports across fingerprints.
+	report("/b", 3*time.Minute)
+	assert.Len(t, reports.all(), 2)
+}
+
+func TestDiscordPanicReporter(t *testing.T) {
+	received := make(chan map[string][]notify.DiscordEmbed, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string][]notify.DiscordEmbed
+		json.Unmarshal(body, &payload)
+		received <- payload
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	reporter := &middleware.DiscordPanicReporter{
+		Webhook: &notify.DiscordWebhook{URL: server.URL},
+		Service: "billing",
+	}
+	err := reporter.ReportPanic(context.Background(), middleware.PanicReport{
+		Value:      "boom",
+		Stack:      []byte(strings.Repeat("frame\n", 2000)),
+		Method:     http.MethodPost,
+		Route:      "/invoices",
+		RequestID:  "req-1",
+		UserID:     "user-1",
+		Suppressed: 3,
+		Time:       time.Now(),
+	})
+	require.NoError(t, err)
+
+	select {
+	case payload := <-received:
+		require.Len(t, payload["embeds"], 1)
+		embed := payload["embeds"][0]
+		assert.Equal(t, "[billing] Panic: boom", embed.Title)
+		assert.LessOrEqual(t, len(embed.Description), 4096)
+		assert.True(t, strings.HasPrefix(embed.Description, "```\nframe"))
+
+		fields := map[string]string{}
+		for _, f := range embed.Fields {
+			fields[f.Name] = f.Value
+		}
+		assert.Equal(t, "POST /invoices", fields["Route"])
+		assert.Equal(t, "req-1", fields["Request ID"])
+		assert.Equal(t, "user-1", fields["User"])
+		assert.Contains(t, fields["Suppressed"], "3")
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
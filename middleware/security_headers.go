@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSPNonceKey is the context key under which SecurityHeadersMiddleware stores the CSP nonce.
+const CSPNonceKey CtxKey = "cspNonce"
+
+// CSPNoncePlaceholder is replaced by 'nonce-<value>' in ContentSecurityPolicy, e.g.
+// "script-src 'self' {nonce}".
+const CSPNoncePlaceholder = "{nonce}"
+
+// cspReportGroup is the Reporting-Endpoints group name used for report-to.
+const cspReportGroup = "csp-endpoint"
+
+// maxCSPReportBytes bounds the size of accepted violation reports.
+const maxCSPReportBytes = 64 << 10
+
+// SecurityHeadersConfig configures SecurityHeadersMiddleware. Empty fields are not sent;
+// DefaultSecurityHeadersConfig returns a recommended baseline for APIs.
+type SecurityHeadersConfig struct {
+	Enabled bool
+
+	// HSTSMaxAge enables Strict-Transport-Security when positive.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	NoSniff           bool   // X-Content-Type-Options: nosniff
+	FrameOptions      string // X-Frame-Options, e.g. "DENY" or "SAMEORIGIN"
+	ReferrerPolicy    string
+	PermissionsPolicy string // e.g. "camera=(), microphone=(), geolocation=()"
+
+	// ContentSecurityPolicy may contain CSPNoncePlaceholder to get a fresh nonce per request.
+	ContentSecurityPolicy string
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only, so violations
+	// are reported but not blocked.
+	CSPReportOnly bool
+	// CSPReportPath is where browsers send violation reports; it is added to the policy as
+	// report-uri and report-to. Serve CSPReportHandler there (router.New does this).
+	CSPReportPath string
+}
+
+// DefaultSecurityHeadersConfig returns headers suitable for a JSON API served over HTTPS.
+func DefaultSecurityHeadersConfig() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		Enabled:               true,
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		NoSniff:               true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+		PermissionsPolicy:     "camera=(), microphone=(), geolocation=()",
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+	}
+}
+
+// SecurityHeadersMiddleware sets the configured security headers on every response.
+// When the CSP contains CSPNoncePlaceholder, a random nonce is generated per request and
+// exposed to handlers through GetCSPNonce, for use in inline <script nonce="..."> tags.
+func SecurityHeadersMiddleware(cfg SecurityHeadersConfig) func(http.Handler) http.Handler {
+	if !cfg.Enabled {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	static := make(http.Header)
+	if cfg.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge/time.Second), 10)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+		static.Set("Strict-Transport-Security", hsts)
+	}
+	if cfg.NoSniff {
+		static.Set("X-Content-Type-Options", "nosniff")
+	}
+	if cfg.FrameOptions != "" {
+		static.Set("X-Frame-Options", cfg.FrameOptions)
+	}
+	if cfg.ReferrerPolicy != "" {
+		static.Set("Referrer-Policy", cfg.ReferrerPolicy)
+	}
+	if cfg.PermissionsPolicy != "" {
+		static.Set("Permissions-Policy", cfg.PermissionsPolicy)
+	}
+
+	csp := strings.TrimSpace(cfg.ContentSecurityPolicy)
+	if csp != "" && cfg.CSPReportPath != "" {
+		csp = strings.TrimSuffix(csp, ";") + "; report-uri " + cfg.CSPReportPath + "; report-to " + cspReportGroup
+		static.Set("Reporting-Endpoints", cspReportGroup+`="`+cfg.CSPReportPath+`"`)
+	}
+	cspHeader := "Content-Security-Policy"
+	if cfg.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	useNonce := strings.Contains(csp, CSPNoncePlaceholder)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for k, v := range static {
+				h[k] = v
+			}
+
+			if csp != "" {
+				policy := csp
+				if useNonce {
+					nonce, err := newCSPNonce()
+					if err != nil {
+						// Without a nonce inline scripts are blocked, which fails safe.
+						GetLoggerFromContext(r.Context()).Error("Failed to generate CSP nonce", "error", err)
+						policy = strings.ReplaceAll(policy, CSPNoncePlaceholder, "")
+					} else {
+						policy = strings.ReplaceAll(policy, CSPNoncePlaceholder, "'nonce-"+nonce+"'")
+						r = r.WithContext(context.WithValue(r.Context(), CSPNonceKey, nonce))
+					}
+				}
+				h.Set(cspHeader, policy)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetCSPNonce returns the CSP nonce of the request, or "" if none was generated.
+func GetCSPNonce(ctx context.Context) string {
+	if nonce, ok := ctx.Value(CSPNonceKey).(string); ok {
+		return nonce
+	}
+	return ""
+}
+
+func newCSPNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// CSPReportHandler receives CSP violation reports in both the legacy report-uri format
+// (application/csp-report) and the Reporting API format (application/reports+json) and
+// logs them as warnings. It always answers 204 so browsers do not retry.
+func CSPReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		logger := GetLoggerFromContext(r.Context())
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxCSPReportBytes))
+		if err != nil || len(body) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		for _, report := range parseCSPReports(body) {
+			logger.Warn("CSP violation",
+				"document_uri", report["document-uri"],
+				"blocked_uri", report["blocked-uri"],
+				"violated_directive", report["violated-directive"],
+				"effective_directive", report["effective-directive"],
+				"source_file", report["source-file"],
+				"line_number", report["line-number"],
+				"disposition", report["disposition"],
+				"user_agent", r.UserAgent(),
+			)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// parseCSPReports normalizes both report formats to the legacy kebab-case keys.
+func parseCSPReports(body []byte) []map[string]any {
+	var legacy struct {
+		Report map[string]any `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &legacy); err == nil && legacy.Report != nil {
+		return []map[string]any{legacy.Report}
+	}
+
+	var batch []struct {
+		Type string         `json:"type"`
+		Body map[string]any `json:"body"`
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil
+	}
+	renamed := map[string]string{
+		"documentURL":        "document-uri",
+		"blockedURL":         "blocked-uri",
+		"effectiveDirective": "effective-directive",
+		"sourceFile":         "source-file",
+		"lineNumber":         "line-number",
+		"disposition":        "disposition",
+	}
+	var reports []map[string]any
+	for _, entry := range batch {
+		if entry.Type != "csp-violation" || entry.Body == nil {
+			continue
+		}
+		report := make(map[string]any, len(entry.Body))
+		for k, v := range entry.Body {
+			if legacyKey, ok := renamed[k]; ok {
+				k = legacyKey
+			}
+			report[k] = v
+		}
+		// The Reporting API has no separate violated directive.
+		report["violated-directive"] = report["effective-directive"]
+		reports = append(reports, report)
+	}
+	return reports
+}
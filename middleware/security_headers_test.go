@@ -0,0 +1,123 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	t.Run("Default headers", func(t *testing.T) {
+		handler := middleware.SecurityHeadersMiddleware(middleware.DefaultSecurityHeadersConfig())(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		h := rr.Header()
+		assert.Equal(t, "max-age=31536000; includeSubDomains", h.Get("Strict-Transport-Security"))
+		assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+		assert.Equal(t, "DENY", h.Get("X-Frame-Options"))
+		assert.Equal(t, "strict-origin-when-cross-origin", h.Get("Referrer-Policy"))
+		assert.Equal(t, "camera=(), microphone=(), geolocation=()", h.Get("Permissions-Policy"))
+		assert.Equal(t, "default-src 'none'; frame-ancestors 'none'", h.Get("Content-Security-Policy"))
+	})
+
+	t.Run("Per-request nonce", func(t *testing.T) {
+		cfg := middleware.SecurityHeadersConfig{
+			Enabled:               true,
+			ContentSecurityPolicy: "script-src 'self' {nonce}",
+		}
+		var nonces []string
+		handler := middleware.SecurityHeadersMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonces = append(nonces, middleware.GetCSPNonce(r.Context()))
+		}))
+
+		var policies []string
+		for i := 0; i < 2; i++ {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			policies = append(policies, rr.Header().Get("Content-Security-Policy"))
+		}
+
+		require.Len(t, nonces, 2)
+		assert.NotEmpty(t, nonces[0])
+		assert.NotEqual(t, nonces[0], nonces[1])
+		assert.Equal(t, "script-src 'self' 'nonce-"+nonces[0]+"'", policies[0])
+		assert.Empty(t, serveGet(handler).Header().Get("X-Frame-Options"), "unset fields are not sent")
+	})
+
+	t.Run("Report-only mode with report endpoint", func(t *testing.T) {
+		cfg := middleware.SecurityHeadersConfig{
+			Enabled:               true,
+			HSTSMaxAge:            time.Hour,
+			HSTSPreload:           true,
+			ContentSecurityPolicy: "default-src 'self';",
+			CSPReportOnly:         true,
+			CSPReportPath:         "/csp-report",
+		}
+		handler := middleware.SecurityHeadersMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		h := serveGet(handler).Header()
+
+		assert.Empty(t, h.Get("Content-Security-Policy"))
+		assert.Equal(t, "default-src 'self'; report-uri /csp-report; report-to csp-endpoint", h.Get("Content-Security-Policy-Report-Only"))
+		assert.Equal(t, `csp-endpoint="/csp-report"`, h.Get("Reporting-Endpoints"))
+		assert.Equal(t, "max-age=3600; preload", h.Get("Strict-Transport-Security"))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		handler := middleware.SecurityHeadersMiddleware(middleware.SecurityHeadersConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		assert.Empty(t, serveGet(handler).Header())
+	})
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	handler := middleware.CSPReportHandler()
+
+	send := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerContextKey, logger))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Legacy report-uri format", func(t *testing.T) {
+		logs.Reset()
+		rr := send("application/csp-report", `{"csp-report":{"document-uri":"https://app.example.com/","blocked-uri":"https://evil.example.com/x.js","violated-directive":"script-src"}}`)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Contains(t, logs.String(), `"blocked_uri":"https://evil.example.com/x.js"`)
+		assert.Contains(t, logs.String(), `"violated_directive":"script-src"`)
+	})
+
+	t.Run("Reporting API format", func(t *testing.T) {
+		logs.Reset()
+		rr := send("application/reports+json", `[{"type":"csp-violation","body":{"documentURL":"https://app.example.com/","blockedURL":"inline","effectiveDirective":"script-src-elem"}}]`)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Contains(t, logs.String(), `"blocked_uri":"inline"`)
+		assert.Contains(t, logs.String(), `"effective_directive":"script-src-elem"`)
+	})
+
+	t.Run("Garbage is ignored", func(t *testing.T) {
+		logs.Reset()
+		assert.Equal(t, http.StatusNoContent, send("application/json", "not json").Code)
+		assert.Empty(t, logs.String())
+	})
+}
+
+func serveGet(handler http.Handler) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec
+}
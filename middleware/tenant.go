@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+	"github.com/shashtag-ventures/go-common/netutil"
+)
+
+// TenantContextKey is the context key under which TenantMiddleware stores the tenant ID.
+const TenantContextKey CtxKey = "tenantID"
+
+// DefaultTenantHeader is the header read by HeaderTenant when none is given.
+const DefaultTenantHeader = "X-Tenant-ID"
+
+// TenantResolver determines the tenant of a request. It returns "" with a nil error
+// when its source is absent or unknown, so that the next resolver can be tried.
+// Errors built with customErrors (e.g. wrapping ErrNotFound) keep their status code.
+type TenantResolver interface {
+	ResolveTenant(r *http.Request) (string, error)
+}
+
+// TenantResolverFunc adapts a function to TenantResolver.
+type TenantResolverFunc func(r *http.Request) (string, error)
+
+func (f TenantResolverFunc) ResolveTenant(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// TenantLookup maps a subdomain or custom domain to a tenant ID, typically with a
+// cached database query. It returns "" with a nil error for unknown keys.
+type TenantLookup func(ctx context.Context, key string) (string, error)
+
+// SubdomainTenant resolves "<slug>.<baseDomain>" hosts. The slug must be a valid
+// subdomain (see netutil.IsValidSubdomain); lookup maps it to the tenant ID, or the
+// slug is used as the ID if lookup is nil. Reserved slugs such as "www" or "api" are ignored.
+func SubdomainTenant(baseDomain string, lookup TenantLookup, reserved ...string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.TrimPrefix(baseDomain, "."))
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		slug, ok := strings.CutSuffix(requestHost(r), suffix)
+		if !ok || !netutil.IsValidSubdomain(slug) {
+			return "", nil
+		}
+		for _, res := range reserved {
+			if slug == res {
+				return "", nil
+			}
+		}
+		if lookup == nil {
+			return slug, nil
+		}
+		return lookup(r.Context(), slug)
+	})
+}
+
+// CustomDomainTenant resolves tenants that bring their own domain by looking up the
+// full host name, e.g. "app.acme.com".
+func CustomDomainTenant(lookup TenantLookup) TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		host := requestHost(r)
+		if host == "" {
+			return "", nil
+		}
+		return lookup(r.Context(), host)
+	})
+}
+
+// HeaderTenant reads the tenant ID from a request header (DefaultTenantHeader if empty).
+// The header is client-controlled: TenantMiddleware only admits authenticated users to
+// their own tenant or, with TenantConfig.Membership, to tenants they belong to, but
+// anonymous requests may pick any tenant. Only use it behind a gateway that sets it or
+// on routes that require authentication.
+func HeaderTenant(header string) TenantResolver {
+	if header == "" {
+		header = DefaultTenantHeader
+	}
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		return strings.TrimSpace(r.Header.Get(header)), nil
+	})
+}
+
+// ClaimTenant uses the tenant of the authenticated user, i.e. the tenant_id JWT claim.
+// The authentication middleware must run before TenantMiddleware.
+func ClaimTenant() TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		if user, ok := r.Context().Value(UserContextKey).(*AuthenticatedUser); ok && user != nil {
+			return user.TenantID, nil
+		}
+		return "", nil
+	})
+}
+
+// TenantConfig holds the configuration for TenantMiddleware.
+type TenantConfig struct {
+	// Resolvers are tried in order until one yields a tenant.
+	Resolvers []TenantResolver
+	// Optional lets requests without a tenant through, e.g. for a marketing site on the
+	// apex domain. By default they are rejected with 400.
+	Optional bool
+	// Membership reports whether an authenticated user without a TenantID, e.g. one who
+	// belongs to several tenants, may access the tenant. Without it such users are
+	// rejected with 403.
+	Membership func(ctx context.Context, user *AuthenticatedUser, tenantID string) (bool, error)
+}
+
+// TenantMiddleware resolves the tenant of each request and stores its ID in the
+// context (see GetTenantID) and in the request's logger and log state as tenant_id.
+// Authenticated users are only admitted to their own tenant (AuthenticatedUser.TenantID),
+// or to tenants TenantConfig.Membership allows; other requests are rejected with 403, so
+// a token issued for one tenant cannot be used against another.
+// It panics if no resolvers are configured.
+func TenantMiddleware(cfg TenantConfig) func(http.Handler) http.Handler {
+	if len(cfg.Resolvers) == 0 {
+		panic("middleware: TenantConfig.Resolvers is empty")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var tenantID string
+			for _, resolver := range cfg.Resolvers {
+				id, err := resolver.ResolveTenant(r)
+				if err != nil {
+					GetLoggerFromContext(r.Context()).Error("Failed to resolve tenant", "error", err)
+					jsonResponse.SendAutoErrorResponse(w, err)
+					return
+				}
+				if id != "" {
+					tenantID = id
+					break
+				}
+			}
+
+			if tenantID == "" {
+				if cfg.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				jsonResponse.SendErrorResponse(w, customErrors.New("unable to determine tenant", customErrors.ErrInvalidInput), http.StatusBadRequest)
+				return
+			}
+
+			if user, ok := r.Context().Value(UserContextKey).(*AuthenticatedUser); ok && user != nil {
+				member := user.TenantID == tenantID
+				if user.TenantID == "" && cfg.Membership != nil {
+					var err error
+					if member, err = cfg.Membership(r.Context(), user, tenantID); err != nil {
+						GetLoggerFromContext(r.Context()).Error("Failed to check tenant membership", "error", err)
+						jsonResponse.SendAutoErrorResponse(w, err)
+						return
+					}
+				}
+				if !member {
+					jsonResponse.SendErrorResponse(w, customErrors.New("user does not belong to this tenant", customErrors.ErrForbidden), http.StatusForbidden)
+					return
+				}
+			}
+
+			ctx := WithTenantID(r.Context(), tenantID)
+			ctx = EnrichLogger(ctx, slog.String("tenant_id", tenantID))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WithTenantID returns a context carrying the tenant ID, e.g. for background jobs that
+// act on behalf of a tenant.
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, TenantContextKey, tenantID)
+}
+
+// GetTenantID returns the tenant ID stored by TenantMiddleware, or "".
+func GetTenantID(ctx context.Context) string {
+	if id, ok := ctx.Value(TenantContextKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// requestHost returns the lower-cased request host without the port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
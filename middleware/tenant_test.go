@@ -0,0 +1,162 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	customErrors "github.com/shashtag-ventures/go-common/errors"
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantResolvers(t *testing.T) {
+	lookup := func(ctx context.Context, key string) (string, error) {
+		switch key {
+		case "acme", "app.acme.com":
+			return "tenant-acme", nil
+		case "broken":
+			return "", errors.New("db down")
+		}
+		return "", nil
+	}
+	resolve := func(res middleware.TenantResolver, req *http.Request) string {
+		id, err := res.ResolveTenant(req)
+		require.NoError(t, err)
+		return id
+	}
+	newRequest := func(host string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		return req
+	}
+
+	t.Run("Subdomain", func(t *testing.T) {
+		res := middleware.SubdomainTenant("example.com", lookup, "www")
+		assert.Equal(t, "tenant-acme", resolve(res, newRequest("ACME.example.com:8443")))
+		assert.Empty(t, resolve(res, newRequest("unknown.example.com")))
+		assert.Empty(t, resolve(res, newRequest("www.example.com")), "reserved")
+		assert.Empty(t, resolve(res, newRequest("example.com")), "apex")
+		assert.Empty(t, resolve(res, newRequest("a.b.example.com")), "nested")
+		assert.Empty(t, resolve(res, newRequest("acme.example.org")))
+
+		_, err := res.ResolveTenant(newRequest("broken.example.com"))
+		assert.Error(t, err)
+
+		assert.Equal(t, "acme", resolve(middleware.SubdomainTenant(".example.com", nil), newRequest("acme.example.com")))
+	})
+
+	t.Run("Custom domain", func(t *testing.T) {
+		res := middleware.CustomDomainTenant(lookup)
+		assert.Equal(t, "tenant-acme", resolve(res, newRequest("app.acme.com")))
+		assert.Empty(t, resolve(res, newRequest("other.com")))
+	})
+
+	t.Run("Header", func(t *testing.T) {
+		req := newRequest("api.example.com")
+		req.Header.Set(middleware.DefaultTenantHeader, " t-1 ")
+		assert.Equal(t, "t-1", resolve(middleware.HeaderTenant(""), req))
+		assert.Empty(t, resolve(middleware.HeaderTenant("X-Org"), req))
+	})
+
+	t.Run("Claim", func(t *testing.T) {
+		req := newRequest("api.example.com")
+		assert.Empty(t, resolve(middleware.ClaimTenant(), req))
+
+		ctx := context.WithValue(req.Context(), middleware.UserContextKey, &middleware.AuthenticatedUser{ID: "u1", TenantID: "t-2"})
+		assert.Equal(t, "t-2", resolve(middleware.ClaimTenant(), req.WithContext(ctx)))
+	})
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	var gotTenant string
+	var state *middleware.LogState
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = middleware.GetTenantID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(cfg middleware.TenantConfig, req *http.Request) *httptest.ResponseRecorder {
+		gotTenant = ""
+		state = &middleware.LogState{}
+		req = req.WithContext(context.WithValue(req.Context(), middleware.LogStateKey, state))
+		rr := httptest.NewRecorder()
+		middleware.TenantMiddleware(cfg)(next).ServeHTTP(rr, req)
+		return rr
+	}
+	withUser := func(req *http.Request, tenantID string) *http.Request {
+		ctx := context.WithValue(req.Context(), middleware.UserContextKey, &middleware.AuthenticatedUser{ID: "u1", TenantID: tenantID})
+		return req.WithContext(ctx)
+	}
+	cfg := middleware.TenantConfig{Resolvers: []middleware.TenantResolver{
+		middleware.SubdomainTenant("example.com", nil),
+		middleware.HeaderTenant(""),
+	}}
+
+	t.Run("First resolver that matches wins", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://acme.example.com/", nil)
+		req.Header.Set(middleware.DefaultTenantHeader, "other")
+		rr := serve(cfg, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "acme", gotTenant)
+		assert.Equal(t, "acme", state.Fields["tenant_id"])
+	})
+
+	t.Run("Falls back to later resolvers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://api.other.com/", nil)
+		req.Header.Set(middleware.DefaultTenantHeader, "globex")
+		assert.Equal(t, http.StatusOK, serve(cfg, req).Code)
+		assert.Equal(t, "globex", gotTenant)
+	})
+
+	t.Run("Missing tenant", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		assert.Equal(t, http.StatusBadRequest, serve(cfg, req).Code)
+
+		optional := cfg
+		optional.Optional = true
+		assert.Equal(t, http.StatusOK, serve(optional, req).Code)
+		assert.Empty(t, gotTenant)
+	})
+
+	t.Run("User of another tenant is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://acme.example.com/", nil)
+		assert.Equal(t, http.StatusForbidden, serve(cfg, withUser(req, "globex")).Code)
+		assert.Equal(t, http.StatusOK, serve(cfg, withUser(req, "acme")).Code)
+	})
+
+	t.Run("Users without a tenant need membership", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://api.other.com/", nil)
+		req.Header.Set(middleware.DefaultTenantHeader, "globex")
+		assert.Equal(t, http.StatusForbidden, serve(cfg, withUser(req, "")).Code)
+
+		member := cfg
+		member.Membership = func(ctx context.Context, user *middleware.AuthenticatedUser, tenantID string) (bool, error) {
+			return user.ID == "u1" && tenantID == "acme", nil
+		}
+		assert.Equal(t, http.StatusForbidden, serve(member, withUser(req, "")).Code)
+		req.Header.Set(middleware.DefaultTenantHeader, "acme")
+		assert.Equal(t, http.StatusOK, serve(member, withUser(req, "")).Code)
+
+		member.Membership = func(context.Context, *middleware.AuthenticatedUser, string) (bool, error) {
+			return false, errors.New("db down")
+		}
+		assert.Equal(t, http.StatusInternalServerError, serve(member, withUser(req, "")).Code)
+	})
+
+	t.Run("Resolver errors keep their status", func(t *testing.T) {
+		failing := middleware.TenantResolverFunc(func(r *http.Request) (string, error) {
+			return "", customErrors.New("tenant suspended", customErrors.ErrForbidden)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := serve(middleware.TenantConfig{Resolvers: []middleware.TenantResolver{failing}}, req)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Panics without resolvers", func(t *testing.T) {
+		assert.Panics(t, func() { middleware.TenantMiddleware(middleware.TenantConfig{}) })
+	})
+}
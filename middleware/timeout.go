@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/jsonResponse"
+)
+
+// TimeoutConfig sets a deadline on request contexts.
+type TimeoutConfig struct {
+	Timeout time.Duration // Default timeout; 0 means none
+	// Routes override Timeout for route groups. The first match applies.
+	Routes []TimeoutRoute
+}
+
+// TimeoutRoute overrides the timeout for a route group and/or set of methods.
+type TimeoutRoute struct {
+	PathPrefix string        // Route group, e.g. "/reports"; empty matches every path
+	Methods    []string      // Empty matches every method
+	Timeout    time.Duration // Negative means no timeout
+}
+
+func (c TimeoutConfig) timeoutFor(r *http.Request) time.Duration {
+	for _, route := range c.Routes {
+		if matchesRoute(r, route.PathPrefix, route.Methods) {
+			return route.Timeout
+		}
+	}
+	return c.Timeout
+}
+
+// TimeoutMiddleware runs the handler with a context deadline. If the deadline passes
+// before the handler has written anything, the client gets a 503 JSON response and
+// later writes by the handler fail with http.ErrHandlerTimeout. A handler that has
+// already started streaming its response keeps what it has sent.
+//
+// Handlers should pass the request context to database and HTTP calls so that they
+// stop work once the deadline passes. Deadlines nest, so a TimeoutMiddleware on a
+// single route can only shorten the router-wide timeout; use TimeoutConfig.Routes
+// to lengthen it.
+func TimeoutMiddleware(cfg TimeoutConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := cfg.timeoutFor(r)
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, header: w.Header().Clone(), ctx: ctx}
+			done := make(chan struct{})
+			panicChan := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- WrapPanic(p)
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				// Re-panic on the request goroutine so Recovery can handle it. The value
+				// carries the handler's stack, which this goroutine does not have.
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+			}
+
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			if !tw.wroteHeader && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				tw.timedOut = true
+				GetLoggerFromContext(ctx).Warn("Request timed out", "timeout", timeout.String())
+				jsonResponse.SendErrorResponse(w, fmt.Errorf("request timed out"), http.StatusServiceUnavailable)
+				return
+			}
+			select {
+			case <-done:
+				tw.flushHeader()
+			default:
+				// Still running: the handler must not touch w once we return.
+				tw.timedOut = true
+			}
+		})
+	}
+}
+
+// Timeout limits the wrapped route to d. See TimeoutMiddleware.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return TimeoutMiddleware(TimeoutConfig{Timeout: d})
+}
+
+// timeoutWriter passes writes through until the deadline passes. Headers are kept in
+// a separate map until the first write so the timeout response cannot race with them.
+// Once the deadline has passed, writes fail even before the middleware notices, so a
+// handler reacting to the cancelled context cannot pre-empt the timeout response.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+	ctx    context.Context
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expiredLocked() || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expiredLocked() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(data)
+}
+
+// Flush implements http.Flusher so streaming handlers keep working.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expiredLocked() {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// expiredLocked reports whether the handler may no longer write. A response that is
+// already streaming may continue until the middleware returns.
+func (tw *timeoutWriter) expiredLocked() bool {
+	if tw.timedOut {
+		return true
+	}
+	return !tw.wroteHeader && errors.Is(tw.ctx.Err(), context.DeadlineExceeded)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	tw.copyHeader()
+	tw.wroteHeader = true
+	tw.w.WriteHeader(code)
+}
+
+// flushHeader copies the headers of a handler that returned without writing.
+func (tw *timeoutWriter) flushHeader() {
+	if !tw.wroteHeader {
+		tw.copyHeader()
+	}
+}
+
+func (tw *timeoutWriter) copyHeader() {
+	dst := tw.w.Header()
+	for k := range dst {
+		if _, ok := tw.header[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+}
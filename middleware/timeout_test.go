@@ -0,0 +1,93 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shashtag-ventures/go-common/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	handlerErr := make(chan error, 1)
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			_, err := w.Write([]byte("too late"))
+			handlerErr <- err
+		case <-time.After(50 * time.Millisecond):
+			w.Header().Set("X-Handler", "done")
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+
+	cfg := middleware.TimeoutConfig{
+		Timeout: 10 * time.Millisecond,
+		Routes: []middleware.TimeoutRoute{
+			{PathPrefix: "/reports", Timeout: time.Second},
+			{PathPrefix: "/stream", Timeout: -1},
+		},
+	}
+	handler := middleware.TimeoutMiddleware(cfg)(nextHandler)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	t.Run("Times out with 503 JSON", func(t *testing.T) {
+		rr := serve("/items")
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "request timed out")
+		assert.ErrorIs(t, <-handlerErr, http.ErrHandlerTimeout)
+	})
+
+	t.Run("Route groups override the timeout", func(t *testing.T) {
+		for _, path := range []string{"/reports/monthly", "/stream"} {
+			rr := serve(path)
+			assert.Equal(t, http.StatusCreated, rr.Code, path)
+			assert.Equal(t, "done", rr.Header().Get("X-Handler"), path)
+		}
+	})
+
+	t.Run("Context carries the deadline", func(t *testing.T) {
+		var hasDeadline bool
+		h := middleware.Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, hasDeadline = r.Context().Deadline()
+		}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.True(t, hasDeadline)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Panics reach the request goroutine with their origin", func(t *testing.T) {
+		reports := &panicReports{}
+		h := middleware.RecoveryMiddleware(middleware.RecoveryConfig{Reporters: []middleware.PanicReporter{reports}})(
+			middleware.Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			})))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		all := reports.all()
+		require.Len(t, all, 1)
+		assert.Equal(t, "boom", all[0].Value)
+		assert.Contains(t, all[0].Origin, "timeout_test.go:")
+	})
+
+	t.Run("ErrAbortHandler is passed on as is", func(t *testing.T) {
+		h := middleware.Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	})
+}
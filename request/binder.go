@@ -2,12 +2,14 @@ package request
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
+	customErrors "github.com/shashtag-ventures/go-common/errors"
 	"github.com/shashtag-ventures/go-common/netutil"
 )
 
@@ -53,6 +55,27 @@ func New() *Binder {
 // DefaultBinder is the globally shared binder instance.
 var DefaultBinder = New()
 
+// BodyTooLargeError is returned by DecodeAndValidate when the body exceeds the limit
+// set with http.MaxBytesReader (e.g. by middleware.BodyLimitMiddleware).
+// It matches errors.ErrTooLarge, so SendAutoErrorResponse answers it with 413.
+type BodyTooLargeError struct {
+	Limit int64 // Maximum body size in bytes
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body exceeds the limit of %d bytes", e.Limit)
+}
+
+// Unwrap returns errors.ErrTooLarge.
+func (e *BodyTooLargeError) Unwrap() error {
+	return customErrors.ErrTooLarge
+}
+
+// IsBodyTooLarge reports whether err is caused by a request body over the size limit.
+func IsBodyTooLarge(err error) bool {
+	return errors.Is(err, customErrors.ErrTooLarge)
+}
+
 // DecodeAndValidate decodes the request body into v and validates it.
 // It uses the default binder.
 func DecodeAndValidate(r *http.Request, v interface{}) error {
@@ -71,11 +94,11 @@ func (b *Binder) DecodeAndValidate(r *http.Request, v interface{}) error {
 		decoder := json.NewDecoder(r.Body)
 		decoder.DisallowUnknownFields() // Enable strict decoding
 		if err := decoder.Decode(v); err != nil {
-			return fmt.Errorf("invalid json: %w", err)
+			return bodyError("invalid json", err)
 		}
 	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
 		if err := r.ParseForm(); err != nil {
-			return fmt.Errorf("failed to parse form: %w", err)
+			return bodyError("failed to parse form", err)
 		}
 		if err := b.bindForm(r.Form, v); err != nil {
 			return err
@@ -83,13 +106,22 @@ func (b *Binder) DecodeAndValidate(r *http.Request, v interface{}) error {
 	default:
 		// Fallback to JSON if no content type is specified
 		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
-			return fmt.Errorf("failed to decode request body: %w", err)
+			return bodyError("failed to decode request body", err)
 		}
 	}
 
 	return b.Validate(v)
 }
 
+// bodyError turns a read past the body limit into a BodyTooLargeError and wraps any other error.
+func bodyError(msg string, err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return &BodyTooLargeError{Limit: maxErr.Limit}
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
 // Validate performs tag-based validation on the given struct.
 func (b *Binder) Validate(v interface{}) error {
 	return b.validator.Struct(v)
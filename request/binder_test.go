@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	customErrors "github.com/shashtag-ventures/go-common/errors"
 	"github.com/shashtag-ventures/go-common/request"
 	"github.com/stretchr/testify/assert"
 )
@@ -130,3 +131,19 @@ func TestBinder_New(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed on the 'email' tag")
 }
+
+func TestDecodeAndValidate_BodyTooLarge(t *testing.T) {
+	body := `{"name":"John Doe","email":"john@example.com"}`
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, 10)
+
+	var decodedUser TestUser
+	err := request.DecodeAndValidate(req, &decodedUser)
+
+	var tooLarge *request.BodyTooLargeError
+	assert.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, int64(10), tooLarge.Limit)
+	assert.True(t, request.IsBodyTooLarge(err))
+	assert.ErrorIs(t, err, customErrors.ErrTooLarge)
+}
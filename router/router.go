@@ -11,9 +11,31 @@ import (
 // Config holds the configuration for the router.
 type Config struct {
 	ApiVersion      string
+	ClientIP        middleware.ClientIPConfig
 	Cors            middleware.CorsConfig
 	CSRF            middleware.CSRFConfig
 	RateLimit       middleware.RateLimitConfig
+	BodyLimit       middleware.BodyLimitConfig
+	Timeout         middleware.TimeoutConfig
+	Compression     middleware.CompressionConfig
+	// SecurityHeaders is optional; when enabled with a CSPReportPath, New serves the
+	// violation report endpoint at that path outside the API middleware (no CSRF).
+	SecurityHeaders middleware.SecurityHeadersConfig
+	// RequestLogger configures request logging; the zero value logs every request
+	// except health checks.
+	RequestLogger middleware.RequestLoggerConfig
+	// Recovery configures the panic reporters, e.g. Discord or OpenTelemetry.
+	Recovery middleware.RecoveryConfig
+	// Metrics configures the HTTP metrics. With a Registry set, /metrics serves that
+	// registry instead of the global one.
+	Metrics middleware.MetricsConfig
+	// Concurrency sheds load with adaptive per-route-group concurrency limits. Its
+	// metrics go to Metrics.Registry unless it sets its own.
+	Concurrency middleware.ConcurrencyConfig
+	// UserRateLimit is an optional second limiter behind the .Use() middlewares, which
+	// counts authenticated requests per user or API key; anonymous ones pass uncounted.
+	// RateLimit runs in front of CSRF and .Use(), counting every request per client IP.
+	UserRateLimit middleware.RateLimitConfig
 }
 
 // Router is a wrapper around http.ServeMux that supports middleware via .Use()
@@ -21,6 +43,7 @@ type Router struct {
 	*http.ServeMux
 	middlewares []func(http.Handler) http.Handler
 	config      Config
+	metrics     *middleware.HTTPMetrics
 	once        sync.Once
 	fullHandler http.Handler
 }
@@ -32,7 +55,12 @@ func (r *Router) Use(m ...func(http.Handler) http.Handler) {
 
 // buildHandler wraps the base ServeMux with all configured and custom middlewares.
 func (r *Router) buildHandler() http.Handler {
-	var handler http.Handler = r.ServeMux
+	// Record the matched route pattern for the metrics labels.
+	handler := middleware.RecordRoutePattern(r.ServeMux)
+
+	// Per-user rate limiting runs inside the custom middlewares so that authentication
+	// installed via .Use() (e.g. optional JWT auth) identifies the user.
+	handler = middleware.RateLimitMiddleware(r.config.UserRateLimit)(handler)
 
 	// Apply custom middlewares added via .Use()
 	// Reverse order for standard middleware wrap logic (last applied is first executed)
@@ -43,20 +71,41 @@ func (r *Router) buildHandler() http.Handler {
 	// PRODUCTION-ORDER STACK:
 	// Logic: Last applied is FIRST executed.
 
+	// Request limits (body size and deadline), matched against the normalized path
+	handler = middleware.BodyLimitMiddleware(r.config.BodyLimit)(handler)
+	handler = middleware.TimeoutMiddleware(r.config.Timeout)(handler)
+
 	// 5. Security & Redirects (Inner-most system layers)
 	handler = middleware.CSRFMiddleware(r.config.CSRF)(handler)
+	// Counted before CSRF and authentication reject anything, so rejected attempts
+	// (e.g. guessed credentials) are throttled too
 	handler = middleware.RateLimitMiddleware(r.config.RateLimit)(handler)
 	handler = middleware.TrailingSlashMiddleware(handler)
+	handler = middleware.CompressionMiddleware(r.config.Compression)(handler)
+
+	// Load shedding sees every request that costs real work (timeouts inside it count
+	// as overload), while preflights and health checks stay unaffected
+	handler = middleware.ConcurrencyLimitMiddleware(r.config.Concurrency)(handler)
 	handler = middleware.CorsMiddleware(r.config.Cors, handler)
 
 	// 4. Observability (Capture metrics for the secured request)
-	handler = middleware.MetricsMiddleware(handler)
+	if r.metrics != nil {
+		handler = r.metrics.Middleware(handler)
+	} else {
+		handler = middleware.MetricsMiddleware(handler)
+	}
 
 	// 3. Panic Recovery (Protect monitoring layers from handler crashes)
-	handler = middleware.Recovery()(handler)
+	handler = middleware.RecoveryMiddleware(r.config.Recovery)(handler)
+
+	// Security headers apply to every response, including recovered panics
+	handler = middleware.SecurityHeadersMiddleware(r.config.SecurityHeaders)(handler)
 
 	// 2. Global Request Logger (Must run after ID is set)
-	handler = middleware.RequestLogger()(handler)
+	handler = middleware.RequestLoggerMiddleware(r.config.RequestLogger)(handler)
+
+	// Resolve the client IP once for logging, rate limiting and auditing
+	handler = middleware.ClientIPMiddleware(r.config.ClientIP)(handler)
 
 	// 1. Assign Request ID (Outer-most layer - must run first)
 	handler = middleware.RequestIDMiddleware(handler)
@@ -79,19 +128,46 @@ func New(cfg Config) (*http.ServeMux, *Router) {
 	mainRouter := http.NewServeMux()
 	apiMux := http.NewServeMux()
 
+	cfg.UserRateLimit.AuthenticatedOnly = true
+	if cfg.UserRateLimit.KeyPrefix == "" {
+		// Keep its counters apart from RateLimit's when both share a Redis.
+		cfg.UserRateLimit.KeyPrefix = "limiter:user"
+	}
+	if cfg.Concurrency.Registry == nil {
+		cfg.Concurrency.Registry = cfg.Metrics.Registry
+	}
+
 	apiRouter := &Router{
 		ServeMux: apiMux,
 		config:   cfg,
 	}
 
+	var metricsHandler http.Handler = promhttp.Handler()
+	if cfg.Metrics.IsZero() {
+		apiRouter.metrics = middleware.DefaultHTTPMetrics()
+	} else {
+		metrics, err := middleware.NewHTTPMetrics(cfg.Metrics)
+		if err != nil {
+			panic("router: failed to register HTTP metrics: " + err.Error())
+		}
+		apiRouter.metrics = metrics
+		if cfg.Metrics.Registry != nil {
+			metricsHandler = promhttp.HandlerFor(cfg.Metrics.Registry, promhttp.HandlerOpts{})
+		}
+	}
+
 	// Handle all API requests through the apiRouter, which manages the middleware chain.
 	mainRouter.Handle("/api/"+cfg.ApiVersion+"/", apiRouter)
 
-	mainRouter.Handle("/metrics", promhttp.Handler())
+	mainRouter.Handle("/metrics", metricsHandler)
+
+	if cfg.SecurityHeaders.Enabled && cfg.SecurityHeaders.CSPReportPath != "" {
+		mainRouter.Handle("POST "+cfg.SecurityHeaders.CSPReportPath, middleware.RequestIDMiddleware(middleware.CSPReportHandler()))
+	}
 
 	apiRouter.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("API is healthy"))
 	})
 
 	return mainRouter, apiRouter
-}
\ No newline at end of file
+}
@@ -1,11 +1,15 @@
 package router_test
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shashtag-ventures/go-common/middleware"
 	"github.com/shashtag-ventures/go-common/router"
 	"github.com/stretchr/testify/assert"
@@ -90,3 +94,92 @@ func TestNewRouter(t *testing.T) {
 		assert.Equal(t, "http://localhost:3000", resp.Header.Get("Access-Control-Allow-Origin"))
 	})
 }
+
+func TestNewRouter_MetricsRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mainRouter, apiRouter := router.New(router.Config{
+		ApiVersion: "v1",
+		Metrics:    middleware.MetricsConfig{Registry: reg},
+	})
+	apiRouter.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	server := httptest.NewServer(mainRouter)
+	defer server.Close()
+
+	for _, id := range []string{"a", "b"} {
+		resp, err := http.Get(server.URL + "/api/v1/items/" + id)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Contains(t, string(body), `http_requests_total{method="GET",path="/items/{id}",status="200"} 2`)
+	assert.Contains(t, string(body), "http_requests_in_flight")
+	// Only the custom registry is served.
+	assert.NotContains(t, string(body), "go_goroutines")
+}
+
+func TestNewRouter_SecurityHeaders(t *testing.T) {
+	headers := middleware.DefaultSecurityHeadersConfig()
+	headers.CSPReportPath = "/csp-report"
+	mainRouter, _ := router.New(router.Config{ApiVersion: "v1", SecurityHeaders: headers})
+
+	server := httptest.NewServer(mainRouter)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "report-uri /csp-report")
+
+	resp, err = http.Post(server.URL+"/csp-report", "application/csp-report", strings.NewReader(`{"csp-report":{}}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestNewRouter_RateLimit(t *testing.T) {
+	_, apiRouter := router.New(router.Config{
+		ApiVersion: "v1",
+		RateLimit:  middleware.RateLimitConfig{Enabled: true, Limit: 2, Window: 60},
+		UserRateLimit: middleware.RateLimitConfig{Enabled: true, Policies: []middleware.RateLimitPolicy{
+			{User: middleware.RateLimitRate{Limit: 1, Window: time.Minute}},
+		}},
+	})
+	// Stands in for authentication: rejects requests without a user header.
+	apiRouter.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-User")
+			if id == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			user := &middleware.AuthenticatedUser{ID: id}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middleware.UserContextKey, user)))
+		})
+	})
+	apiRouter.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func(ip, user string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		rr := httptest.NewRecorder()
+		apiRouter.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("10.0.0.1", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("10.0.0.1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.1", ""), "rejected attempts count per IP")
+
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2", "u1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.3", "u1"), "users are limited across IPs")
+}
@@ -37,3 +37,10 @@ func CreateTempCSV(t *testing.T, dir, filename, content string) string {
 	assert.NoError(t, err)
 	return filePath
 }
+
+// CreateRequestWithBearer is a helper function to create an HTTP request with an Authorization: Bearer header.
+func CreateRequestWithBearer(token string) *http.Request {
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
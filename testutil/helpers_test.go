@@ -42,3 +42,8 @@ func TestCreateTempCSV(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, content, string(data))
 }
+
+func TestCreateRequestWithBearer(t *testing.T) {
+	req := CreateRequestWithBearer("test-token")
+	assert.Equal(t, "Bearer test-token", req.Header.Get("Authorization"))
+}